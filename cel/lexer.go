@@ -0,0 +1,122 @@
+package cel
+
+import (
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenNumber
+	tokenString
+	tokenSymbol
+)
+
+type token struct {
+	kind     tokenKind
+	text     string
+	number   float64
+	position int
+}
+
+// symbols are matched longest first.
+var symbols = []string{"&&", "||", "==", "!=", "<=", ">=", "!", "<", ">", "+", "-", "*", "/", "%", "(", ")", "[", "]", ".", ",", "?", ":"}
+
+func tokenize(definition string) ([]token, error) {
+	runes := []rune(definition)
+	var tokens []token
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == 'e' || runes[i] == 'E' ||
+				(runes[i] == '-' || runes[i] == '+') && (runes[i-1] == 'e' || runes[i-1] == 'E')) {
+				i++
+			}
+			text := string(runes[start:i])
+			number, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, &parser.SyntaxError{Position: start, Message: "invalid number " + text}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, number: number, position: start})
+		case r == '"' || r == '\'':
+			text, end, err := scanString(runes, i, false)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, position: i})
+			i = end
+		case (r == 'r' || r == 'R') && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\''):
+			text, end, err := scanString(runes, i+1, true)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, position: i})
+			i = end
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdentifier, text: string(runes[start:i]), position: start})
+		default:
+			symbol := matchSymbol(runes[i:])
+			if symbol == "" {
+				return nil, &parser.SyntaxError{Position: i, Message: "unexpected character " + strconv.QuoteRune(r)}
+			}
+			tokens = append(tokens, token{kind: tokenSymbol, text: symbol, position: i})
+			i += len([]rune(symbol))
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, position: len(runes)}), nil
+}
+
+func matchSymbol(runes []rune) string {
+	rest := string(runes)
+	for _, symbol := range symbols {
+		if strings.HasPrefix(rest, symbol) {
+			return symbol
+		}
+	}
+	return ""
+}
+
+// escapes are the escape sequences of quoted strings other than raw ones.
+var escapes = map[rune]rune{'n': '\n', 't': '\t', 'r': '\r', '\\': '\\', '"': '"', '\'': '\''}
+
+// scanString reads the string whose opening quote is at i. Raw strings keep
+// their backslashes, which suits regular expressions.
+func scanString(runes []rune, i int, raw bool) (string, int, error) {
+	quote := runes[i]
+	start := i
+	i++
+
+	var sb strings.Builder
+	for i < len(runes) && runes[i] != quote {
+		if runes[i] == '\\' && !raw && i+1 < len(runes) {
+			escaped, known := escapes[runes[i+1]]
+			if !known {
+				return "", 0, &parser.SyntaxError{Position: i, Message: "unknown escape sequence \\" + string(runes[i+1])}
+			}
+			sb.WriteRune(escaped)
+			i += 2
+			continue
+		}
+		sb.WriteRune(runes[i])
+		i++
+	}
+	if i >= len(runes) {
+		return "", 0, &parser.SyntaxError{Position: start, Message: "unterminated string"}
+	}
+	return sb.String(), i + 1, nil
+}
@@ -0,0 +1,340 @@
+package cel
+
+import (
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"math"
+	"strconv"
+)
+
+// Parse translates a definition written in a subset of the Common Expression
+// Language into the syntax tree of the native rule language:
+//
+//	a || b, a && b, !a                 connectives
+//	== != < <= > >= in                 comparisons, which do not chain
+//	+ - * / % and prefix -             arithmetic
+//	a.b, a[0], a["b"]                  paths into the values
+//	f(x), x.f(y)                       calls, the receiver being the first argument
+//	[a, b], "s", 's', r"raw", 1, 2.5, true, false
+//
+// size is an alias of the len function. Conditionals, null, maps and
+// message construction are not supported.
+func Parse(definition string) (parser.Node, error) {
+	tokens, err := tokenize(definition)
+	if err != nil {
+		return nil, err
+	}
+
+	p := celParser{tokens: tokens}
+	node, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, p.unexpected(next)
+	}
+	return node, nil
+}
+
+// aliases rename CEL functions to the functions of the rule language.
+var aliases = map[string]string{"size": "len"}
+
+var (
+	relations = map[string]parser.Operator{
+		"==": parser.OpEq,
+		"!=": parser.OpNeq,
+		"<":  parser.OpLt,
+		"<=": parser.OpLte,
+		">":  parser.OpGt,
+		">=": parser.OpGte,
+		"in": parser.OpIn,
+	}
+	additions       = map[string]parser.Operator{"+": parser.OpAdd, "-": parser.OpSub}
+	multiplications = map[string]parser.Operator{"*": parser.OpMul, "/": parser.OpDiv, "%": parser.OpMod}
+)
+
+type celParser struct {
+	tokens   []token
+	position int
+}
+
+func (p *celParser) peek() token {
+	return p.tokens[p.position]
+}
+
+func (p *celParser) next() token {
+	t := p.tokens[p.position]
+	if t.kind != tokenEOF {
+		p.position++
+	}
+	return t
+}
+
+// accept consumes the next token when it is the given symbol.
+func (p *celParser) accept(symbol string) bool {
+	if t := p.peek(); t.kind == tokenSymbol && t.text == symbol {
+		p.position++
+		return true
+	}
+	return false
+}
+
+func (p *celParser) expect(symbol string) error {
+	if !p.accept(symbol) {
+		return p.unexpected(p.peek())
+	}
+	return nil
+}
+
+func (p *celParser) unexpected(t token) error {
+	if t.kind == tokenEOF {
+		return &parser.SyntaxError{Position: t.position, Message: "unexpected end of definition"}
+	}
+	return &parser.SyntaxError{Position: t.position, Message: fmt.Sprintf("unexpected %q", t.text)}
+}
+
+func (p *celParser) parseExpression() (parser.Node, error) {
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokenSymbol && t.text == "?" {
+		return nil, &parser.SyntaxError{Position: t.position, Message: "conditional expressions are not supported"}
+	}
+	return node, nil
+}
+
+func (p *celParser) parseOr() (parser.Node, error) {
+	return p.parseLogical("||", parser.OpOr, p.parseAnd)
+}
+
+func (p *celParser) parseAnd() (parser.Node, error) {
+	return p.parseLogical("&&", parser.OpAnd, p.parseRelation)
+}
+
+func (p *celParser) parseLogical(symbol string, operator parser.Operator, operand func() (parser.Node, error)) (parser.Node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(symbol) {
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &parser.Binary{Operator: operator, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *celParser) relation() (parser.Operator, bool) {
+	t := p.peek()
+	if t.kind != tokenSymbol && !(t.kind == tokenIdentifier && t.text == "in") {
+		return "", false
+	}
+	operator, isRelation := relations[t.text]
+	return operator, isRelation
+}
+
+func (p *celParser) parseRelation() (parser.Node, error) {
+	left, err := p.parseBinary(additions, p.parseMultiplication)
+	if err != nil {
+		return nil, err
+	}
+
+	operator, isRelation := p.relation()
+	if !isRelation {
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.parseBinary(additions, p.parseMultiplication)
+	if err != nil {
+		return nil, err
+	}
+	if _, chained := p.relation(); chained {
+		return nil, &parser.SyntaxError{Position: p.peek().position, Message: "comparisons cannot be chained"}
+	}
+	return &parser.Binary{Operator: operator, Left: left, Right: right}, nil
+}
+
+func (p *celParser) parseMultiplication() (parser.Node, error) {
+	return p.parseBinary(multiplications, p.parseUnary)
+}
+
+func (p *celParser) parseBinary(operators map[string]parser.Operator, operand func() (parser.Node, error)) (parser.Node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		operator, exists := operators[t.text]
+		if t.kind != tokenSymbol || !exists {
+			return left, nil
+		}
+		p.next()
+
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &parser.Binary{Operator: operator, Left: left, Right: right}
+	}
+}
+
+func (p *celParser) parseUnary() (parser.Node, error) {
+	switch {
+	case p.accept("!"):
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &parser.Unary{Operator: parser.OpNot, Operand: operand}, nil
+	case p.accept("-"):
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &parser.Unary{Operator: parser.OpNeg, Operand: operand}, nil
+	}
+	return p.parseMember()
+}
+
+// parseMember reads field selections, indexes and method calls after a
+// primary expression. Selections and indexes extend the path of a variable;
+// a method call passes its receiver as the first argument.
+func (p *celParser) parseMember() (parser.Node, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		start := p.peek()
+		switch {
+		case p.accept("."):
+			field := p.next()
+			if field.kind != tokenIdentifier {
+				return nil, p.unexpected(field)
+			}
+			if p.accept("(") {
+				args, err := p.parseArguments(")")
+				if err != nil {
+					return nil, err
+				}
+				node = call(field.text, append([]parser.Node{node}, args...))
+				continue
+			}
+			variable, isVariable := node.(*parser.Variable)
+			if !isVariable {
+				return nil, &parser.SyntaxError{Position: start.position, Message: "fields can only be selected from variables"}
+			}
+			node = &parser.Variable{Name: variable.Name + "." + field.text}
+		case p.accept("["):
+			index, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			step, valid := pathStep(index)
+			variable, isVariable := node.(*parser.Variable)
+			if !valid || !isVariable {
+				return nil, &parser.SyntaxError{Position: start.position, Message: "only variables can be indexed, with a non-negative integer or a field name"}
+			}
+			node = &parser.Variable{Name: variable.Name + step}
+		default:
+			return node, nil
+		}
+	}
+}
+
+// pathStep renders an index as a step of a variable path: [n] for integers and
+// .name for strings that are identifiers.
+func pathStep(index parser.Node) (string, bool) {
+	literal, isLiteral := index.(*parser.Literal)
+	if !isLiteral {
+		return "", false
+	}
+	switch value := literal.Value.(type) {
+	case float64:
+		if value >= 0 && value == math.Trunc(value) {
+			return "[" + strconv.FormatFloat(value, 'f', -1, 64) + "]", true
+		}
+	case string:
+		if parser.IsIdentifier(value) {
+			return "." + value, true
+		}
+	}
+	return "", false
+}
+
+func (p *celParser) parsePrimary() (parser.Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return &parser.Literal{Value: t.number}, nil
+	case tokenString:
+		return &parser.Literal{Value: t.text}, nil
+	case tokenIdentifier:
+		switch t.text {
+		case "true", "false":
+			return &parser.Literal{Value: t.text == "true"}, nil
+		case "null":
+			return nil, &parser.SyntaxError{Position: t.position, Message: "null is not supported"}
+		case "in":
+			return nil, p.unexpected(t)
+		}
+		if p.accept("(") {
+			args, err := p.parseArguments(")")
+			if err != nil {
+				return nil, err
+			}
+			return call(t.text, args), nil
+		}
+		return &parser.Variable{Name: t.text}, nil
+	case tokenSymbol:
+		switch t.text {
+		case "(":
+			node, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		case "[":
+			elements, err := p.parseArguments("]")
+			if err != nil {
+				return nil, err
+			}
+			return &parser.List{Elements: elements}, nil
+		}
+	}
+	return nil, p.unexpected(t)
+}
+
+// parseArguments reads comma separated expressions up to the closing symbol,
+// allowing a trailing comma.
+func (p *celParser) parseArguments(closing string) ([]parser.Node, error) {
+	args := []parser.Node{}
+	for !p.accept(closing) {
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if !p.accept(",") {
+			return args, p.expect(closing)
+		}
+	}
+	return args, nil
+}
+
+func call(name string, args []parser.Node) *parser.Call {
+	if alias, exists := aliases[name]; exists {
+		name = alias
+	}
+	return &parser.Call{Name: name, Args: args}
+}
@@ -0,0 +1,109 @@
+package cel
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name       string
+		definition string
+		expected   string
+	}{
+		{
+			name:       "should translate connectives and comparisons",
+			definition: "!(a && b) || c == 'x' && d != 2.5",
+			expected:   `NOT (a AND b) OR c == "x" AND d != 2.5`,
+		},
+		{
+			name:       "should respect arithmetic precedence",
+			definition: "-a + b * (c - 1) % 2 >= 1e2",
+			expected:   "-a + b * (c - 1) % 2 >= 100",
+		},
+		{
+			name:       "should translate paths",
+			definition: `user.address.city == "Recife" && items[0].price < 10 && user["name"] != ""`,
+			expected:   `user.address.city == "Recife" AND items[0].price < 10 AND user.name != ""`,
+		},
+		{
+			name:       "should translate lists and in",
+			definition: `role in ["admin", "owner",] && !(1 in [])`,
+			expected:   `role IN ["admin", "owner"] AND NOT 1 IN []`,
+		},
+		{
+			name:       "should pass method receivers as the first argument",
+			definition: `name.startsWith("A") && size(tags) > 0 && email.matches(r"^\w+@example\.com$")`,
+			expected:   `startsWith(name, "A") AND len(tags) > 0 AND matches(email, "^\\w+@example\\.com$")`,
+		},
+		{
+			name:       "should read escape sequences",
+			definition: `s == "a\"b\n"`,
+			expected:   `s == "a\"b\n"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, err := Parse(tc.definition)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, node.String())
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		definition    string
+		expectedError string
+	}{
+		{
+			name:          "should reject conditionals",
+			definition:    "a ? b : c",
+			expectedError: "syntax error at position 2: conditional expressions are not supported",
+		},
+		{
+			name:          "should reject null",
+			definition:    "a == null",
+			expectedError: "syntax error at position 5: null is not supported",
+		},
+		{
+			name:          "should reject chained comparisons",
+			definition:    "1 < x < 3",
+			expectedError: "syntax error at position 6: comparisons cannot be chained",
+		},
+		{
+			name:          "should reject indexes that are not literals",
+			definition:    "items[i] > 1",
+			expectedError: "syntax error at position 5: only variables can be indexed, with a non-negative integer or a field name",
+		},
+		{
+			name:          "should reject fields of other expressions",
+			definition:    "(a + b).c",
+			expectedError: "syntax error at position 7: fields can only be selected from variables",
+		},
+		{
+			name:          "should reject the native keywords as operators",
+			definition:    "a and b",
+			expectedError: `syntax error at position 2: unexpected "and"`,
+		},
+		{
+			name:          "should reject unterminated strings",
+			definition:    `name == "bob`,
+			expectedError: "syntax error at position 8: unterminated string",
+		},
+		{
+			name:          "should reject unknown characters",
+			definition:    "a & b",
+			expectedError: `syntax error at position 2: unexpected character '&'`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.definition)
+			assert.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
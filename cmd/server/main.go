@@ -1,34 +1,74 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"github.com/viclisboa/regularExpressionEvaluatorAPI/handler"
 	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
 	"github.com/viclisboa/regularExpressionEvaluatorAPI/service"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/tracing"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 )
 
+const (
+	defaultShutdownTimeout  = 15 * time.Second
+	defaultRequestTimeout   = 5 * time.Second
+	defaultBackfillTimeout  = time.Minute
+	expressionCacheCapacity = 1000
+)
+
 func main() {
 
 	log.SetFormatter(&log.JSONFormatter{})
 	log.SetOutput(os.Stdout)
 	log.SetLevel(log.InfoLevel)
 
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		log.WithField("err", err.Error()).Fatal("error initializing tracing")
+	}
+
 	repo, err := repository.NewRepository("postgres", `host=database user=pg password=pass dbname=postgres port=5432 sslmode=disable`)
 	if err != nil {
 		panic("error initializing database")
 	}
 
-	svc := service.ExpressionService{}
+	expressionCache := service.NewExpressionCache(expressionCacheCapacity)
 
 	expressionHandler := handler.ExpressionHandler{
-		ExpressionService:    svc,
+		ExpressionService: service.ExpressionService{
+			Cache:                  expressionCache,
+			Source:                 &repo,
+			Store:                  &repo,
+			MaxTruthTableVariables: getEnvInt("TRUTH_TABLE_MAX_VARIABLES", service.DefaultMaxTruthTableVariables),
+			Limits: service.Limits{
+				MaxDefinitionLength: getEnvInt("MAX_DEFINITION_LENGTH", service.DefaultMaxDefinitionLength),
+				MaxDepth:            getEnvInt("MAX_EXPRESSION_DEPTH", service.DefaultMaxDepth),
+				MaxNodes:            getEnvInt("MAX_EXPRESSION_NODES", service.DefaultMaxNodes),
+				MaxVariables:        getEnvInt("MAX_EXPRESSION_VARIABLES", service.DefaultMaxVariables),
+				EvaluationTimeout:   getEnvDuration("EVALUATION_TIMEOUT", service.DefaultEvaluationTimeout),
+				MaxValues:           getEnvInt("MAX_VALUES", service.DefaultMaxValues),
+				MaxValueDepth:       getEnvInt("MAX_VALUE_DEPTH", service.DefaultMaxValueDepth),
+			},
+		},
 		ExpressionRepository: &repo,
+		MaxBodyBytes:         int64(getEnvInt("MAX_BODY_BYTES", handler.DefaultMaxBodyBytes)),
+	}
+
+	backfillReferences(&expressionHandler.ExpressionService, getEnvDuration("BACKFILL_TIMEOUT", defaultBackfillTimeout))
+
+	healthHandler := handler.HealthHandler{
+		ExpressionRepository: &repo,
+		ExpressionCache:      expressionCache,
 	}
 
 	credentials := map[string]string{
@@ -36,12 +76,34 @@ func main() {
 	}
 
 	r := chi.NewRouter()
-	r.Use(middleware.BasicAuth("", credentials))
-	r.Get("/evaluate/{expressionId}", expressionHandler.EvaluateExpression)
-	r.Get("/expressions", expressionHandler.GetAllExpressions)
-	r.Post("/expressions/{expressionId}", expressionHandler.SaveExpression)
-	r.Delete("/expressions/{expressionId}", expressionHandler.SaveExpression)
-	r.Post("/expressions", expressionHandler.CreateExpression)
+	r.NotFound(handler.NotFound)
+	r.MethodNotAllowed(handler.MethodNotAllowed)
+	r.Use(handler.RequestLogger)
+	r.Use(handler.Tracing)
+	r.Use(handler.Metrics)
+	r.Get("/healthz", healthHandler.Liveness)
+	r.Get("/readyz", healthHandler.Readiness)
+	r.Handle("/metrics", promhttp.Handler())
+
+	r.Group(func(r chi.Router) {
+		r.Use(handler.BasicAuth("", credentials))
+		r.Use(handler.Deadline(getEnvDuration("REQUEST_TIMEOUT", defaultRequestTimeout)))
+		r.Get("/evaluate/{expressionId}", expressionHandler.EvaluateExpression)
+		r.Post("/evaluate/{expressionId}", expressionHandler.EvaluateExpression)
+		r.Get("/expressions", expressionHandler.GetAllExpressions)
+		r.Get("/expressions/{expressionId}/variables", expressionHandler.GetExpressionVariables)
+		r.Get("/expressions/{expressionId}/truth-table", expressionHandler.GetTruthTable)
+		r.Get("/expressions/{expressionId}/analysis", expressionHandler.GetExpressionAnalysis)
+		r.Get("/expressions/{expressionId}/versions", expressionHandler.GetExpressionVersions)
+		r.Get("/expressions/{expressionId}/simplify", expressionHandler.SimplifyExpression)
+		r.Post("/expressions/{expressionId}/simplify", expressionHandler.SimplifyExpression)
+		r.Post("/expressions/{expressionId}", expressionHandler.SaveExpression)
+		r.Delete("/expressions/{expressionId}", expressionHandler.DeleteExpression)
+		r.Post("/expressions", expressionHandler.CreateExpression)
+		r.Post("/equivalence", expressionHandler.CompareExpressions)
+		r.Get("/dependencies", expressionHandler.GetDependencyGraph)
+		r.Get("/functions", expressionHandler.GetFunctions)
+	})
 
 	http.Handle("/", r)
 
@@ -53,9 +115,102 @@ func main() {
 		MaxHeaderBytes: 1 << 20,
 	}
 
-	log.Info("starting server")
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Info("starting server")
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.WithField("err", err.Error()).Fatal("listen and serve died")
+		}
+	case <-ctx.Done():
+		stop()
+		shutdown(server, &repo, expressionCache, shutdownTracing, getEnvDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout))
+	}
+}
+
+// backfillReferences records the references of the expressions stored before
+// references were recorded with them. A failure leaves deletes unguarded for
+// those expressions until the next start, so it is logged but not fatal.
+func backfillReferences(expressionService *service.ExpressionService, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := expressionService.BackfillReferences(ctx); err != nil {
+		log.WithField("err", err.Error()).Error("error recording expression references")
+	}
+}
+
+// shutdown stops accepting new connections, waits for in-flight requests to
+// finish within the given timeout, flushes pending spans and then releases the
+// cache and repository.
+func shutdown(server *http.Server, repo *repository.Repository, cache *service.ExpressionCache, shutdownTracing func(context.Context) error, timeout time.Duration) {
+	logger := log.WithField("timeout", timeout.String())
+	logger.Info("shutting down server")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		logger.WithField("err", err.Error()).Error("error draining connections, forcing close")
+		_ = server.Close()
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		logger.WithField("err", err.Error()).Error("error flushing traces")
+	}
+
+	cache.Purge()
+
+	if err := repo.Close(); err != nil {
+		logger.WithField("err", err.Error()).Error("error closing repository")
+	}
+
+	logger.Info("server stopped")
+}
 
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatal("listen and serve died", "err", err)
+// getEnvDuration reads a positive Go duration such as "30s" from the named
+// environment variable, falling back to the default when unset or invalid.
+func getEnvDuration(name string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(name)
+	if !exists {
+		return fallback
 	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.WithFields(log.Fields{
+			"variable": name,
+			"value":    value,
+		}).Warn("invalid duration, using default")
+		return fallback
+	}
+
+	return duration
+}
+
+// getEnvInt reads a positive integer from the named environment variable,
+// falling back to the default when unset or invalid.
+func getEnvInt(name string, fallback int) int {
+	value, exists := os.LookupEnv(name)
+	if !exists {
+		return fallback
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		log.WithFields(log.Fields{
+			"variable": name,
+			"value":    value,
+		}).Warn("invalid integer, using default")
+		return fallback
+	}
+
+	return number
 }
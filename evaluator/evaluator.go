@@ -0,0 +1,283 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+)
+
+// evaluation computes the value of one node of a compiled definition.
+type evaluation func(ctx context.Context, values map[string]interface{}) (interface{}, error)
+
+// Program is a compiled definition. It keeps no state between evaluations, so
+// it is safe to evaluate concurrently.
+type Program struct {
+	run evaluation
+}
+
+// Compile turns a syntax tree into a program of nested closures, so the tree
+// is walked once rather than on every evaluation. References must already be
+// inlined and calls bound to their function.
+func Compile(node parser.Node) (*Program, error) {
+	run, err := compile(node)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{run: run}, nil
+}
+
+// Evaluate runs the program with the given variable values: booleans, float64
+// numbers, strings and []interface{} lists. It stops with the context error
+// once ctx is done, checking between operators and on every element ANY IN and
+// ALL IN loop over, so a cancelled or timed out evaluation does not keep
+// running. Function calls are not interrupted, but their result is discarded
+// once the deadline has passed.
+func (p *Program) Evaluate(ctx context.Context, values map[string]interface{}) (interface{}, error) {
+	return p.run(ctx, values)
+}
+
+func compile(node parser.Node) (evaluation, error) {
+	switch node.(type) {
+	case *parser.Literal, *parser.Regex, *parser.Variable, *parser.Reference:
+		return compileNode(node)
+	}
+
+	run, err := compileNode(node)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, values map[string]interface{}) (interface{}, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result, err := run(ctx, values)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return result, err
+	}, nil
+}
+
+func compileNode(node parser.Node) (evaluation, error) {
+	switch n := node.(type) {
+	case *parser.Literal:
+		return constant(n.Value), nil
+	case *parser.Regex:
+		return constant(n.Regexp()), nil
+	case *parser.Variable:
+		return variable(n.Name), nil
+	case *parser.Reference:
+		return nil, fmt.Errorf("reference %s is not resolved", n)
+	case *parser.List:
+		return compileList(n)
+	case *parser.Call:
+		return compileCall(n)
+	case *parser.Unary:
+		return compileUnary(n)
+	case *parser.Binary:
+		if n.Operator.IsLogical() {
+			return compileLogical(n)
+		}
+		return compileBinary(n)
+	}
+	return nil, fmt.Errorf("cannot compile %s", node)
+}
+
+func constant(value interface{}) evaluation {
+	return func(context.Context, map[string]interface{}) (interface{}, error) {
+		return value, nil
+	}
+}
+
+func variable(name string) evaluation {
+	return func(_ context.Context, values map[string]interface{}) (interface{}, error) {
+		value, exists := values[name]
+		if !exists {
+			return nil, fmt.Errorf("missing value for variable %s", name)
+		}
+		return value, nil
+	}
+}
+
+func compileAll(nodes []parser.Node) ([]evaluation, error) {
+	runs := make([]evaluation, len(nodes))
+	for i, node := range nodes {
+		run, err := compile(node)
+		if err != nil {
+			return nil, err
+		}
+		runs[i] = run
+	}
+	return runs, nil
+}
+
+func runAll(ctx context.Context, runs []evaluation, values map[string]interface{}) ([]interface{}, error) {
+	results := make([]interface{}, len(runs))
+	for i, run := range runs {
+		result, err := run(ctx, values)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+func compileList(list *parser.List) (evaluation, error) {
+	elements, err := compileAll(list.Elements)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, values map[string]interface{}) (interface{}, error) {
+		return runAll(ctx, elements, values)
+	}, nil
+}
+
+func compileCall(call *parser.Call) (evaluation, error) {
+	function := call.Function
+	if function == nil {
+		return nil, fmt.Errorf("function %s is not bound", call.Name)
+	}
+	args, err := compileAll(call.Args)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, values map[string]interface{}) (interface{}, error) {
+		evaluated, err := runAll(ctx, args, values)
+		if err != nil {
+			return nil, err
+		}
+		return invoke(function, evaluated)
+	}, nil
+}
+
+// invoke checks the type of each argument before calling the function and the
+// type of its result after, so a variable holding the wrong type fails the
+// evaluation instead of panicking inside the function.
+func invoke(function *parser.Function, args []interface{}) (interface{}, error) {
+	for i, arg := range args {
+		if expected := function.ParameterType(i); expected != parser.TypeAny && TypeOf(arg) != expected {
+			return nil, fmt.Errorf("argument %d of %s must be a %s, got %v", i+1, function.Name, expected, arg)
+		}
+	}
+	result, err := function.Call(args...)
+	if err != nil {
+		return nil, err
+	}
+	if function.Returns != parser.TypeAny && TypeOf(result) != function.Returns {
+		return nil, fmt.Errorf("%s must return a %s, got %v", function.Name, function.Returns, result)
+	}
+	return result, nil
+}
+
+func compileUnary(unary *parser.Unary) (evaluation, error) {
+	operand, err := compile(unary.Operand)
+	if err != nil {
+		return nil, err
+	}
+
+	switch unary.Operator {
+	case parser.OpNot:
+		return func(ctx context.Context, values map[string]interface{}) (interface{}, error) {
+			value, err := booleanOperand(ctx, operand, values, parser.OpNot, "operand")
+			if err != nil {
+				return nil, err
+			}
+			return !value, nil
+		}, nil
+	case parser.OpNeg:
+		return func(ctx context.Context, values map[string]interface{}) (interface{}, error) {
+			value, err := operand(ctx, values)
+			if err != nil {
+				return nil, err
+			}
+			number, isNumber := value.(float64)
+			if !isNumber {
+				return nil, fmt.Errorf("operand of - must be a number, got %v", value)
+			}
+			return -number, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown unary operator %s", unary.Operator)
+}
+
+// compileLogical evaluates the connectives left to right, skipping the right
+// side once the left side decides the result.
+func compileLogical(binary *parser.Binary) (evaluation, error) {
+	left, err := compile(binary.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := compile(binary.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	operator := binary.Operator
+	return func(ctx context.Context, values map[string]interface{}) (interface{}, error) {
+		l, err := booleanOperand(ctx, left, values, operator, "left side")
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case operator == parser.OpAnd && !l:
+			return false, nil
+		case operator == parser.OpOr && l:
+			return true, nil
+		case operator == parser.OpImplies && !l:
+			return true, nil
+		}
+
+		r, err := booleanOperand(ctx, right, values, operator, "right side")
+		if err != nil {
+			return nil, err
+		}
+		switch operator {
+		case parser.OpXor:
+			return l != r, nil
+		case parser.OpIff:
+			return l == r, nil
+		default:
+			return r, nil
+		}
+	}, nil
+}
+
+func booleanOperand(ctx context.Context, run evaluation, values map[string]interface{}, operator parser.Operator, side string) (bool, error) {
+	value, err := run(ctx, values)
+	if err != nil {
+		return false, err
+	}
+	boolean, isBool := value.(bool)
+	if !isBool {
+		return false, fmt.Errorf("%s of %s must be a boolean, got %v", side, operator, value)
+	}
+	return boolean, nil
+}
+
+func compileBinary(binary *parser.Binary) (evaluation, error) {
+	operation, exists := operations[binary.Operator]
+	if !exists {
+		return nil, fmt.Errorf("unknown operator %s", binary.Operator)
+	}
+	left, err := compile(binary.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := compile(binary.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, values map[string]interface{}) (interface{}, error) {
+		l, err := left(ctx, values)
+		if err != nil {
+			return nil, err
+		}
+		r, err := right(ctx, values)
+		if err != nil {
+			return nil, err
+		}
+		return operation(ctx, l, r)
+	}, nil
+}
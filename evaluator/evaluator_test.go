@@ -0,0 +1,233 @@
+package evaluator
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		definition string
+		values     map[string]interface{}
+		expected   interface{}
+	}{
+		{
+			name:       "should evaluate connectives",
+			definition: "(a xor b) and (a -> not b) and (a <-> true) or b",
+			values:     map[string]interface{}{"a": true, "b": false},
+			expected:   true,
+		},
+		{
+			name:       "should evaluate arithmetic",
+			definition: "-x + 10 / 4 * 2 - 7 % 4",
+			values:     map[string]interface{}{"x": 1.5},
+			expected:   0.5,
+		},
+		{
+			name:       "should concatenate and order strings",
+			definition: `name + "!" == "bob!" and "abc" < name and name <= "bob"`,
+			values:     map[string]interface{}{"name": "bob"},
+			expected:   true,
+		},
+		{
+			name:       "should compare values of different types as different",
+			definition: `x != "1" and x == 1 and tags == ["a", 1]`,
+			values:     map[string]interface{}{"x": 1.0, "tags": []interface{}{"a", 1.0}},
+			expected:   true,
+		},
+		{
+			name:       "should evaluate list operators",
+			definition: `role in ["admin", "owner"] and tags contains "beta" and any tags in ["x", "beta"] and not all tags in ["beta"]`,
+			values:     map[string]interface{}{"role": "owner", "tags": []interface{}{"beta", "preview"}},
+			expected:   true,
+		},
+		{
+			name:       "should match regular expressions",
+			definition: `email =~ /^[a-z]+@example\.com$/i and code matches pattern`,
+			values:     map[string]interface{}{"email": "Bob@Example.com", "code": "AB-1", "pattern": "^[A-Z]{2}-"},
+			expected:   true,
+		},
+		{
+			name:       "should skip the right side once the left side decides",
+			definition: "(false and missing) or (true or missing) and (false -> missing)",
+			values:     map[string]interface{}{},
+			expected:   true,
+		},
+		{
+			name:       "should evaluate lists",
+			definition: "[a, a + 1]",
+			values:     map[string]interface{}{"a": 1.0},
+			expected:   []interface{}{1.0, 2.0},
+		},
+		{
+			name:       "should call bound functions",
+			definition: `upper(name) == "BOB"`,
+			values:     map[string]interface{}{"name": "bob"},
+			expected:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			program, err := Compile(parse(t, tc.definition))
+			assert.NoError(t, err)
+
+			result, err := program.Evaluate(context.Background(), tc.values)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		definition    string
+		values        map[string]interface{}
+		expectedError string
+	}{
+		{
+			name:          "should reject missing variables",
+			definition:    "a or b",
+			values:        map[string]interface{}{"a": false},
+			expectedError: "missing value for variable b",
+		},
+		{
+			name:          "should reject operands of connectives that are not booleans",
+			definition:    "a and b",
+			values:        map[string]interface{}{"a": true, "b": 1.0},
+			expectedError: "right side of AND must be a boolean, got 1",
+		},
+		{
+			name:          "should reject arithmetic on other types",
+			definition:    `x * 2 > 1`,
+			values:        map[string]interface{}{"x": "2"},
+			expectedError: "left side of * must be a number, got 2",
+		},
+		{
+			name:          "should reject ordering values of different types",
+			definition:    `x < 2`,
+			values:        map[string]interface{}{"x": "1"},
+			expectedError: "< compares two numbers or two strings, got 1 and 2",
+		},
+		{
+			name:          "should reject division by zero",
+			definition:    "x / 0 > 1",
+			values:        map[string]interface{}{"x": 1.0},
+			expectedError: "division by zero",
+		},
+		{
+			name:          "should reject list operators on other types",
+			definition:    "x in y",
+			values:        map[string]interface{}{"x": 1.0, "y": 1.0},
+			expectedError: "right side of IN must be a list, got 1",
+		},
+		{
+			name:          "should reject invalid patterns from values",
+			definition:    "x matches y",
+			values:        map[string]interface{}{"x": "a", "y": "a(b"},
+			expectedError: "error parsing regexp: missing closing ): `a(b`",
+		},
+		{
+			name:          "should check the arguments of calls",
+			definition:    "upper(x) == 'A'",
+			values:        map[string]interface{}{"x": true},
+			expectedError: "argument 1 of upper must be a string, got true",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			program, err := Compile(parse(t, tc.definition))
+			assert.NoError(t, err)
+
+			_, err = program.Evaluate(context.Background(), tc.values)
+			assert.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	_, err := Compile(parseUnbound(t, "@isActive and a"))
+	assert.EqualError(t, err, "reference @isActive is not resolved")
+
+	_, err = Compile(parseUnbound(t, "shout(a)"))
+	assert.EqualError(t, err, "function shout is not bound")
+}
+
+func TestEvaluateStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	node := parseUnbound(t, "upper(a) == \"A\" and upper(b) == \"B\"")
+	parser.Walk(node, func(n parser.Node) {
+		if call, isCall := n.(*parser.Call); isCall {
+			call.Function = &parser.Function{
+				Name:       "upper",
+				Parameters: []parser.Type{parser.TypeString},
+				Returns:    parser.TypeString,
+				Call: func(args ...interface{}) (interface{}, error) {
+					calls++
+					cancel()
+					return strings.ToUpper(args[0].(string)), nil
+				},
+			}
+		}
+	})
+	program, err := Compile(node)
+	assert.NoError(t, err)
+
+	_, err = program.Evaluate(ctx, map[string]interface{}{"a": "a", "b": "b"})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls, "the evaluation should stop once the context is done")
+}
+
+func TestEvaluateStopsLoopsAtTheDeadline(t *testing.T) {
+	elements := make([]interface{}, 50000)
+	candidates := make([]interface{}, 50000)
+	for i := range elements {
+		elements[i] = float64(i)
+		candidates[i] = float64(-i - 1)
+	}
+	program, err := Compile(parse(t, "any a in b"))
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	_, err = program.Evaluate(ctx, map[string]interface{}{"a": elements, "b": candidates})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(started), time.Second, "the loop should stop at the deadline")
+}
+
+var upper = &parser.Function{
+	Name:       "upper",
+	Parameters: []parser.Type{parser.TypeString},
+	Returns:    parser.TypeString,
+	Call: func(args ...interface{}) (interface{}, error) {
+		return strings.ToUpper(args[0].(string)), nil
+	},
+}
+
+// parse parses the definition, binding calls to upper.
+func parse(t *testing.T, definition string) parser.Node {
+	node := parseUnbound(t, definition)
+	parser.Walk(node, func(n parser.Node) {
+		if call, isCall := n.(*parser.Call); isCall && call.Name == upper.Name {
+			call.Function = upper
+		}
+	})
+	return node
+}
+
+func parseUnbound(t *testing.T, definition string) parser.Node {
+	node, err := parser.Parse(definition)
+	assert.NoError(t, err)
+	return node
+}
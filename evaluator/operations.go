@@ -0,0 +1,271 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// operation computes an operator other than a connective from its evaluated
+// left and right sides. The ones that loop over both sides stop with the
+// context error once ctx is done.
+type operation func(ctx context.Context, left, right interface{}) (interface{}, error)
+
+var operations = map[parser.Operator]operation{
+	parser.OpEq: func(_ context.Context, left, right interface{}) (interface{}, error) {
+		return Equal(left, right), nil
+	},
+	parser.OpNeq: func(_ context.Context, left, right interface{}) (interface{}, error) {
+		return !Equal(left, right), nil
+	},
+	parser.OpLt:  ordering(parser.OpLt, func(c int) bool { return c < 0 }),
+	parser.OpLte: ordering(parser.OpLte, func(c int) bool { return c <= 0 }),
+	parser.OpGt:  ordering(parser.OpGt, func(c int) bool { return c > 0 }),
+	parser.OpGte: ordering(parser.OpGte, func(c int) bool { return c >= 0 }),
+	parser.OpAdd: func(_ context.Context, left, right interface{}) (interface{}, error) {
+		if l, isString := left.(string); isString {
+			if r, isString := right.(string); isString {
+				return l + r, nil
+			}
+		}
+		return arithmetic(parser.OpAdd, left, right, func(l, r float64) (float64, error) { return l + r, nil })
+	},
+	parser.OpSub: func(_ context.Context, left, right interface{}) (interface{}, error) {
+		return arithmetic(parser.OpSub, left, right, func(l, r float64) (float64, error) { return l - r, nil })
+	},
+	parser.OpMul: func(_ context.Context, left, right interface{}) (interface{}, error) {
+		return arithmetic(parser.OpMul, left, right, func(l, r float64) (float64, error) { return l * r, nil })
+	},
+	parser.OpDiv: func(_ context.Context, left, right interface{}) (interface{}, error) {
+		return arithmetic(parser.OpDiv, left, right, func(l, r float64) (float64, error) {
+			if r == 0 {
+				return 0, errDivisionByZero
+			}
+			return l / r, nil
+		})
+	},
+	parser.OpMod: func(_ context.Context, left, right interface{}) (interface{}, error) {
+		return arithmetic(parser.OpMod, left, right, func(l, r float64) (float64, error) {
+			if r == 0 {
+				return 0, errDivisionByZero
+			}
+			return math.Mod(l, r), nil
+		})
+	},
+	parser.OpIn: func(_ context.Context, left, right interface{}) (interface{}, error) {
+		list, err := asList(parser.OpIn, "right", right)
+		if err != nil {
+			return nil, err
+		}
+		return hasElement(list, left), nil
+	},
+	parser.OpContains: func(_ context.Context, left, right interface{}) (interface{}, error) {
+		list, err := asList(parser.OpContains, "left", left)
+		if err != nil {
+			return nil, err
+		}
+		return hasElement(list, right), nil
+	},
+	parser.OpAnyIn: func(ctx context.Context, left, right interface{}) (interface{}, error) {
+		elements, candidates, err := asLists(parser.OpAnyIn, left, right)
+		if err != nil {
+			return nil, err
+		}
+		for _, element := range elements {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if hasElement(candidates, element) {
+				return true, nil
+			}
+		}
+		return false, nil
+	},
+	parser.OpAllIn: func(ctx context.Context, left, right interface{}) (interface{}, error) {
+		elements, candidates, err := asLists(parser.OpAllIn, left, right)
+		if err != nil {
+			return nil, err
+		}
+		for _, element := range elements {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if !hasElement(candidates, element) {
+				return false, nil
+			}
+		}
+		return true, nil
+	},
+	parser.OpMatches: match,
+}
+
+var errDivisionByZero = errors.New("division by zero")
+
+// TypeOf returns the type of a value of the rule language, or TypeAny for
+// values it has no type for.
+func TypeOf(value interface{}) parser.Type {
+	switch value.(type) {
+	case bool:
+		return parser.TypeBoolean
+	case float64:
+		return parser.TypeNumber
+	case string:
+		return parser.TypeString
+	case []interface{}:
+		return parser.TypeList
+	default:
+		return parser.TypeAny
+	}
+}
+
+// Equal compares values the way == does in definitions: values of different
+// types are never equal, and lists and objects are compared element by
+// element instead of panicking.
+func Equal(a, b interface{}) bool {
+	switch a.(type) {
+	case bool, float64, string:
+		return a == b
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+// ordering compares two numbers, or two strings alphabetically.
+func ordering(operator parser.Operator, holds func(comparison int) bool) operation {
+	return func(_ context.Context, left, right interface{}) (interface{}, error) {
+		switch l := left.(type) {
+		case float64:
+			if r, isNumber := right.(float64); isNumber {
+				return holds(compareNumbers(l, r)), nil
+			}
+		case string:
+			if r, isString := right.(string); isString {
+				return holds(strings.Compare(l, r)), nil
+			}
+		}
+		return nil, fmt.Errorf("%s compares two numbers or two strings, got %v and %v", operator, left, right)
+	}
+}
+
+func compareNumbers(l, r float64) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func arithmetic(operator parser.Operator, left, right interface{}, apply func(l, r float64) (float64, error)) (interface{}, error) {
+	l, isNumber := left.(float64)
+	if !isNumber {
+		return nil, fmt.Errorf("left side of %s must be a number, got %v", operator, left)
+	}
+	r, isNumber := right.(float64)
+	if !isNumber {
+		return nil, fmt.Errorf("right side of %s must be a number, got %v", operator, right)
+	}
+	return apply(l, r)
+}
+
+func asList(operator parser.Operator, side string, value interface{}) ([]interface{}, error) {
+	list, isList := value.([]interface{})
+	if !isList {
+		return nil, fmt.Errorf("%s side of %s must be a list, got %v", side, operator, value)
+	}
+	return list, nil
+}
+
+func asLists(operator parser.Operator, left, right interface{}) ([]interface{}, []interface{}, error) {
+	elements, err := asList(operator, "left", left)
+	if err != nil {
+		return nil, nil, err
+	}
+	candidates, err := asList(operator, "right", right)
+	if err != nil {
+		return nil, nil, err
+	}
+	return elements, candidates, nil
+}
+
+func hasElement(list []interface{}, value interface{}) bool {
+	for _, element := range list {
+		if Equal(element, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// match implements MATCHES. The pattern is a regular expression literal
+// compiled with the definition or, when it comes from a variable, a string
+// compiled through the pattern cache, unless ctx is already done. Matching
+// itself runs in time linear in the text and is not interrupted.
+func match(ctx context.Context, value, pattern interface{}) (interface{}, error) {
+	text, isString := value.(string)
+	if !isString {
+		return nil, fmt.Errorf("MATCHES expects a string, got %v", value)
+	}
+
+	compiled, isCompiled := pattern.(*regexp.Regexp)
+	if !isCompiled {
+		source, isString := pattern.(string)
+		if !isString {
+			return nil, fmt.Errorf("MATCHES expects a string pattern, got %v", pattern)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var err error
+		if compiled, err = Pattern(source); err != nil {
+			return nil, err
+		}
+	}
+	return compiled.MatchString(text), nil
+}
+
+// maxPatterns bounds the regular expressions kept compiled by Pattern.
+const maxPatterns = 256
+
+var patterns = &patternCache{compiled: make(map[string]*regexp.Regexp)}
+
+// Pattern compiles a regular expression given as a value rather than written
+// in the definition, reusing the result for the same pattern.
+func Pattern(source string) (*regexp.Regexp, error) {
+	return patterns.compile(source)
+}
+
+// patternCache keeps compiled regular expressions so patterns coming from
+// values are not compiled on every evaluation. When full it is emptied rather
+// than tracking usage, since the same few patterns are almost always used.
+type patternCache struct {
+	mu       sync.Mutex
+	compiled map[string]*regexp.Regexp
+}
+
+func (c *patternCache) compile(pattern string) (*regexp.Regexp, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if compiled, exists := c.compiled[pattern]; exists {
+		return compiled, nil
+	}
+
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.compiled) >= maxPatterns {
+		c.compiled = make(map[string]*regexp.Regexp)
+	}
+	c.compiled[pattern] = compiled
+	return compiled, nil
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/logging"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/service"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"net/http"
+	"strconv"
+)
+
+const formatDOT = "dot"
+
+// GetDependencyGraph returns which expressions reference which and the
+// variables they use, as JSON or Graphviz DOT. With ?expressionId= only the
+// expressions connected to that one are kept.
+func (eh *ExpressionHandler) GetDependencyGraph(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+
+	format, ok := responseFormat(r, formatDOT, "text/vnd.graphviz")
+	if !ok {
+		writeError(w, http.StatusBadRequest, util.CodeValidationFailed, util.ErrInvalidQuery,
+			model.ErrorDetail{Field: "format", Message: "must be one of json or dot"})
+		logger.WithField("format", r.URL.Query().Get("format")).Error("unsupported dependency graph format")
+		return
+	}
+
+	expressionId := 0
+	if value := r.URL.Query().Get("expressionId"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, util.CodeInvalidExpressionId, util.ErrParsingExpressionId)
+			logger.WithField("err", err.Error()).Error("error parsing expressionId to int")
+			return
+		}
+		expressionId = id
+	}
+
+	expressions, err := eh.ExpressionRepository.GetAllExpressions(ctx)
+	if err != nil {
+		writeErrorFor(w, err)
+		logger.WithField("err", err.Error()).Error("error recovering expression from database")
+		return
+	}
+
+	graph := eh.ExpressionService.DependencyGraph(ctx, expressions)
+	if expressionId != 0 {
+		subgraph, exists := service.DependencySubgraph(graph, expressionId)
+		if !exists {
+			writeError(w, http.StatusNotFound, util.CodeExpressionNotFound, util.ErrExpressionNotFound)
+			logger.WithField(logging.FieldExpressionId, expressionId).Error("expression not in dependency graph")
+			return
+		}
+		graph = subgraph
+	}
+
+	if format == formatDOT {
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		err = writeDependencyGraphDOT(w, graph)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(graph)
+	}
+	if err != nil {
+		logger.WithField("err", err.Error()).Error("error encoding response")
+	}
+}
+
+// writeDependencyGraphDOT draws expressions as boxes and variables as
+// ellipses, with an arrow from each expression to what it uses. Unresolved
+// references are drawn as dashed boxes.
+func writeDependencyGraphDOT(w http.ResponseWriter, graph model.DependencyGraph) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "digraph dependencies {")
+	fmt.Fprintln(out, "\trankdir=LR;")
+
+	variables := make(map[string]bool)
+	for _, node := range graph.Expressions {
+		label := "@" + strconv.Itoa(node.ID)
+		if node.Name != "" {
+			label = "@" + node.Name + " (" + strconv.Itoa(node.ID) + ")"
+		}
+		attributes := "shape=box"
+		if node.Error != "" {
+			attributes += ", color=red"
+		}
+		fmt.Fprintf(out, "\t%s [label=%s, %s];\n", expressionNodeId(node.ID), strconv.Quote(label), attributes)
+
+		for _, id := range node.References {
+			fmt.Fprintf(out, "\t%s -> %s;\n", expressionNodeId(node.ID), expressionNodeId(id))
+		}
+		for _, target := range node.UnresolvedReferences {
+			fmt.Fprintf(out, "\t%s [label=%s, shape=box, style=dashed];\n", strconv.Quote("unresolved "+target), strconv.Quote("@"+target))
+			fmt.Fprintf(out, "\t%s -> %s [style=dashed];\n", expressionNodeId(node.ID), strconv.Quote("unresolved "+target))
+		}
+		for _, variable := range node.Variables {
+			if !variables[variable] {
+				variables[variable] = true
+				fmt.Fprintf(out, "\t%s [label=%s, shape=ellipse];\n", strconv.Quote("variable "+variable), strconv.Quote(variable))
+			}
+			fmt.Fprintf(out, "\t%s -> %s;\n", expressionNodeId(node.ID), strconv.Quote("variable "+variable))
+		}
+	}
+
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+func expressionNodeId(id int) string {
+	return strconv.Quote("expression " + strconv.Itoa(id))
+}
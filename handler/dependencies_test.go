@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/service"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetDependencyGraph(t *testing.T) {
+	expressions := []model.Expression{
+		{ID: 1, Name: "isActive", Definition: "active"},
+		{ID: 2, Definition: "@isActive and premium or @gone"},
+		{ID: 3, Definition: "unrelated"},
+	}
+
+	testCases := []struct {
+		name         string
+		databaseMock repository.Stub
+		query        string
+		httpStatus   int
+		contentType  string
+		expectedBody string
+	}{
+		{
+			name:         "should return 200 with json by default",
+			databaseMock: repository.Stub{GetAllExpressionsResponse: expressions},
+			query:        "?expressionId=1",
+			httpStatus:   http.StatusOK,
+			contentType:  "application/json",
+			expectedBody: `{"expressions":[` +
+				`{"id":1,"name":"isActive","references":[],"dependents":[2],"variables":["active"]},` +
+				`{"id":2,"references":[1],"dependents":[],"variables":["premium"],"unresolvedReferences":["gone"]}]}` + "\n",
+		},
+		{
+			name:         "should return 200 with dot",
+			databaseMock: repository.Stub{GetAllExpressionsResponse: expressions},
+			query:        "?format=dot&expressionId=1",
+			httpStatus:   http.StatusOK,
+			contentType:  "text/vnd.graphviz; charset=utf-8",
+			expectedBody: "digraph dependencies {\n" +
+				"\trankdir=LR;\n" +
+				"\t\"expression 1\" [label=\"@isActive (1)\", shape=box];\n" +
+				"\t\"variable active\" [label=\"active\", shape=ellipse];\n" +
+				"\t\"expression 1\" -> \"variable active\";\n" +
+				"\t\"expression 2\" [label=\"@2\", shape=box];\n" +
+				"\t\"expression 2\" -> \"expression 1\";\n" +
+				"\t\"unresolved gone\" [label=\"@gone\", shape=box, style=dashed];\n" +
+				"\t\"expression 2\" -> \"unresolved gone\" [style=dashed];\n" +
+				"\t\"variable premium\" [label=\"premium\", shape=ellipse];\n" +
+				"\t\"expression 2\" -> \"variable premium\";\n" +
+				"}\n",
+		},
+		{
+			name:         "should return 400, unsupported format",
+			databaseMock: repository.Stub{},
+			query:        "?format=svg",
+			httpStatus:   http.StatusBadRequest,
+			contentType:  "application/json",
+		},
+		{
+			name:         "should return 404, expression not in graph",
+			databaseMock: repository.Stub{GetAllExpressionsResponse: expressions},
+			query:        "?expressionId=42",
+			httpStatus:   http.StatusNotFound,
+			contentType:  "application/json",
+		},
+		{
+			name:         "should return 500, listing fails",
+			databaseMock: repository.Stub{GetAllExpressionsError: repository.ErrQueryFailed},
+			httpStatus:   http.StatusInternalServerError,
+			contentType:  "application/json",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := ExpressionHandler{
+				ExpressionService:    service.ExpressionService{},
+				ExpressionRepository: &tc.databaseMock,
+			}
+
+			r := chi.NewRouter()
+			r.Get("/dependencies", handler.GetDependencyGraph)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			response, _ := http.Get(ts.URL + "/dependencies" + tc.query)
+			body, _ := ioutil.ReadAll(response.Body)
+
+			assert.Equal(t, tc.httpStatus, response.StatusCode)
+			assert.Equal(t, tc.contentType, response.Header.Get("Content-Type"))
+			if tc.expectedBody != "" {
+				assert.Equal(t, tc.expectedBody, string(body))
+			}
+		})
+	}
+}
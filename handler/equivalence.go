@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/logging"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"net/http"
+)
+
+const operandMessage = "must be an object with either an expressionId or a definition"
+
+const operandDialectMessage = "dialect only applies to a definition, and " + dialectMessage
+
+// equivalenceOperand is one side of an equivalence request: a stored
+// expression or an inline definition, written in Dialect.
+type equivalenceOperand struct {
+	ExpressionId *int          `json:"expressionId"`
+	Definition   *string       `json:"definition"`
+	Dialect      model.Dialect `json:"dialect"`
+}
+
+func (eh *ExpressionHandler) CompareExpressions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+
+	b, ok := eh.readBody(w, r, logger)
+	if !ok {
+		return
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(b, &body); err != nil {
+		logger.WithField("err", err.Error()).Error("Error on unmarshal payload")
+		writeError(w, http.StatusBadRequest, util.CodeInvalidBody, util.ErrInvalidBody)
+		return
+	}
+
+	var operands [2]equivalenceOperand
+	var details []model.ErrorDetail
+	for i, field := range []string{"left", "right"} {
+		raw, exists := body[field]
+		if !exists {
+			details = append(details, model.ErrorDetail{Field: field, Message: "is required"})
+			continue
+		}
+		err := json.Unmarshal(raw, &operands[i])
+		if err != nil || (operands[i].ExpressionId == nil) == (operands[i].Definition == nil) ||
+			(operands[i].Definition != nil && *operands[i].Definition == "") {
+			details = append(details, model.ErrorDetail{Field: field, Message: operandMessage})
+			continue
+		}
+		if operands[i].Dialect != "" && (operands[i].Definition == nil || !operands[i].Dialect.IsValid()) {
+			details = append(details, model.ErrorDetail{Field: field + ".dialect", Message: operandDialectMessage})
+		}
+	}
+	if len(details) > 0 {
+		logger.WithField("details", details).Error("invalid equivalence request")
+		writeError(w, http.StatusBadRequest, util.CodeValidationFailed, util.ErrInvalidFields, details...)
+		return
+	}
+
+	left, err := eh.resolveOperand(ctx, operands[0])
+	if err != nil {
+		writeErrorFor(w, err)
+		logger.WithField("err", err.Error()).Error("error recovering expression from database")
+		return
+	}
+	right, err := eh.resolveOperand(ctx, operands[1])
+	if err != nil {
+		writeErrorFor(w, err)
+		logger.WithField("err", err.Error()).Error("error recovering expression from database")
+		return
+	}
+
+	equivalence, err := eh.ExpressionService.Equivalent(ctx, left, right)
+	if err != nil {
+		writeErrorFor(w, err)
+		logger.WithField("err", err.Error()).Error("error comparing expressions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(equivalence); err != nil {
+		writeError(w, http.StatusInternalServerError, util.CodeInternal, util.ErrEncodingResponse)
+		logger.WithField("err", err.Error()).Error("error encoding response")
+		return
+	}
+
+	logger.WithFields(log.Fields{
+		"left":       left.Definition,
+		"right":      right.Definition,
+		"equivalent": equivalence.Equivalent,
+	}).Info("expressions compared successfully")
+}
+
+func (eh *ExpressionHandler) resolveOperand(ctx context.Context, operand equivalenceOperand) (model.Expression, error) {
+	if operand.Definition != nil {
+		return model.Expression{Definition: *operand.Definition, Dialect: operand.Dialect}, nil
+	}
+	return eh.ExpressionRepository.GetExpressionById(ctx, *operand.ExpressionId)
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompareExpressions(t *testing.T) {
+	testCases := []struct {
+		name         string
+		databaseMock repository.Stub
+		body         string
+		httpStatus   int
+		expectedBody model.Equivalence
+	}{
+		{
+			name:         "should return 200 comparing definitions",
+			databaseMock: repository.Stub{},
+			body:         `{"left": {"definition": "a xor b"}, "right": {"definition": "(a or b) and not (a and b)"}}`,
+			httpStatus:   http.StatusOK,
+			expectedBody: model.Equivalence{Equivalent: true},
+		},
+		{
+			name: "should return 200 comparing a stored expression with a definition",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: "a and b"},
+			},
+			body:       `{"left": {"expressionId": 10}, "right": {"definition": "a"}}`,
+			httpStatus: http.StatusOK,
+			expectedBody: model.Equivalence{
+				Counterexample: &model.Counterexample{Values: map[string]bool{"a": true, "b": false}, Left: false, Right: true},
+			},
+		},
+		{
+			name:         "should return 400, operand with both fields",
+			databaseMock: repository.Stub{},
+			body:         `{"left": {"expressionId": 10, "definition": "a"}, "right": {"definition": "a"}}`,
+			httpStatus:   http.StatusBadRequest,
+		},
+		{
+			name:         "should return 200 comparing definitions in other dialects",
+			databaseMock: repository.Stub{},
+			body:         `{"left": {"definition": "a && !b", "dialect": "cel"}, "right": {"definition": "not (not a or b)"}}`,
+			httpStatus:   http.StatusOK,
+			expectedBody: model.Equivalence{Equivalent: true},
+		},
+		{
+			name:         "should return 400, unknown dialect",
+			databaseMock: repository.Stub{},
+			body:         `{"left": {"definition": "a", "dialect": "sql"}, "right": {"definition": "a"}}`,
+			httpStatus:   http.StatusBadRequest,
+		},
+		{
+			name:         "should return 400, dialect of a stored expression",
+			databaseMock: repository.Stub{},
+			body:         `{"left": {"expressionId": 10, "dialect": "cel"}, "right": {"definition": "a"}}`,
+			httpStatus:   http.StatusBadRequest,
+		},
+		{
+			name:         "should return 422, dialect without a syntax tree",
+			databaseMock: repository.Stub{},
+			body:         `{"left": {"definition": "a && b", "dialect": "govaluate"}, "right": {"definition": "a"}}`,
+			httpStatus:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "should return 400, missing operand",
+			databaseMock: repository.Stub{},
+			body:         `{"left": {"definition": "a"}}`,
+			httpStatus:   http.StatusBadRequest,
+		},
+		{
+			name: "should return 404, expression not found",
+			databaseMock: repository.Stub{
+				GetExpressionByIdError: repository.ErrExpressionNotFound,
+			},
+			body:       `{"left": {"expressionId": 10}, "right": {"definition": "a"}}`,
+			httpStatus: http.StatusNotFound,
+		},
+		{
+			name:         "should return 422, invalid definition",
+			databaseMock: repository.Stub{},
+			body:         `{"left": {"definition": "a and"}, "right": {"definition": "a"}}`,
+			httpStatus:   http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := ExpressionHandler{
+				ExpressionService:    service.ExpressionService{},
+				ExpressionRepository: &tc.databaseMock,
+			}
+
+			r := chi.NewRouter()
+			r.Post("/equivalence", handler.CompareExpressions)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			response, _ := http.Post(ts.URL+"/equivalence", "application/json", strings.NewReader(tc.body))
+
+			var parsedResponse model.Equivalence
+			_ = json.NewDecoder(response.Body).Decode(&parsedResponse)
+
+			assert.Equal(t, tc.httpStatus, response.StatusCode)
+			assert.Equal(t, tc.expectedBody, parsedResponse)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/service"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"net/http"
+	"strconv"
+)
+
+// StatusClientClosedRequest is the non-standard status used by nginx for
+// requests the client abandoned before a response was written.
+const StatusClientClosedRequest = 499
+
+type errorMapping struct {
+	err     error
+	status  int
+	code    string
+	message string
+}
+
+// errorMappings lists the errors the repository and service layers return on
+// purpose, in the order they are matched with errors.Is.
+var errorMappings = []errorMapping{
+	{context.Canceled, StatusClientClosedRequest, util.CodeRequestCancelled, util.ErrRequestCancelled},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, util.CodeRequestTimeout, util.ErrRequestTimeout},
+	{repository.ErrExpressionNotFound, http.StatusNotFound, util.CodeExpressionNotFound, util.ErrExpressionNotFound},
+	{repository.ErrNameTaken, http.StatusConflict, util.CodeNameConflict, util.ErrExpressionNameTaken},
+	{repository.ErrHasDependents, http.StatusConflict, util.CodeHasDependents, util.ErrHasDependents},
+	{repository.ErrNameReferenced, http.StatusConflict, util.CodeNameReferenced, util.ErrNameReferenced},
+	{repository.ErrVersionConflict, http.StatusConflict, util.CodeVersionConflict, util.ErrVersionConflict},
+	{repository.ErrReferenceNotFound, http.StatusUnprocessableEntity, util.CodeUnknownReference, util.ErrUnknownReference},
+	{repository.ErrQueryFailed, http.StatusInternalServerError, util.CodeDatabaseError, util.ErrExecutingQuery},
+	{service.ErrCreatingEvaluableExpression, http.StatusUnprocessableEntity, util.CodeInvalidExpression, util.ErrCreatingEvaluableExpression},
+	{service.ErrUnknownReference, http.StatusUnprocessableEntity, util.CodeUnknownReference, util.ErrUnknownReference},
+	{service.ErrReferenceCycle, http.StatusUnprocessableEntity, util.CodeReferenceCycle, util.ErrReferenceCycle},
+	{service.ErrUnknownFunction, http.StatusUnprocessableEntity, util.CodeUnknownFunction, util.ErrUnknownFunction},
+	{service.ErrInvalidArguments, http.StatusUnprocessableEntity, util.CodeInvalidArguments, util.ErrInvalidArguments},
+	{service.ErrDefinitionTooLong, http.StatusUnprocessableEntity, util.CodeDefinitionTooLong, util.ErrDefinitionTooLong},
+	{service.ErrExpressionTooDeep, http.StatusUnprocessableEntity, util.CodeExpressionTooDeep, util.ErrExpressionTooDeep},
+	{service.ErrExpressionTooLarge, http.StatusUnprocessableEntity, util.CodeExpressionTooLarge, util.ErrExpressionTooLarge},
+	{service.ErrTooManyVariables, http.StatusUnprocessableEntity, util.CodeTooManyVariables, util.ErrTooManyVariables},
+	{service.ErrEvaluationTimeout, http.StatusUnprocessableEntity, util.CodeEvaluationTimeout, util.ErrEvaluationTimeout},
+	{service.ErrValuesTooLarge, http.StatusUnprocessableEntity, util.CodeValuesTooLarge, util.ErrValuesTooLarge},
+	{service.ErrUnsupportedDialect, http.StatusUnprocessableEntity, util.CodeUnsupportedDialect, util.ErrUnsupportedDialect},
+	{service.ErrNotBooleanVariables, http.StatusUnprocessableEntity, util.CodeNotBooleanVariables, util.ErrNotBooleanVariables},
+	{service.ErrTruthTableTooLarge, http.StatusUnprocessableEntity, util.CodeTruthTableTooLarge, util.ErrTruthTableTooLarge},
+	{service.ErrAnalysisTooLarge, http.StatusUnprocessableEntity, util.CodeAnalysisTooLarge, util.ErrAnalysisTooLarge},
+	{service.ErrSimplifyingReferences, http.StatusUnprocessableEntity, util.CodeHasReferences, util.ErrSimplifyingReferences},
+	{service.ErrMissingPath, http.StatusUnprocessableEntity, util.CodeMissingPath, util.ErrMissingPath},
+	{service.ErrEvaluatingExpression, http.StatusUnprocessableEntity, util.CodeEvaluationFailed, util.ErrEvaluatingExpression},
+}
+
+// writeError writes the JSON error envelope shared by every endpoint.
+func writeError(w http.ResponseWriter, status int, code, message string, details ...model.ErrorDetail) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(model.ErrorResponse{
+		Error: model.Error{
+			Code:    code,
+			Message: message,
+			Details: details,
+		},
+	})
+}
+
+// writeErrorFor writes the envelope matching an error returned by the
+// repository or service layer. Unknown errors are reported as internal errors
+// so driver details never reach the client.
+func writeErrorFor(w http.ResponseWriter, err error) {
+	for _, mapping := range errorMappings {
+		if errors.Is(err, mapping.err) {
+			writeError(w, mapping.status, mapping.code, mapping.message, errorDetails(err)...)
+			return
+		}
+	}
+
+	writeError(w, http.StatusInternalServerError, util.CodeInternal, util.ErrInternal)
+}
+
+// errorDetails describes the errors that say which part of the input failed.
+func errorDetails(err error) []model.ErrorDetail {
+	var pathError *service.PathError
+	if errors.As(err, &pathError) {
+		return []model.ErrorDetail{{Field: pathError.Path, Message: pathError.Reason}}
+	}
+	var dialectError *service.DialectError
+	if errors.As(err, &dialectError) {
+		return []model.ErrorDetail{{Field: "dialect", Message: dialectError.Reason()}}
+	}
+	var dependentsError *repository.DependentsError
+	if errors.As(err, &dependentsError) {
+		details := make([]model.ErrorDetail, len(dependentsError.Dependents))
+		for i, id := range dependentsError.Dependents {
+			details[i] = model.ErrorDetail{Field: "dependents", Message: "referenced by expression " + strconv.Itoa(id)}
+		}
+		return details
+	}
+	return nil
+}
+
+// NotFound and MethodNotAllowed replace the router defaults so unmatched
+// requests get the same envelope as handler errors.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, util.CodeRouteNotFound, util.ErrRouteNotFound)
+}
+
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusMethodNotAllowed, util.CodeMethodNotAllowed, util.ErrMethodNotAllowed)
+}
@@ -4,48 +4,80 @@ import (
 	"encoding/json"
 	"github.com/go-chi/chi"
 	log "github.com/sirupsen/logrus"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/logging"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
 	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
 	"github.com/viclisboa/regularExpressionEvaluatorAPI/service"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
 	"io/ioutil"
 	"net/http"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 )
 
+// DefaultMaxBodyBytes caps request bodies when ExpressionHandler is not
+// configured otherwise.
+const DefaultMaxBodyBytes = 1 << 20
+
 type ExpressionHandler struct {
 	ExpressionService    service.ExpressionService
 	ExpressionRepository repository.ExpressionInterface
-	Logger               log.Logger
+	// MaxBodyBytes caps request bodies. Zero means DefaultMaxBodyBytes.
+	MaxBodyBytes int64
 }
 
+// EvaluateExpression evaluates a stored expression. GET takes the values in
+// the query string; POST takes them typed, as JSON, in the body.
 func (eh *ExpressionHandler) EvaluateExpression(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := GetURLParams(r)
 	expressionId := params["expressionId"]
-	logger := eh.Logger.WithField("expressionId", expressionId)
+	ctx, logger := logging.WithFields(r.Context(), log.Fields{logging.FieldExpressionId: expressionId})
 
 	expressionIdAsInt, err := strconv.Atoi(expressionId)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, util.CodeInvalidExpressionId, util.ErrParsingExpressionId)
 		logger.WithField("err", err.Error()).Error("error parsing expressionId to int")
 		return
 	}
 
-	expression, err := eh.ExpressionRepository.GetExpressionById(expressionIdAsInt)
+	expression, err := eh.ExpressionRepository.GetExpressionById(ctx, expressionIdAsInt)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeErrorFor(w, err)
 		logger.WithField("err", err.Error()).Error("error recovering expression from database")
 		return
 	}
 
-	result, err := eh.ExpressionService.ExecuteExpression(expression, r.URL.RawQuery)
+	values, options, details := parseEvaluationQuery(r.URL.RawQuery)
+	if r.Method == http.MethodPost && values != "" {
+		details = append(details, model.ErrorDetail{Field: "values", Message: "must be sent in the body"})
+	}
+	if len(details) > 0 {
+		writeError(w, http.StatusBadRequest, util.CodeValidationFailed, util.ErrInvalidQuery, details...)
+		logger.WithField("details", details).Error("error parsing evaluation options")
+		return
+	}
+
+	var result model.Response
+	if r.Method == http.MethodPost {
+		body, ok := eh.readEvaluationBody(w, r, logger)
+		if !ok {
+			return
+		}
+		result, err = eh.ExpressionService.ExecuteExpressionWithValues(ctx, expression, body, options)
+	} else {
+		result, err = eh.ExpressionService.ExecuteExpression(ctx, expression, values, options)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeErrorFor(w, err)
 		logger.WithField("err", err.Error()).Error("error resolving expression")
 		return
 	}
 
 	if err := json.NewEncoder(w).Encode(result); err != nil {
-		http.Error(w, "Error on marshal ", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, util.CodeInternal, util.ErrEncodingResponse)
 		logger.WithField("err", err.Error()).Error("error encoding response")
 		return
 	}
@@ -55,123 +87,415 @@ func (eh *ExpressionHandler) SaveExpression(w http.ResponseWriter, r *http.Reque
 	params := GetURLParams(r)
 	expressionId := params["expressionId"]
 
-	logger := eh.Logger.WithField("expressionId", expressionId)
+	ctx, logger := logging.WithFields(r.Context(), log.Fields{logging.FieldExpressionId: expressionId})
 
 	expressionIdAsInt, err := strconv.Atoi(expressionId)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, util.CodeInvalidExpressionId, util.ErrParsingExpressionId)
 		logger.WithField("err", err.Error()).Error("error parsing expressionId to int")
 		return
 	}
 
-	b, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		logger.WithField("err", err.Error()).Error("Error on get body data for expression update")
-		http.Error(w, "Error on get body data for expression update", http.StatusInternalServerError)
+	update, ok := eh.readExpression(w, r, logger)
+	if !ok {
 		return
 	}
+	update.ID = expressionIdAsInt
 
-	var body map[string]any
-	err = json.Unmarshal(b, &body)
+	response, err := eh.ExpressionService.SaveExpression(ctx, update)
 	if err != nil {
-		logger.WithField("err", err.Error()).Error("Error on unmarshal  payload for update")
-		http.Error(w, "Error on unmarshal landing page payload for creation", http.StatusInternalServerError)
+		logger.WithField("err", err.Error()).Error("Error updating expression")
+		writeErrorFor(w, err)
 		return
 	}
 
-	definition, exists := body["definition"]
-	if definition == "" || !exists {
-		logger.WithField("body", body).Error("missing definition on body")
-		http.Error(w, "missing definition in body", http.StatusBadRequest)
+	writeSaveResponse(w, logger, response)
+	logger.Info("expression updated successfully")
+}
+
+func (eh *ExpressionHandler) CreateExpression(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	update, ok := eh.readExpression(w, r, logger)
+	if !ok {
 		return
 	}
 
-	definitionAsString := definition.(string)
+	response, err := eh.ExpressionService.CreateExpression(r.Context(), update.Apply(model.Expression{}))
+	if err != nil {
+		logger.WithField("err", err.Error()).Error("Error creating expression")
+		writeErrorFor(w, err)
+		return
+	}
+
+	writeSaveResponse(w, logger, response)
+	logger.Info("expression created successfully")
+}
+
+func writeSaveResponse(w http.ResponseWriter, logger *log.Entry, response model.SaveResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.WithField("err", err.Error()).Error("error encoding response")
+	}
+}
 
-	err = eh.ExpressionRepository.SaveExpression(expressionIdAsInt, definitionAsString)
+func (eh *ExpressionHandler) GetAllExpressions(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	expressions, err := eh.ExpressionRepository.GetAllExpressions(r.Context())
 	if err != nil {
-		logger.WithField("err", err.Error()).Error("Error updating expressiong")
-		http.Error(w, "Error updating expression", http.StatusInternalServerError)
+		writeErrorFor(w, err)
+		logger.WithField("err", err.Error()).Error("error recovering expression from database")
 		return
 	}
 
-	logger.Info("expression updated successfully")
+	for i := range expressions {
+		variables, err := eh.ExpressionService.Variables(r.Context(), expressions[i])
+		if err != nil {
+			logger.WithFields(log.Fields{
+				logging.FieldExpressionId: expressions[i].ID,
+				"err":                     err.Error(),
+			}).Warn("skipping variables of invalid expression")
+			continue
+		}
+		expressions[i].Variables = variables
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(expressions); err != nil {
+		writeError(w, http.StatusInternalServerError, util.CodeInternal, util.ErrEncodingResponse)
+		logger.WithField("err", err.Error()).Error("error encoding response")
+		return
+	}
+
+	logger.Info("all expressions recovered successfully")
 }
 
-func (eh *ExpressionHandler) CreateExpression(w http.ResponseWriter, r *http.Request) {
+func (eh *ExpressionHandler) GetExpressionVariables(w http.ResponseWriter, r *http.Request) {
+	params := GetURLParams(r)
+	expressionId := params["expressionId"]
+
+	ctx, logger := logging.WithFields(r.Context(), log.Fields{logging.FieldExpressionId: expressionId})
 
-	b, err := ioutil.ReadAll(r.Body)
+	expressionIdAsInt, err := strconv.Atoi(expressionId)
 	if err != nil {
-		eh.Logger.WithField("err", err.Error()).Error("Error on get body data for expression update")
-		http.Error(w, "Error on get body data for expression update", http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, util.CodeInvalidExpressionId, util.ErrParsingExpressionId)
+		logger.WithField("err", err.Error()).Error("error parsing expressionId to int")
 		return
 	}
 
-	var body map[string]any
-	err = json.Unmarshal(b, &body)
+	expression, err := eh.ExpressionRepository.GetExpressionById(ctx, expressionIdAsInt)
+	if err != nil {
+		writeErrorFor(w, err)
+		logger.WithField("err", err.Error()).Error("error recovering expression from database")
+		return
+	}
+
+	variables, err := eh.ExpressionService.Variables(ctx, expression)
+	if err != nil {
+		writeErrorFor(w, err)
+		logger.WithField("err", err.Error()).Error("error listing expression variables")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(model.VariablesResponse{ExpressionId: expression.ID, Variables: variables}); err != nil {
+		writeError(w, http.StatusInternalServerError, util.CodeInternal, util.ErrEncodingResponse)
+		logger.WithField("err", err.Error()).Error("error encoding response")
+		return
+	}
+}
+
+func (eh *ExpressionHandler) GetExpressionAnalysis(w http.ResponseWriter, r *http.Request) {
+	params := GetURLParams(r)
+	expressionId := params["expressionId"]
+
+	ctx, logger := logging.WithFields(r.Context(), log.Fields{logging.FieldExpressionId: expressionId})
+
+	expressionIdAsInt, err := strconv.Atoi(expressionId)
 	if err != nil {
-		eh.Logger.WithField("err", err.Error()).Error("Error on unmarshal  payload for update")
-		http.Error(w, "Error on unmarshal landing page payload for creation", http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, util.CodeInvalidExpressionId, util.ErrParsingExpressionId)
+		logger.WithField("err", err.Error()).Error("error parsing expressionId to int")
 		return
 	}
 
-	definition, exists := body["definition"].(string)
-	if definition == "" || !exists {
-		eh.Logger.WithField("body", body).Error("missing definition on body")
-		http.Error(w, "missing definition in body", http.StatusBadRequest)
+	expression, err := eh.ExpressionRepository.GetExpressionById(ctx, expressionIdAsInt)
+	if err != nil {
+		writeErrorFor(w, err)
+		logger.WithField("err", err.Error()).Error("error recovering expression from database")
 		return
 	}
 
-	err = eh.ExpressionRepository.CreateExpression(definition)
+	analysis, err := eh.ExpressionService.Analyze(ctx, expression)
 	if err != nil {
-		eh.Logger.WithField("err", err.Error()).Error("Error updating expressiong")
-		http.Error(w, "Error updating expression", http.StatusInternalServerError)
+		writeErrorFor(w, err)
+		logger.WithField("err", err.Error()).Error("error analysing expression")
 		return
 	}
 
-	eh.Logger.Info("expression created successfully")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(analysis); err != nil {
+		writeError(w, http.StatusInternalServerError, util.CodeInternal, util.ErrEncodingResponse)
+		logger.WithField("err", err.Error()).Error("error encoding response")
+		return
+	}
 }
 
-func (eh *ExpressionHandler) GetAllExpressions(w http.ResponseWriter, r *http.Request) {
-	expressions, err := eh.ExpressionRepository.GetAllExpressions()
+// GetExpressionVersions lists the versions a stored expression had before
+// its updates, oldest first.
+func (eh *ExpressionHandler) GetExpressionVersions(w http.ResponseWriter, r *http.Request) {
+	params := GetURLParams(r)
+	expressionId := params["expressionId"]
+
+	ctx, logger := logging.WithFields(r.Context(), log.Fields{logging.FieldExpressionId: expressionId})
+
+	expressionIdAsInt, err := strconv.Atoi(expressionId)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		eh.Logger.WithField("err", err.Error()).Error("error recovering expression from database")
+		writeError(w, http.StatusBadRequest, util.CodeInvalidExpressionId, util.ErrParsingExpressionId)
+		logger.WithField("err", err.Error()).Error("error parsing expressionId to int")
 		return
 	}
 
-	if err := json.NewEncoder(w).Encode(expressions); err != nil {
-		http.Error(w, "Error on marshal ", http.StatusInternalServerError)
-		eh.Logger.WithField("err", err.Error()).Error("error encoding response")
+	expression, err := eh.ExpressionRepository.GetExpressionById(ctx, expressionIdAsInt)
+	if err != nil {
+		writeErrorFor(w, err)
+		logger.WithField("err", err.Error()).Error("error recovering expression from database")
+		return
+	}
+
+	versions, err := eh.ExpressionRepository.GetExpressionVersions(ctx, expressionIdAsInt)
+	if err != nil {
+		writeErrorFor(w, err)
+		logger.WithField("err", err.Error()).Error("error recovering expression versions from database")
 		return
 	}
+	if versions == nil {
+		versions = []model.ExpressionVersion{}
+	}
 
-	eh.Logger.Info("all expressions recovered successfully")
+	w.Header().Set("Content-Type", "application/json")
+	response := model.VersionsResponse{ExpressionId: expression.ID, Version: expression.Version, Versions: versions}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		writeError(w, http.StatusInternalServerError, util.CodeInternal, util.ErrEncodingResponse)
+		logger.WithField("err", err.Error()).Error("error encoding response")
+		return
+	}
 }
 
 func (eh *ExpressionHandler) DeleteExpression(w http.ResponseWriter, r *http.Request) {
 	params := GetURLParams(r)
 	expressionId := params["expressionId"]
 
-	logger := eh.Logger.WithField("expressionId", expressionId)
+	ctx, logger := logging.WithFields(r.Context(), log.Fields{logging.FieldExpressionId: expressionId})
 
 	expressionIdAsInt, err := strconv.Atoi(expressionId)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, util.CodeInvalidExpressionId, util.ErrParsingExpressionId)
 		logger.WithField("err", err.Error()).Error("error parsing expressionId to int")
 		return
 	}
 
-	err = eh.ExpressionRepository.DeleteExpression(expressionIdAsInt)
+	force := false
+	if value := r.URL.Query().Get("force"); value != "" {
+		force, err = strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, util.CodeValidationFailed, util.ErrInvalidQuery,
+				model.ErrorDetail{Field: "force", Message: "must be a boolean"})
+			logger.WithField("err", err.Error()).Error("error parsing force")
+			return
+		}
+	}
+
+	err = eh.ExpressionService.DeleteExpression(ctx, expressionIdAsInt, force)
 	if err != nil {
 		logger.WithField("err", err.Error()).Error("Error deleting expression")
-		http.Error(w, "Error updating expression", http.StatusInternalServerError)
+		writeErrorFor(w, err)
 		return
 	}
 
 	logger.Info("expression deleted successfully")
 }
 
+// The evaluation options are reserved names in the query string: a variable
+// named like one can only be given in the body of POST /evaluate.
+const (
+	optionExplain          = "explain"
+	optionMissingVariables = "missingVariables"
+)
+
+// parseEvaluationQuery separates evaluation options from variable values in
+// the raw query. Values may be separated by commas (x=1,y=0) or ampersands
+// (x=1&y=0); either way they are handed to the service comma separated.
+func parseEvaluationQuery(rawQuery string) (string, service.EvaluationOptions, []model.ErrorDetail) {
+	var options service.EvaluationOptions
+	var values []string
+	var details []model.ErrorDetail
+
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+
+		name, value, _ := strings.Cut(part, "=")
+		switch name {
+		case optionExplain:
+			explain, err := strconv.ParseBool(value)
+			if err != nil {
+				details = append(details, model.ErrorDetail{Field: optionExplain, Message: "must be a boolean"})
+				continue
+			}
+			options.Explain = explain
+		case optionMissingVariables:
+			policy := model.MissingVariablePolicy(value)
+			if !policy.IsValid() {
+				details = append(details, model.ErrorDetail{Field: optionMissingVariables, Message: missingVariablesMessage})
+				continue
+			}
+			options.MissingVariables = policy
+		default:
+			values = append(values, part)
+		}
+	}
+
+	return strings.Join(values, ","), options, details
+}
+
+const missingVariablesMessage = "must be one of error, false or unknown"
+
+const dialectMessage = "must be one of native, govaluate or cel"
+
+// namePattern matches the names @references can use: identifiers that cannot
+// be mistaken for an id.
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,127}$`)
+
+const nameMessage = "must start with a letter or underscore and contain only letters, digits and underscores, up to 128 characters"
+
+// readBody reads the request body, answering BODY_TOO_LARGE once it exceeds
+// MaxBodyBytes. http.MaxBytesReader fails only after handing over exactly the
+// limit, which tells an oversized body apart from a failed read.
+func (eh *ExpressionHandler) readBody(w http.ResponseWriter, r *http.Request, logger *log.Entry) ([]byte, bool) {
+	limit := eh.MaxBodyBytes
+	if limit <= 0 {
+		limit = DefaultMaxBodyBytes
+	}
+
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil && int64(len(b)) == limit {
+		logger.WithField("limit", limit).Error("request body too large")
+		writeError(w, http.StatusRequestEntityTooLarge, util.CodeBodyTooLarge, util.ErrBodyTooLarge)
+		return nil, false
+	}
+	if err != nil {
+		logger.WithField("err", err.Error()).Error("Error on get body data")
+		writeError(w, http.StatusBadRequest, util.CodeInvalidBody, util.ErrReadingBody)
+		return nil, false
+	}
+	return b, true
+}
+
+// readExpression decodes the create and update payload, writing the error
+// response itself when the body is unreadable or has invalid fields. A name,
+// policy or dialect left out of the body is left nil, so an update keeps the
+// stored one.
+func (eh *ExpressionHandler) readExpression(w http.ResponseWriter, r *http.Request, logger *log.Entry) (model.ExpressionUpdate, bool) {
+	b, ok := eh.readBody(w, r, logger)
+	if !ok {
+		return model.ExpressionUpdate{}, false
+	}
+
+	var body map[string]any
+	err := json.Unmarshal(b, &body)
+	if err != nil {
+		logger.WithField("err", err.Error()).Error("Error on unmarshal payload")
+		writeError(w, http.StatusBadRequest, util.CodeInvalidBody, util.ErrInvalidBody)
+		return model.ExpressionUpdate{}, false
+	}
+
+	var expression model.ExpressionUpdate
+	var details []model.ErrorDetail
+
+	value, exists := body["definition"]
+	definition, isString := value.(string)
+	switch {
+	case !exists:
+		details = append(details, model.ErrorDetail{Field: "definition", Message: "is required"})
+	case !isString || definition == "":
+		details = append(details, model.ErrorDetail{Field: "definition", Message: "must be a non-empty string"})
+	default:
+		expression.Definition = definition
+	}
+
+	if value, exists := body["name"]; exists {
+		name, isString := value.(string)
+		if !isString || name != "" && !namePattern.MatchString(name) {
+			details = append(details, model.ErrorDetail{Field: "name", Message: nameMessage})
+		}
+		expression.Name = &name
+	}
+
+	if value, exists := body[optionMissingVariables]; exists {
+		policy, isString := value.(string)
+		if !isString || !model.MissingVariablePolicy(policy).IsValid() {
+			details = append(details, model.ErrorDetail{Field: optionMissingVariables, Message: missingVariablesMessage})
+		}
+		expression.MissingVariables = (*model.MissingVariablePolicy)(&policy)
+	}
+
+	if value, exists := body["dialect"]; exists {
+		dialect, isString := value.(string)
+		if !isString || !model.Dialect(dialect).IsValid() {
+			details = append(details, model.ErrorDetail{Field: "dialect", Message: dialectMessage})
+		}
+		expression.Dialect = (*model.Dialect)(&dialect)
+	}
+
+	if len(details) > 0 {
+		logger.WithField("body", body).Error("invalid expression on body")
+		writeError(w, http.StatusBadRequest, util.CodeValidationFailed, util.ErrInvalidFields, details...)
+		return model.ExpressionUpdate{}, false
+	}
+
+	return expression, true
+}
+
+const valueMessage = "must be a boolean, number, string, list or object"
+
+// readEvaluationBody decodes {"values": {...}}, writing the error response
+// itself when the body is unreadable or holds null values. Objects and lists
+// may nest, for definitions to address with paths like items[0].price.
+func (eh *ExpressionHandler) readEvaluationBody(w http.ResponseWriter, r *http.Request, logger *log.Entry) (map[string]interface{}, bool) {
+	b, ok := eh.readBody(w, r, logger)
+	if !ok {
+		return nil, false
+	}
+
+	var body struct {
+		Values map[string]interface{} `json:"values"`
+	}
+	if err := json.Unmarshal(b, &body); err != nil {
+		logger.WithField("err", err.Error()).Error("Error on unmarshal payload")
+		writeError(w, http.StatusBadRequest, util.CodeInvalidBody, util.ErrInvalidBody)
+		return nil, false
+	}
+
+	var details []model.ErrorDetail
+	for name, value := range body.Values {
+		if value == nil {
+			details = append(details, model.ErrorDetail{Field: "values." + name, Message: valueMessage})
+		}
+	}
+	if len(details) > 0 {
+		sort.Slice(details, func(i, j int) bool { return details[i].Field < details[j].Field })
+		logger.WithField("details", details).Error("invalid values on body")
+		writeError(w, http.StatusBadRequest, util.CodeValidationFailed, util.ErrInvalidFields, details...)
+		return nil, false
+	}
+
+	if body.Values == nil {
+		body.Values = map[string]interface{}{}
+	}
+	return body.Values, true
+}
+
 func GetURLParams(r *http.Request) map[string]string {
 	rctx := chi.RouteContext(r.Context())
 	var urlParams map[string]string
@@ -2,16 +2,19 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/go-chi/chi"
-	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
 	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
 	"github.com/viclisboa/regularExpressionEvaluatorAPI/service"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -55,9 +58,8 @@ func TestSaveExpression(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			handler := ExpressionHandler{
-				ExpressionService:    service.ExpressionService{},
+				ExpressionService:    service.ExpressionService{Store: &tc.databaseMock},
 				ExpressionRepository: &tc.databaseMock,
-				Logger:               log.Logger{},
 			}
 
 			r := chi.NewRouter()
@@ -77,6 +79,33 @@ func TestSaveExpression(t *testing.T) {
 	}
 }
 
+func TestSaveExpressionKeepsName(t *testing.T) {
+	databaseMock := repository.Stub{
+		Expressions: []model.Expression{
+			{ID: 1, Name: "isActive", Definition: "active"},
+			{ID: 2, Definition: "@isActive and premium"},
+		},
+		References: map[int][]model.Reference{
+			2: {{ID: 1, Name: "isActive"}},
+		},
+	}
+	handler := ExpressionHandler{
+		ExpressionService:    service.ExpressionService{Source: &databaseMock, Store: &databaseMock},
+		ExpressionRepository: &databaseMock,
+	}
+
+	r := chi.NewRouter()
+	r.Post("/expressions/{expressionId}", handler.SaveExpression)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	response, _ := http.Post(ts.URL+"/expressions/1", "application/json", strings.NewReader(`{"definition": "active and verified"}`))
+
+	assert.Equal(t, http.StatusOK, response.StatusCode, "updating only the definition is not a rename")
+	assert.Equal(t, "isActive", databaseMock.SaveExpressionCalledWith["name"])
+	assert.Equal(t, model.Expression{ID: 1, Name: "isActive", Definition: "active and verified", Version: 2}, databaseMock.Expressions[0])
+}
+
 func TestCreateExpression(t *testing.T) {
 	testCases := []struct {
 		name         string
@@ -102,6 +131,23 @@ func TestCreateExpression(t *testing.T) {
 			},
 			httpStatus: http.StatusBadRequest,
 		},
+		{
+			name:         "should return 422, definition does not parse",
+			databaseMock: repository.Stub{},
+			requestBody: map[string]any{
+				"definition": "a or",
+			},
+			httpStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "should return 422, definition does not parse in its dialect",
+			databaseMock: repository.Stub{},
+			requestBody: map[string]any{
+				"definition": "a or b",
+				"dialect":    "cel",
+			},
+			httpStatus: http.StatusUnprocessableEntity,
+		},
 		{
 			name: "should return 500, error saving in database",
 			databaseMock: repository.Stub{
@@ -117,9 +163,8 @@ func TestCreateExpression(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			handler := ExpressionHandler{
-				ExpressionService:    service.ExpressionService{},
+				ExpressionService:    service.ExpressionService{Store: &tc.databaseMock},
 				ExpressionRepository: &tc.databaseMock,
-				Logger:               log.Logger{},
 			}
 
 			r := chi.NewRouter()
@@ -139,6 +184,157 @@ func TestCreateExpression(t *testing.T) {
 	}
 }
 
+func TestCreateExpressionWarnings(t *testing.T) {
+	testCases := []struct {
+		name         string
+		definition   string
+		dialect      model.Dialect
+		expectedBody model.SaveResponse
+	}{
+		{
+			name:       "should flag contradictions",
+			definition: "a and not a",
+			expectedBody: model.SaveResponse{
+				Version:  1,
+				Analysis: &model.Analysis{Contradiction: true, Counterexample: map[string]bool{"a": true}},
+				Warnings: []model.Warning{{Code: util.WarningContradiction, Message: util.WarnContradiction}},
+			},
+		},
+		{
+			name:       "should flag tautologies",
+			definition: "a or not a",
+			expectedBody: model.SaveResponse{
+				Version:  1,
+				Analysis: &model.Analysis{Satisfiable: true, Tautology: true, Witness: map[string]bool{"a": true}},
+				Warnings: []model.Warning{{Code: util.WarningTautology, Message: util.WarnTautology}},
+			},
+		},
+		{
+			name:       "should not flag contingent expressions",
+			definition: "a or b",
+			expectedBody: model.SaveResponse{
+				Version: 1,
+				Analysis: &model.Analysis{
+					Satisfiable:    true,
+					Witness:        map[string]bool{"a": true, "b": false},
+					Counterexample: map[string]bool{"a": false, "b": false},
+				},
+			},
+		},
+		{
+			name:         "should store non-boolean expressions without analysis",
+			definition:   "age > 18",
+			expectedBody: model.SaveResponse{Version: 1},
+		},
+		{
+			name:       "should flag contradictions in CEL",
+			definition: "a && !a",
+			dialect:    model.DialectCEL,
+			expectedBody: model.SaveResponse{
+				Version:  1,
+				Analysis: &model.Analysis{Contradiction: true, Counterexample: map[string]bool{"a": true}},
+				Warnings: []model.Warning{{Code: util.WarningContradiction, Message: util.WarnContradiction}},
+			},
+		},
+		{
+			name:         "should store govaluate expressions without analysis",
+			definition:   "a && !a",
+			dialect:      model.DialectGovaluate,
+			expectedBody: model.SaveResponse{Version: 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			databaseMock := repository.Stub{}
+			handler := ExpressionHandler{
+				ExpressionService:    service.ExpressionService{Store: &databaseMock},
+				ExpressionRepository: &databaseMock,
+			}
+
+			r := chi.NewRouter()
+			r.Post("/expressions", handler.CreateExpression)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			var buf bytes.Buffer
+			body := map[string]any{"definition": tc.definition}
+			if tc.dialect != "" {
+				body["dialect"] = tc.dialect
+			}
+			_ = json.NewEncoder(&buf).Encode(body)
+
+			response, _ := http.Post(ts.URL+"/expressions", "application/json", &buf)
+
+			var parsedResponse model.SaveResponse
+			_ = json.NewDecoder(response.Body).Decode(&parsedResponse)
+
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Equal(t, tc.expectedBody, parsedResponse)
+			assert.Equal(t, tc.definition, databaseMock.CreateExpressionCalledWith["definition"])
+			assert.Equal(t, tc.dialect, databaseMock.CreateExpressionCalledWith["dialect"])
+		})
+	}
+}
+
+func TestGetExpressionAnalysis(t *testing.T) {
+	testCases := []struct {
+		name         string
+		databaseMock repository.Stub
+		httpStatus   int
+		expectedBody model.Analysis
+	}{
+		{
+			name: "should return 200",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: "x and y"},
+			},
+			httpStatus: http.StatusOK,
+			expectedBody: model.Analysis{
+				Satisfiable:    true,
+				Witness:        map[string]bool{"x": true, "y": true},
+				Counterexample: map[string]bool{"x": true, "y": false},
+			},
+		},
+		{
+			name: "should return 422, variables are not booleans",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: `name == "ana"`},
+			},
+			httpStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "should return 404, expression not found",
+			databaseMock: repository.Stub{
+				GetExpressionByIdError: repository.ErrExpressionNotFound,
+			},
+			httpStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := ExpressionHandler{
+				ExpressionService:    service.ExpressionService{},
+				ExpressionRepository: &tc.databaseMock,
+			}
+
+			r := chi.NewRouter()
+			r.Get("/expressions/{expressionId}/analysis", handler.GetExpressionAnalysis)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			response, _ := http.Get(ts.URL + "/expressions/10/analysis")
+
+			var parsedResponse model.Analysis
+			_ = json.NewDecoder(response.Body).Decode(&parsedResponse)
+
+			assert.Equal(t, tc.httpStatus, response.StatusCode)
+			assert.Equal(t, tc.expectedBody, parsedResponse)
+		})
+	}
+}
+
 func TestEvaluateExpression(t *testing.T) {
 	testCases := []struct {
 		name         string
@@ -161,18 +357,37 @@ func TestEvaluateExpression(t *testing.T) {
 				Definition: "x or y",
 				Values:     "x=1,y=0",
 				Result:     true,
+				Outcome:    model.OutcomeTrue,
 			},
 			queryString: "?x=1,y=0",
 		},
 		{
 			name: "should return 404, expression not found",
 			databaseMock: repository.Stub{
-				GetExpressionByIdError: errors.New("not found"),
+				GetExpressionByIdError: repository.ErrExpressionNotFound,
 			},
 			httpStatus:   http.StatusNotFound,
 			expectedBody: model.Response{},
 			queryString:  "?x=1,y=0,z=1",
 		},
+		{
+			name: "should return 504, database query timed out",
+			databaseMock: repository.Stub{
+				GetExpressionByIdError: context.DeadlineExceeded,
+			},
+			httpStatus:   http.StatusGatewayTimeout,
+			expectedBody: model.Response{},
+			queryString:  "?x=1,y=0",
+		},
+		{
+			name: "should return 499, request cancelled",
+			databaseMock: repository.Stub{
+				GetExpressionByIdError: context.Canceled,
+			},
+			httpStatus:   StatusClientClosedRequest,
+			expectedBody: model.Response{},
+			queryString:  "?x=1,y=0",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -180,7 +395,6 @@ func TestEvaluateExpression(t *testing.T) {
 			handler := ExpressionHandler{
 				ExpressionService:    service.ExpressionService{},
 				ExpressionRepository: &tc.databaseMock,
-				Logger:               log.Logger{},
 			}
 
 			r := chi.NewRouter()
@@ -202,35 +416,423 @@ func TestEvaluateExpression(t *testing.T) {
 	}
 }
 
+func TestEvaluateExpressionExplain(t *testing.T) {
+	handler := ExpressionHandler{
+		ExpressionService: service.ExpressionService{},
+		ExpressionRepository: &repository.Stub{
+			GetExpressionByIdResponse: model.Expression{ID: 10, Definition: "x or y"},
+		},
+	}
+
+	r := chi.NewRouter()
+	r.HandleFunc("/evaluate/{expressionId}", handler.EvaluateExpression)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	response, _ := http.Get(ts.URL + "/evaluate/10?x=1&y=0&explain=true")
+
+	var parsedResponse model.Response
+	_ = json.NewDecoder(response.Body).Decode(&parsedResponse)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, model.Response{
+		Definition: "x or y",
+		Values:     "x=1,y=0",
+		Result:     true,
+		Outcome:    model.OutcomeTrue,
+		Explanation: &model.Explanation{
+			Expression: "x OR y",
+			Operator:   "OR",
+			Value:      true,
+			Operands: []model.Explanation{
+				{Expression: "x", Value: true},
+				{Expression: "y", ShortCircuited: true},
+			},
+		},
+	}, parsedResponse)
+
+	response, _ = http.Get(ts.URL + "/evaluate/10?x=1,y=0&explain=maybe")
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
+
+func TestEvaluateExpressionWithBody(t *testing.T) {
+	testCases := []struct {
+		name            string
+		query           string
+		body            string
+		httpStatus      int
+		expectedBody    model.Response
+		expectedCode    string
+		expectedDetails []model.ErrorDetail
+	}{
+		{
+			name:       "should return 200 with typed values",
+			body:       `{"values": {"roles": ["editor", "admin"], "tags": ["beta"], "age": 42}}`,
+			httpStatus: http.StatusOK,
+			expectedBody: model.Response{
+				Definition: `"admin" IN roles AND ANY tags IN ["beta", "new"] AND age > 18`,
+				Values:     `{"age":42,"roles":["editor","admin"],"tags":["beta"]}`,
+				Result:     true,
+				Outcome:    model.OutcomeTrue,
+			},
+		},
+		{
+			name:       "should return 400, body is not json",
+			body:       `{"values": `,
+			httpStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should return 400, null values",
+			body:       `{"values": {"user": null, "tags": null, "age": 42}}`,
+			httpStatus: http.StatusBadRequest,
+			expectedDetails: []model.ErrorDetail{
+				{Field: "values.tags", Message: "must be a boolean, number, string, list or object"},
+				{Field: "values.user", Message: "must be a boolean, number, string, list or object"},
+			},
+		},
+		{
+			name:         "should return 413, body too large",
+			body:         `{"values": {"tags": [` + strings.Repeat(`"beta", `, 40) + `"new"]}}`,
+			httpStatus:   http.StatusRequestEntityTooLarge,
+			expectedCode: util.CodeBodyTooLarge,
+		},
+		{
+			name:         "should return 422, too many values",
+			body:         `{"values": {"tags": [` + strings.Repeat(`1, `, 20) + `2]}}`,
+			httpStatus:   http.StatusUnprocessableEntity,
+			expectedCode: util.CodeValuesTooLarge,
+		},
+		{
+			name:         "should return 422, values nested too deeply",
+			body:         `{"values": {"tags": [[["beta"]]]}}`,
+			httpStatus:   http.StatusUnprocessableEntity,
+			expectedCode: util.CodeValuesTooLarge,
+		},
+		{
+			name:       "should return 400, values in the query string",
+			query:      "?age=42",
+			body:       `{"values": {}}`,
+			httpStatus: http.StatusBadRequest,
+			expectedDetails: []model.ErrorDetail{
+				{Field: "values", Message: "must be sent in the body"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := ExpressionHandler{
+				ExpressionService: service.ExpressionService{Limits: service.Limits{MaxValues: 20, MaxValueDepth: 3}},
+				ExpressionRepository: &repository.Stub{
+					GetExpressionByIdResponse: model.Expression{ID: 10, Definition: `"admin" IN roles AND ANY tags IN ["beta", "new"] AND age > 18`},
+				},
+				MaxBodyBytes: 256,
+			}
+
+			r := chi.NewRouter()
+			r.Post("/evaluate/{expressionId}", handler.EvaluateExpression)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			response, _ := http.Post(ts.URL+"/evaluate/10"+tc.query, "application/json", strings.NewReader(tc.body))
+			body, _ := ioutil.ReadAll(response.Body)
+
+			assert.Equal(t, tc.httpStatus, response.StatusCode)
+			if tc.httpStatus == http.StatusOK {
+				var parsedResponse model.Response
+				_ = json.Unmarshal(body, &parsedResponse)
+				assert.Equal(t, tc.expectedBody, parsedResponse)
+			}
+			var parsedResponse model.ErrorResponse
+			_ = json.Unmarshal(body, &parsedResponse)
+			if tc.expectedCode != "" {
+				assert.Equal(t, tc.expectedCode, parsedResponse.Error.Code)
+			}
+			if tc.expectedDetails != nil {
+				assert.Equal(t, tc.expectedDetails, parsedResponse.Error.Details)
+			}
+		})
+	}
+}
+
+func TestEvaluateExpressionPaths(t *testing.T) {
+	handler := ExpressionHandler{
+		ExpressionService: service.ExpressionService{},
+		ExpressionRepository: &repository.Stub{
+			GetExpressionByIdResponse: model.Expression{ID: 10, Definition: `user.country == "BR" and items[1].price > 10`},
+		},
+	}
+
+	r := chi.NewRouter()
+	r.HandleFunc("/evaluate/{expressionId}", handler.EvaluateExpression)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	response, _ := http.Post(ts.URL+"/evaluate/10", "application/json",
+		strings.NewReader(`{"values": {"user": {"country": "BR"}, "items": [{"price": 5}, {"price": 20}]}}`))
+	var parsedResponse model.Response
+	_ = json.NewDecoder(response.Body).Decode(&parsedResponse)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.True(t, parsedResponse.Result)
+
+	response, _ = http.Post(ts.URL+"/evaluate/10", "application/json",
+		strings.NewReader(`{"values": {"user": {"country": "BR"}, "items": [{"price": 5}]}}`))
+	var parsedError model.ErrorResponse
+	_ = json.NewDecoder(response.Body).Decode(&parsedError)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+	assert.Equal(t, model.Error{
+		Code:    util.CodeMissingPath,
+		Message: util.ErrMissingPath,
+		Details: []model.ErrorDetail{{Field: "items[1].price", Message: "items has no index 1, its length is 1"}},
+	}, parsedError.Error)
+
+	response, _ = http.Get(ts.URL + "/evaluate/10?user.country=BR,items[1].price=11")
+	parsedResponse = model.Response{}
+	_ = json.NewDecoder(response.Body).Decode(&parsedResponse)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.True(t, parsedResponse.Result)
+}
+
+func TestGetAllExpressions(t *testing.T) {
+	handler := ExpressionHandler{
+		ExpressionService: service.ExpressionService{},
+		ExpressionRepository: &repository.Stub{
+			GetAllExpressionsResponse: []model.Expression{
+				{ID: 1, Definition: "x and y > 2"},
+				{ID: 2, Definition: "x and"},
+			},
+		},
+	}
+
+	r := chi.NewRouter()
+	r.Get("/expressions", handler.GetAllExpressions)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	response, _ := http.Get(ts.URL + "/expressions")
+
+	var parsedResponse []model.Expression
+	_ = json.NewDecoder(response.Body).Decode(&parsedResponse)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, []model.Expression{
+		{ID: 1, Definition: "x and y > 2", Variables: []model.Variable{
+			{Name: "x", Type: "boolean"},
+			{Name: "y", Type: "number"},
+		}},
+		{ID: 2, Definition: "x and"},
+	}, parsedResponse)
+}
+
+func TestGetExpressionVariables(t *testing.T) {
+	testCases := []struct {
+		name         string
+		databaseMock repository.Stub
+		expressionId string
+		httpStatus   int
+		expectedBody model.VariablesResponse
+	}{
+		{
+			name: "should return 200",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: `x or name == "ana"`},
+			},
+			expressionId: "10",
+			httpStatus:   http.StatusOK,
+			expectedBody: model.VariablesResponse{
+				ExpressionId: 10,
+				Variables: []model.Variable{
+					{Name: "name", Type: "string"},
+					{Name: "x", Type: "boolean"},
+				},
+			},
+		},
+		{
+			name:         "should return 400, invalid expression id",
+			databaseMock: repository.Stub{},
+			expressionId: "abc",
+			httpStatus:   http.StatusBadRequest,
+		},
+		{
+			name: "should return 404, expression not found",
+			databaseMock: repository.Stub{
+				GetExpressionByIdError: repository.ErrExpressionNotFound,
+			},
+			expressionId: "10",
+			httpStatus:   http.StatusNotFound,
+		},
+		{
+			name: "should return 422, stored definition is invalid",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: "x and"},
+			},
+			expressionId: "10",
+			httpStatus:   http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := ExpressionHandler{
+				ExpressionService:    service.ExpressionService{},
+				ExpressionRepository: &tc.databaseMock,
+			}
+
+			r := chi.NewRouter()
+			r.Get("/expressions/{expressionId}/variables", handler.GetExpressionVariables)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			response, _ := http.Get(ts.URL + "/expressions/" + tc.expressionId + "/variables")
+
+			var parsedResponse model.VariablesResponse
+			_ = json.NewDecoder(response.Body).Decode(&parsedResponse)
+
+			assert.Equal(t, tc.httpStatus, response.StatusCode)
+			assert.Equal(t, tc.expectedBody, parsedResponse)
+		})
+	}
+}
+
+func TestGetExpressionVersions(t *testing.T) {
+	testCases := []struct {
+		name         string
+		databaseMock repository.Stub
+		expressionId string
+		httpStatus   int
+		expectedBody model.VersionsResponse
+	}{
+		{
+			name: "should return 200",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: "a or c", Version: 3},
+				Versions: map[int][]model.ExpressionVersion{
+					10: {
+						{Version: 1, Definition: "a"},
+						{Version: 2, Definition: "(a and b) or (a and not b) or c"},
+					},
+				},
+			},
+			expressionId: "10",
+			httpStatus:   http.StatusOK,
+			expectedBody: model.VersionsResponse{
+				ExpressionId: 10,
+				Version:      3,
+				Versions: []model.ExpressionVersion{
+					{Version: 1, Definition: "a"},
+					{Version: 2, Definition: "(a and b) or (a and not b) or c"},
+				},
+			},
+		},
+		{
+			name: "should return 200, never updated",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: "a", Version: 1},
+			},
+			expressionId: "10",
+			httpStatus:   http.StatusOK,
+			expectedBody: model.VersionsResponse{ExpressionId: 10, Version: 1, Versions: []model.ExpressionVersion{}},
+		},
+		{
+			name:         "should return 400, invalid expression id",
+			databaseMock: repository.Stub{},
+			expressionId: "abc",
+			httpStatus:   http.StatusBadRequest,
+		},
+		{
+			name: "should return 404, expression not found",
+			databaseMock: repository.Stub{
+				GetExpressionByIdError: repository.ErrExpressionNotFound,
+			},
+			expressionId: "10",
+			httpStatus:   http.StatusNotFound,
+		},
+		{
+			name: "should return 500, versions query failed",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse:  model.Expression{ID: 10, Definition: "a", Version: 2},
+				GetExpressionVersionsError: repository.ErrQueryFailed,
+			},
+			expressionId: "10",
+			httpStatus:   http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := ExpressionHandler{
+				ExpressionService:    service.ExpressionService{},
+				ExpressionRepository: &tc.databaseMock,
+			}
+
+			r := chi.NewRouter()
+			r.Get("/expressions/{expressionId}/versions", handler.GetExpressionVersions)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			response, _ := http.Get(ts.URL + "/expressions/" + tc.expressionId + "/versions")
+
+			var parsedResponse model.VersionsResponse
+			_ = json.NewDecoder(response.Body).Decode(&parsedResponse)
+
+			assert.Equal(t, tc.httpStatus, response.StatusCode)
+			assert.Equal(t, tc.expectedBody, parsedResponse)
+		})
+	}
+}
+
 func TestDeleteExpression(t *testing.T) {
 	testCases := []struct {
 		name         string
 		databaseMock repository.Stub
 		requestBody  map[string]any
+		query        string
 		httpStatus   int
+		deleteCalled bool
 	}{
 		{
 			name: "should return 200",
 			databaseMock: repository.Stub{
 				DeleteExpressionError: nil,
 			},
-			httpStatus: http.StatusOK,
+			httpStatus:   http.StatusOK,
+			deleteCalled: true,
+		},
+		{
+			name: "should return 409, expression is referenced",
+			databaseMock: repository.Stub{
+				References: map[int][]model.Reference{2: {{ID: 1, Name: "isActive"}}},
+			},
+			httpStatus:   http.StatusConflict,
+			deleteCalled: true,
+		},
+		{
+			name: "should return 200, referenced expression deleted with force",
+			databaseMock: repository.Stub{
+				References: map[int][]model.Reference{2: {{ID: 1, Name: "isActive"}}},
+			},
+			query:        "?force=true",
+			httpStatus:   http.StatusOK,
+			deleteCalled: true,
 		},
 		{
 			name: "should return 500, error deleting from database",
 			databaseMock: repository.Stub{
 				DeleteExpressionError: errors.New("not found"),
 			},
-			httpStatus: http.StatusInternalServerError,
+			httpStatus:   http.StatusInternalServerError,
+			deleteCalled: true,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			handler := ExpressionHandler{
-				ExpressionService:    service.ExpressionService{},
+				ExpressionService:    service.ExpressionService{Store: &tc.databaseMock},
 				ExpressionRepository: &tc.databaseMock,
-				Logger:               log.Logger{},
 			}
 
 			r := chi.NewRouter()
@@ -238,7 +840,7 @@ func TestDeleteExpression(t *testing.T) {
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 
-			url := ts.URL + "/expressions/1"
+			url := ts.URL + "/expressions/1" + tc.query
 
 			var buf bytes.Buffer
 			_ = json.NewEncoder(&buf).Encode(tc.requestBody)
@@ -247,6 +849,350 @@ func TestDeleteExpression(t *testing.T) {
 			response, _ := http.DefaultClient.Do(req)
 
 			assert.Equal(t, tc.httpStatus, response.StatusCode)
+			assert.Equal(t, tc.deleteCalled, tc.databaseMock.DeleteExpressionCalledWith != nil)
+		})
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	testCases := []struct {
+		name          string
+		databaseMock  repository.Stub
+		method        string
+		path          string
+		body          string
+		httpStatus    int
+		expectedError model.Error
+	}{
+		{
+			name:         "should return 400, expression id is not a number",
+			databaseMock: repository.Stub{},
+			method:       http.MethodGet,
+			path:         "/evaluate/abc",
+			httpStatus:   http.StatusBadRequest,
+			expectedError: model.Error{
+				Code:    util.CodeInvalidExpressionId,
+				Message: util.ErrParsingExpressionId,
+			},
+		},
+		{
+			name: "should return 404, expression not found",
+			databaseMock: repository.Stub{
+				GetExpressionByIdError: repository.ErrExpressionNotFound,
+			},
+			method:     http.MethodGet,
+			path:       "/evaluate/10",
+			httpStatus: http.StatusNotFound,
+			expectedError: model.Error{
+				Code:    util.CodeExpressionNotFound,
+				Message: util.ErrExpressionNotFound,
+			},
+		},
+		{
+			name: "should return 500, database error hides driver details",
+			databaseMock: repository.Stub{
+				GetExpressionByIdError: errors.New("pq: connection reset"),
+			},
+			method:     http.MethodGet,
+			path:       "/evaluate/10",
+			httpStatus: http.StatusInternalServerError,
+			expectedError: model.Error{
+				Code:    util.CodeInternal,
+				Message: util.ErrInternal,
+			},
+		},
+		{
+			name: "should return 422, stored definition is invalid",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: "&"},
+			},
+			method:     http.MethodGet,
+			path:       "/evaluate/10",
+			httpStatus: http.StatusUnprocessableEntity,
+			expectedError: model.Error{
+				Code:    util.CodeInvalidExpression,
+				Message: util.ErrCreatingEvaluableExpression,
+			},
+		},
+		{
+			name: "should return 500, listing fails",
+			databaseMock: repository.Stub{
+				GetAllExpressionsError: repository.ErrQueryFailed,
+			},
+			method:     http.MethodGet,
+			path:       "/expressions",
+			httpStatus: http.StatusInternalServerError,
+			expectedError: model.Error{
+				Code:    util.CodeDatabaseError,
+				Message: util.ErrExecutingQuery,
+			},
+		},
+		{
+			name:         "should return 400, malformed json",
+			databaseMock: repository.Stub{},
+			method:       http.MethodPost,
+			path:         "/expressions",
+			body:         "{",
+			httpStatus:   http.StatusBadRequest,
+			expectedError: model.Error{
+				Code:    util.CodeInvalidBody,
+				Message: util.ErrInvalidBody,
+			},
+		},
+		{
+			name:         "should return 400, definition is not a string",
+			databaseMock: repository.Stub{},
+			method:       http.MethodPost,
+			path:         "/expressions/1",
+			body:         `{"definition": 10}`,
+			httpStatus:   http.StatusBadRequest,
+			expectedError: model.Error{
+				Code:    util.CodeValidationFailed,
+				Message: util.ErrInvalidFields,
+				Details: []model.ErrorDetail{{Field: "definition", Message: "must be a non-empty string"}},
+			},
+		},
+		{
+			name:         "should return 400, unknown missing variable policy",
+			databaseMock: repository.Stub{},
+			method:       http.MethodPost,
+			path:         "/expressions",
+			body:         `{"definition": "x or y", "missingVariables": "ignore"}`,
+			httpStatus:   http.StatusBadRequest,
+			expectedError: model.Error{
+				Code:    util.CodeValidationFailed,
+				Message: util.ErrInvalidFields,
+				Details: []model.ErrorDetail{{Field: "missingVariables", Message: "must be one of error, false or unknown"}},
+			},
+		},
+		{
+			name:         "should return 400, unknown dialect",
+			databaseMock: repository.Stub{},
+			method:       http.MethodPost,
+			path:         "/expressions",
+			body:         `{"definition": "x or y", "dialect": "sql"}`,
+			httpStatus:   http.StatusBadRequest,
+			expectedError: model.Error{
+				Code:    util.CodeValidationFailed,
+				Message: util.ErrInvalidFields,
+				Details: []model.ErrorDetail{{Field: "dialect", Message: "must be one of native, govaluate or cel"}},
+			},
+		},
+		{
+			name:         "should return 422, feature the dialect does not support",
+			databaseMock: repository.Stub{},
+			method:       http.MethodPost,
+			path:         "/expressions",
+			body:         `{"definition": "email =~ 'example'", "dialect": "govaluate"}`,
+			httpStatus:   http.StatusUnprocessableEntity,
+			expectedError: model.Error{
+				Code:    util.CodeUnsupportedDialect,
+				Message: util.ErrUnsupportedDialect,
+				Details: []model.ErrorDetail{{Field: "dialect", Message: "govaluate does not support regular expressions"}},
+			},
+		},
+		{
+			name: "should return 400, unknown missing variable policy in query",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: "x or y"},
+			},
+			method:     http.MethodGet,
+			path:       "/evaluate/10?x=1&missingVariables=maybe",
+			httpStatus: http.StatusBadRequest,
+			expectedError: model.Error{
+				Code:    util.CodeValidationFailed,
+				Message: util.ErrInvalidQuery,
+				Details: []model.ErrorDetail{{Field: "missingVariables", Message: "must be one of error, false or unknown"}},
+			},
+		},
+		{
+			name:         "should return 400, invalid name",
+			databaseMock: repository.Stub{},
+			method:       http.MethodPost,
+			path:         "/expressions",
+			body:         `{"definition": "x or y", "name": "42"}`,
+			httpStatus:   http.StatusBadRequest,
+			expectedError: model.Error{
+				Code:    util.CodeValidationFailed,
+				Message: util.ErrInvalidFields,
+				Details: []model.ErrorDetail{{Field: "name", Message: nameMessage}},
+			},
+		},
+		{
+			name: "should return 409, name already in use",
+			databaseMock: repository.Stub{
+				CreateExpressionError: repository.ErrNameTaken,
+			},
+			method:     http.MethodPost,
+			path:       "/expressions",
+			body:       `{"definition": "x or y", "name": "isActive"}`,
+			httpStatus: http.StatusConflict,
+			expectedError: model.Error{
+				Code:    util.CodeNameConflict,
+				Message: util.ErrExpressionNameTaken,
+			},
+		},
+		{
+			name:         "should return 422, unknown reference",
+			databaseMock: repository.Stub{},
+			method:       http.MethodPost,
+			path:         "/expressions",
+			body:         `{"definition": "@isActive or y"}`,
+			httpStatus:   http.StatusUnprocessableEntity,
+			expectedError: model.Error{
+				Code:    util.CodeUnknownReference,
+				Message: util.ErrUnknownReference,
+			},
+		},
+		{
+			name:         "should return 422, unknown function",
+			databaseMock: repository.Stub{},
+			method:       http.MethodPost,
+			path:         "/expressions",
+			body:         `{"definition": "shout(name)"}`,
+			httpStatus:   http.StatusUnprocessableEntity,
+			expectedError: model.Error{
+				Code:    util.CodeUnknownFunction,
+				Message: util.ErrUnknownFunction,
+			},
+		},
+		{
+			name:         "should return 422, function called with invalid arguments",
+			databaseMock: repository.Stub{},
+			method:       http.MethodPost,
+			path:         "/expressions",
+			body:         `{"definition": "abs(\"x\") > 1"}`,
+			httpStatus:   http.StatusUnprocessableEntity,
+			expectedError: model.Error{
+				Code:    util.CodeInvalidArguments,
+				Message: util.ErrInvalidArguments,
+			},
+		},
+		{
+			name:         "should return 422, definition is nested too deeply",
+			databaseMock: repository.Stub{},
+			method:       http.MethodPost,
+			path:         "/expressions",
+			body:         `{"definition": "` + strings.Repeat("!", 64) + `x"}`,
+			httpStatus:   http.StatusUnprocessableEntity,
+			expectedError: model.Error{
+				Code:    util.CodeExpressionTooDeep,
+				Message: util.ErrExpressionTooDeep,
+			},
+		},
+		{
+			name: "should return 422, update references the expression itself",
+			databaseMock: repository.Stub{
+				Expressions: []model.Expression{
+					{ID: 1, Name: "isActive", Definition: "active"},
+					{ID: 2, Name: "isPremium", Definition: "@isActive and premium"},
+				},
+			},
+			method:     http.MethodPost,
+			path:       "/expressions/1",
+			body:       `{"definition": "@isPremium or admin", "name": "isActive"}`,
+			httpStatus: http.StatusUnprocessableEntity,
+			expectedError: model.Error{
+				Code:    util.CodeReferenceCycle,
+				Message: util.ErrReferenceCycle,
+			},
+		},
+		{
+			name: "should return 409, deleting a referenced expression",
+			databaseMock: repository.Stub{
+				References: map[int][]model.Reference{
+					2: {{ID: 1, Name: "isActive"}},
+					3: {{ID: 1}, {ID: 2, Name: "isPremium"}},
+				},
+			},
+			method:     http.MethodDelete,
+			path:       "/expressions/1",
+			httpStatus: http.StatusConflict,
+			expectedError: model.Error{
+				Code:    util.CodeHasDependents,
+				Message: util.ErrHasDependents,
+				Details: []model.ErrorDetail{
+					{Field: "dependents", Message: "referenced by expression 2"},
+					{Field: "dependents", Message: "referenced by expression 3"},
+				},
+			},
+		},
+		{
+			name: "should return 409, renaming an expression referenced by name",
+			databaseMock: repository.Stub{
+				Expressions: []model.Expression{{ID: 1, Name: "isActive", Definition: "active"}},
+				References: map[int][]model.Reference{
+					2: {{ID: 1, Name: "isActive"}},
+					3: {{ID: 1}},
+				},
+			},
+			method:     http.MethodPost,
+			path:       "/expressions/1",
+			body:       `{"definition": "active", "name": "isEnabled"}`,
+			httpStatus: http.StatusConflict,
+			expectedError: model.Error{
+				Code:    util.CodeNameReferenced,
+				Message: util.ErrNameReferenced,
+				Details: []model.ErrorDetail{
+					{Field: "dependents", Message: "referenced by expression 2"},
+				},
+			},
+		},
+		{
+			name: "should return 422, referenced expression deleted while saving",
+			databaseMock: repository.Stub{
+				Expressions:           []model.Expression{{ID: 1, Name: "isActive", Definition: "active"}},
+				CreateExpressionError: repository.ErrReferenceNotFound,
+			},
+			method:     http.MethodPost,
+			path:       "/expressions",
+			body:       `{"definition": "@isActive and premium"}`,
+			httpStatus: http.StatusUnprocessableEntity,
+			expectedError: model.Error{
+				Code:    util.CodeUnknownReference,
+				Message: util.ErrUnknownReference,
+			},
+		},
+		{
+			name: "should return 404, deleting unknown expression",
+			databaseMock: repository.Stub{
+				DeleteExpressionError: repository.ErrExpressionNotFound,
+			},
+			method:     http.MethodDelete,
+			path:       "/expressions/1",
+			httpStatus: http.StatusNotFound,
+			expectedError: model.Error{
+				Code:    util.CodeExpressionNotFound,
+				Message: util.ErrExpressionNotFound,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := ExpressionHandler{
+				ExpressionService:    service.ExpressionService{Source: &tc.databaseMock, Store: &tc.databaseMock},
+				ExpressionRepository: &tc.databaseMock,
+			}
+
+			r := chi.NewRouter()
+			r.Get("/evaluate/{expressionId}", handler.EvaluateExpression)
+			r.Get("/expressions", handler.GetAllExpressions)
+			r.Post("/expressions", handler.CreateExpression)
+			r.Post("/expressions/{expressionId}", handler.SaveExpression)
+			r.Delete("/expressions/{expressionId}", handler.DeleteExpression)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			req, _ := http.NewRequest(tc.method, ts.URL+tc.path, strings.NewReader(tc.body))
+			response, _ := http.DefaultClient.Do(req)
+
+			var parsedResponse model.ErrorResponse
+			_ = json.NewDecoder(response.Body).Decode(&parsedResponse)
+
+			assert.Equal(t, tc.httpStatus, response.StatusCode)
+			assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+			assert.Equal(t, tc.expectedError, parsedResponse.Error)
 		})
 	}
 }
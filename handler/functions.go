@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/logging"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"net/http"
+)
+
+// GetFunctions documents the functions definitions can call.
+func (eh *ExpressionHandler) GetFunctions(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(model.FunctionsResponse{Functions: eh.ExpressionService.Functions()}); err != nil {
+		logger.WithField("err", err.Error()).Error("error encoding response")
+	}
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetFunctions(t *testing.T) {
+	handler := ExpressionHandler{ExpressionService: service.ExpressionService{}}
+
+	r := chi.NewRouter()
+	r.Get("/functions", handler.GetFunctions)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	response, _ := http.Get(ts.URL + "/functions")
+
+	var body model.FunctionsResponse
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&body))
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+	assert.Contains(t, body.Functions, model.Function{
+		Name:        "contains",
+		Description: "reports whether the first string contains the second",
+		Parameters:  []string{"string", "string"},
+		Returns:     "boolean",
+	})
+}
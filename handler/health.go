@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/logging"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/service"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"net/http"
+)
+
+type HealthHandler struct {
+	ExpressionRepository repository.ExpressionInterface
+	ExpressionCache      *service.ExpressionCache
+}
+
+// Liveness reports that the process is up and able to serve requests. It does
+// not touch any dependency so a slow database never restarts the service.
+func (hh *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeHealthResponse(w, r, model.HealthResponse{Status: util.HealthStatusOk})
+}
+
+// Readiness reports whether the service can serve traffic: the database must
+// answer a ping and the expression table must have been migrated. Cache
+// warmness is informational only and never makes the service unready.
+func (hh *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]HealthCheckFunc{
+		"database":   hh.ExpressionRepository.Ping,
+		"migrations": hh.ExpressionRepository.CheckMigrations,
+	}
+
+	response := runHealthChecks(r.Context(), checks)
+
+	if hh.ExpressionCache != nil {
+		stats := hh.ExpressionCache.Stats()
+		response.Checks["cache"] = model.HealthCheck{
+			Status: util.HealthStatusOk,
+			Details: map[string]any{
+				"warm":     stats.Entries > 0,
+				"entries":  stats.Entries,
+				"capacity": stats.Capacity,
+			},
+		}
+	}
+
+	writeHealthResponse(w, r, response)
+}
+
+type HealthCheckFunc func(ctx context.Context) error
+
+func runHealthChecks(ctx context.Context, checks map[string]HealthCheckFunc) model.HealthResponse {
+	response := model.HealthResponse{
+		Status: util.HealthStatusOk,
+		Checks: make(map[string]model.HealthCheck, len(checks)),
+	}
+
+	for name, check := range checks {
+		if err := check(ctx); err != nil {
+			logging.FromContext(ctx).WithFields(log.Fields{
+				"check": name,
+				"err":   err.Error(),
+			}).Warn("readiness check failed")
+			response.Status = util.HealthStatusUnavailable
+			response.Checks[name] = model.HealthCheck{Status: util.HealthStatusUnavailable, Error: err.Error()}
+			continue
+		}
+		response.Checks[name] = model.HealthCheck{Status: util.HealthStatusOk}
+	}
+
+	return response
+}
+
+func writeHealthResponse(w http.ResponseWriter, r *http.Request, response model.HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if response.Status != util.HealthStatusOk {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logging.FromContext(r.Context()).WithField("err", err.Error()).Error("error encoding health response")
+	}
+}
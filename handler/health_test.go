@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/service"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLiveness(t *testing.T) {
+	handler := HealthHandler{
+		ExpressionRepository: &repository.Stub{PingError: errors.New("connection refused")},
+	}
+
+	r := chi.NewRouter()
+	r.Get("/healthz", handler.Liveness)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	response, _ := http.Get(ts.URL + "/healthz")
+
+	var parsedResponse model.HealthResponse
+	_ = json.NewDecoder(response.Body).Decode(&parsedResponse)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, model.HealthResponse{Status: util.HealthStatusOk}, parsedResponse)
+}
+
+func TestReadiness(t *testing.T) {
+	testCases := []struct {
+		name         string
+		databaseMock repository.Stub
+		cache        *service.ExpressionCache
+		httpStatus   int
+		expectedBody model.HealthResponse
+	}{
+		{
+			name:         "should return 200, all checks ok",
+			databaseMock: repository.Stub{},
+			httpStatus:   http.StatusOK,
+			expectedBody: model.HealthResponse{
+				Status: util.HealthStatusOk,
+				Checks: map[string]model.HealthCheck{
+					"database":   {Status: util.HealthStatusOk},
+					"migrations": {Status: util.HealthStatusOk},
+				},
+			},
+		},
+		{
+			name:         "should return 200, cold cache is reported but not failing",
+			databaseMock: repository.Stub{},
+			cache:        service.NewExpressionCache(10),
+			httpStatus:   http.StatusOK,
+			expectedBody: model.HealthResponse{
+				Status: util.HealthStatusOk,
+				Checks: map[string]model.HealthCheck{
+					"database":   {Status: util.HealthStatusOk},
+					"migrations": {Status: util.HealthStatusOk},
+					"cache": {
+						Status: util.HealthStatusOk,
+						Details: map[string]any{
+							"warm":     false,
+							"entries":  float64(0),
+							"capacity": float64(10),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "should return 503, database unreachable",
+			databaseMock: repository.Stub{
+				PingError: errors.New("connection refused"),
+			},
+			httpStatus: http.StatusServiceUnavailable,
+			expectedBody: model.HealthResponse{
+				Status: util.HealthStatusUnavailable,
+				Checks: map[string]model.HealthCheck{
+					"database":   {Status: util.HealthStatusUnavailable, Error: "connection refused"},
+					"migrations": {Status: util.HealthStatusOk},
+				},
+			},
+		},
+		{
+			name: "should return 503, table not migrated",
+			databaseMock: repository.Stub{
+				CheckMigrationsError: errors.New("table expression does not exist"),
+			},
+			httpStatus: http.StatusServiceUnavailable,
+			expectedBody: model.HealthResponse{
+				Status: util.HealthStatusUnavailable,
+				Checks: map[string]model.HealthCheck{
+					"database":   {Status: util.HealthStatusOk},
+					"migrations": {Status: util.HealthStatusUnavailable, Error: "table expression does not exist"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := HealthHandler{
+				ExpressionRepository: &tc.databaseMock,
+				ExpressionCache:      tc.cache,
+			}
+
+			r := chi.NewRouter()
+			r.Get("/readyz", handler.Readiness)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			response, _ := http.Get(ts.URL + "/readyz")
+
+			var parsedResponse model.HealthResponse
+			_ = json.NewDecoder(response.Body).Decode(&parsedResponse)
+
+			assert.Equal(t, tc.httpStatus, response.StatusCode)
+			assert.Equal(t, tc.expectedBody, parsedResponse)
+		})
+	}
+}
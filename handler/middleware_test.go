@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/logging"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/metrics"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Metrics)
+	r.Get("/expressions/{expressionId}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	counter := metrics.HTTPRequestsTotal.WithLabelValues("/expressions/{expressionId}", http.MethodGet, "418")
+	histogram := metrics.HTTPRequestDuration.WithLabelValues("/expressions/{expressionId}", http.MethodGet)
+	unmatched := metrics.HTTPRequestsTotal.WithLabelValues("unmatched", http.MethodGet, "404")
+	requestsBefore := testutil.ToFloat64(counter)
+	observationsBefore := sampleCount(t, histogram)
+	unmatchedBefore := testutil.ToFloat64(unmatched)
+
+	for _, path := range []string{"/expressions/1", "/expressions/2", "/unknown"} {
+		response, err := http.Get(ts.URL + path)
+		assert.NoError(t, err)
+		_ = response.Body.Close()
+	}
+
+	assert.Equal(t, requestsBefore+2, testutil.ToFloat64(counter), "requests should be counted by route pattern, not raw path")
+	assert.Equal(t, observationsBefore+2, sampleCount(t, histogram))
+	assert.Equal(t, unmatchedBefore+1, testutil.ToFloat64(unmatched))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.HTTPRequestsTotal.WithLabelValues("/expressions/1", http.MethodGet, "418")))
+}
+
+func sampleCount(t *testing.T, observer prometheus.Observer) uint64 {
+	var metric dto.Metric
+	assert.NoError(t, observer.(prometheus.Metric).Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	r := chi.NewRouter()
+	r.Use(Tracing)
+	r.Get("/expressions/{expressionId}", func(w http.ResponseWriter, r *http.Request) {})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	traceId := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/expressions/1", nil)
+	req.Header.Set("traceparent", "00-"+traceId+"-00f067aa0ba902b7-01")
+
+	response, _ := http.DefaultClient.Do(req)
+
+	spans := recorder.Ended()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "GET /expressions/{expressionId}", spans[0].Name())
+	assert.Equal(t, traceId, spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	assert.True(t, strings.Contains(response.Header.Get("traceparent"), traceId), "trace context should be returned to the caller")
+}
+
+func TestRequestLogger(t *testing.T) {
+	testCases := []struct {
+		name              string
+		requestId         string
+		expectedRequestId string
+	}{
+		{
+			name:              "should echo the request id sent by the caller",
+			requestId:         "abc-123",
+			expectedRequestId: "abc-123",
+		},
+		{
+			name:      "should generate a request id when none is sent",
+			requestId: "",
+		},
+		{
+			name:      "should replace an invalid request id",
+			requestId: "abc\n123",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var loggedFields log.Fields
+
+			r := chi.NewRouter()
+			r.Use(RequestLogger)
+			r.Get("/expressions", func(w http.ResponseWriter, r *http.Request) {
+				loggedFields = logging.FromContext(r.Context()).Data
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/expressions", nil)
+			req.Header.Set(RequestIdHeader, tc.requestId)
+			req.SetBasicAuth("testeUser", "testePassword")
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			requestId := w.Header().Get(RequestIdHeader)
+			if tc.expectedRequestId != "" {
+				assert.Equal(t, tc.expectedRequestId, requestId)
+			} else {
+				assert.Len(t, requestId, 32)
+			}
+			assert.Equal(t, log.Fields{logging.FieldRequestId: requestId}, loggedFields, "unchecked credentials should not be logged")
+		})
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	testCases := []struct {
+		name       string
+		user       string
+		password   string
+		httpStatus int
+	}{
+		{
+			name:       "should return 200, valid credentials",
+			user:       "testeUser",
+			password:   "testePassword",
+			httpStatus: http.StatusOK,
+		},
+		{
+			name:       "should return 401, wrong password",
+			user:       "testeUser",
+			password:   "wrong",
+			httpStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "should return 401, unknown user",
+			user:       "someone",
+			password:   "",
+			httpStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			r.Use(BasicAuth("", map[string]string{"testeUser": "testePassword"}))
+			var loggedUser interface{}
+			r.Get("/expressions", func(w http.ResponseWriter, r *http.Request) {
+				loggedUser = logging.FromContext(r.Context()).Data[logging.FieldUser]
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/expressions", nil)
+			req.SetBasicAuth(tc.user, tc.password)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.httpStatus, w.Code)
+			if tc.httpStatus == http.StatusUnauthorized {
+				var parsedResponse model.ErrorResponse
+				_ = json.NewDecoder(w.Body).Decode(&parsedResponse)
+				assert.Equal(t, util.CodeUnauthorized, parsedResponse.Error.Code)
+				assert.Nil(t, loggedUser)
+			} else {
+				assert.Equal(t, tc.user, loggedUser)
+			}
+		})
+	}
+}
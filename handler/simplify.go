@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/logging"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"net/http"
+	"strconv"
+)
+
+const (
+	formSimplified = "simplified"
+	formDNF        = "dnf"
+	formCNF        = "cnf"
+)
+
+// SimplifyExpression returns the simplified, DNF and CNF forms of a stored
+// expression. On POST the form chosen with ?form= (simplified by default) is
+// also saved as the next version of the expression, unless it was updated
+// since it was read.
+func (eh *ExpressionHandler) SimplifyExpression(w http.ResponseWriter, r *http.Request) {
+	params := GetURLParams(r)
+	expressionId := params["expressionId"]
+
+	ctx, logger := logging.WithFields(r.Context(), log.Fields{logging.FieldExpressionId: expressionId})
+
+	expressionIdAsInt, err := strconv.Atoi(expressionId)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, util.CodeInvalidExpressionId, util.ErrParsingExpressionId)
+		logger.WithField("err", err.Error()).Error("error parsing expressionId to int")
+		return
+	}
+
+	form := r.URL.Query().Get("form")
+	if form == "" {
+		form = formSimplified
+	}
+	if form != formSimplified && form != formDNF && form != formCNF {
+		writeError(w, http.StatusBadRequest, util.CodeValidationFailed, util.ErrInvalidQuery,
+			model.ErrorDetail{Field: "form", Message: "must be one of simplified, dnf or cnf"})
+		logger.WithField("form", form).Error("unsupported simplification form")
+		return
+	}
+
+	expression, err := eh.ExpressionRepository.GetExpressionById(ctx, expressionIdAsInt)
+	if err != nil {
+		writeErrorFor(w, err)
+		logger.WithField("err", err.Error()).Error("error recovering expression from database")
+		return
+	}
+
+	simplification, err := eh.ExpressionService.Simplify(ctx, expression)
+	if err != nil {
+		writeErrorFor(w, err)
+		logger.WithField("err", err.Error()).Error("error simplifying expression")
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		definition := map[string]string{
+			formSimplified: simplification.Simplified,
+			formDNF:        simplification.DNF,
+			formCNF:        simplification.CNF,
+		}[form]
+
+		saved, err := eh.ExpressionService.SaveSimplification(ctx, expression, definition)
+		if err != nil {
+			writeErrorFor(w, err)
+			logger.WithField("err", err.Error()).Error("Error updating expression")
+			return
+		}
+		simplification.Version = saved.Version
+		logger.WithField("version", saved.Version).Info("simplified expression saved successfully")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(simplification); err != nil {
+		writeError(w, http.StatusInternalServerError, util.CodeInternal, util.ErrEncodingResponse)
+		logger.WithField("err", err.Error()).Error("error encoding response")
+		return
+	}
+}
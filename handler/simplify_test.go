@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSimplifyExpression(t *testing.T) {
+	simplification := model.Simplification{
+		ExpressionId: 10,
+		Definition:   "(a and b) or (a and not b) or c",
+		Simplified:   "a OR c",
+		DNF:          "a OR c",
+		CNF:          "a OR c",
+	}
+
+	testCases := []struct {
+		name            string
+		databaseMock    repository.Stub
+		method          string
+		query           string
+		httpStatus      int
+		expectedBody    model.Simplification
+		expectedSavedBy map[string]any
+	}{
+		{
+			name: "should return 200 without saving on GET",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: simplification.Definition},
+			},
+			method:       http.MethodGet,
+			httpStatus:   http.StatusOK,
+			expectedBody: simplification,
+		},
+		{
+			name: "should return 200 and save the next version on POST",
+			databaseMock: repository.Stub{
+				Expressions: []model.Expression{
+					{ID: 10, Name: "isEligible", Definition: simplification.Definition, MissingVariables: model.MissingVariablesFalse, Version: 2},
+				},
+			},
+			method:     http.MethodPost,
+			query:      "?form=cnf",
+			httpStatus: http.StatusOK,
+			expectedBody: model.Simplification{
+				ExpressionId: 10,
+				Definition:   simplification.Definition,
+				Simplified:   "a OR c",
+				DNF:          "a OR c",
+				CNF:          "a OR c",
+				Version:      3,
+			},
+			expectedSavedBy: map[string]any{
+				"expressionId":     10,
+				"name":             "isEligible",
+				"definition":       "a OR c",
+				"missingVariables": model.MissingVariablesFalse,
+				"dialect":          model.DialectNative,
+				"version":          2,
+				"references":       []model.Reference(nil),
+			},
+		},
+		{
+			name: "should return 409, expression updated since it was read",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: simplification.Definition, Version: 2},
+				SaveExpressionError:       repository.ErrVersionConflict,
+			},
+			method:     http.MethodPost,
+			httpStatus: http.StatusConflict,
+			expectedSavedBy: map[string]any{
+				"expressionId":     10,
+				"name":             "",
+				"definition":       "a OR c",
+				"missingVariables": model.MissingVariablePolicy(""),
+				"dialect":          model.DialectNative,
+				"version":          2,
+				"references":       []model.Reference(nil),
+			},
+		},
+		{
+			name: "should return 422 without saving, expression references another",
+			databaseMock: repository.Stub{
+				Expressions: []model.Expression{
+					{ID: 1, Name: "isActive", Definition: "a and b"},
+					{ID: 10, Definition: "(@isActive and c) or (@isActive and not c)", Version: 2},
+				},
+			},
+			method:     http.MethodPost,
+			httpStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "should return 400, unsupported form",
+			databaseMock: repository.Stub{},
+			method:       http.MethodPost,
+			query:        "?form=anf",
+			httpStatus:   http.StatusBadRequest,
+		},
+		{
+			name: "should return 422, variables are not booleans",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: "a > 1"},
+			},
+			method:     http.MethodGet,
+			httpStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := ExpressionHandler{
+				ExpressionService:    service.ExpressionService{Source: &tc.databaseMock, Store: &tc.databaseMock},
+				ExpressionRepository: &tc.databaseMock,
+			}
+
+			r := chi.NewRouter()
+			r.Get("/expressions/{expressionId}/simplify", handler.SimplifyExpression)
+			r.Post("/expressions/{expressionId}/simplify", handler.SimplifyExpression)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			request, _ := http.NewRequest(tc.method, ts.URL+"/expressions/10/simplify"+tc.query, nil)
+			response, _ := http.DefaultClient.Do(request)
+
+			var parsedResponse model.Simplification
+			_ = json.NewDecoder(response.Body).Decode(&parsedResponse)
+
+			assert.Equal(t, tc.httpStatus, response.StatusCode)
+			assert.Equal(t, tc.expectedBody, parsedResponse)
+			assert.Equal(t, tc.expectedSavedBy, tc.databaseMock.SaveExpressionCalledWith)
+			assert.Nil(t, tc.databaseMock.CreateExpressionCalledWith, "simplifying should never create an expression")
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/logging"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+func (eh *ExpressionHandler) GetTruthTable(w http.ResponseWriter, r *http.Request) {
+	params := GetURLParams(r)
+	expressionId := params["expressionId"]
+
+	ctx, logger := logging.WithFields(r.Context(), log.Fields{logging.FieldExpressionId: expressionId})
+
+	expressionIdAsInt, err := strconv.Atoi(expressionId)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, util.CodeInvalidExpressionId, util.ErrParsingExpressionId)
+		logger.WithField("err", err.Error()).Error("error parsing expressionId to int")
+		return
+	}
+
+	format, ok := responseFormat(r, formatCSV, "text/csv")
+	if !ok {
+		writeError(w, http.StatusBadRequest, util.CodeValidationFailed, util.ErrInvalidQuery,
+			model.ErrorDetail{Field: "format", Message: "must be one of json or csv"})
+		logger.WithField("format", r.URL.Query().Get("format")).Error("unsupported truth table format")
+		return
+	}
+
+	expression, err := eh.ExpressionRepository.GetExpressionById(ctx, expressionIdAsInt)
+	if err != nil {
+		writeErrorFor(w, err)
+		logger.WithField("err", err.Error()).Error("error recovering expression from database")
+		return
+	}
+
+	table, err := eh.ExpressionService.TruthTable(ctx, expression)
+	if err != nil {
+		writeErrorFor(w, err)
+		logger.WithField("err", err.Error()).Error("error building truth table")
+		return
+	}
+
+	if format == formatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		err = writeTruthTableCSV(w, table)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(table)
+	}
+	if err != nil {
+		logger.WithField("err", err.Error()).Error("error encoding response")
+		return
+	}
+
+	logger.WithField("rows", len(table.Rows)).Info("truth table built successfully")
+}
+
+// responseFormat picks JSON or the alternative format from the format query
+// parameter, falling back to the Accept header and then to JSON.
+func responseFormat(r *http.Request, alternative, mediaType string) (string, bool) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format, format == formatJSON || format == alternative
+	}
+	if strings.Contains(r.Header.Get("Accept"), mediaType) {
+		return alternative, true
+	}
+	return formatJSON, true
+}
+
+// writeTruthTableCSV writes one column per variable followed by the result.
+func writeTruthTableCSV(w http.ResponseWriter, table model.TruthTable) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(append(append([]string{}, table.Variables...), "result")); err != nil {
+		return err
+	}
+
+	for _, row := range table.Rows {
+		record := make([]string, 0, len(table.Variables)+1)
+		for _, name := range table.Variables {
+			record = append(record, strconv.FormatBool(row.Values[name]))
+		}
+		record = append(record, strconv.FormatBool(row.Result))
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/service"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetTruthTable(t *testing.T) {
+	testCases := []struct {
+		name         string
+		databaseMock repository.Stub
+		path         string
+		accept       string
+		httpStatus   int
+		contentType  string
+		expectedBody string
+	}{
+		{
+			name: "should return 200 with json by default",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: "x or y"},
+			},
+			path:        "/expressions/10/truth-table",
+			httpStatus:  http.StatusOK,
+			contentType: "application/json",
+			expectedBody: `{"expressionId":10,"definition":"x or y","variables":["x","y"],"rows":[` +
+				`{"values":{"x":false,"y":false},"result":false},` +
+				`{"values":{"x":false,"y":true},"result":true},` +
+				`{"values":{"x":true,"y":false},"result":true},` +
+				`{"values":{"x":true,"y":true},"result":true}]}` + "\n",
+		},
+		{
+			name: "should return 200 with csv when requested in the query",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: "x and y"},
+			},
+			path:         "/expressions/10/truth-table?format=csv",
+			httpStatus:   http.StatusOK,
+			contentType:  "text/csv; charset=utf-8",
+			expectedBody: "x,y,result\nfalse,false,false\nfalse,true,false\ntrue,false,false\ntrue,true,true\n",
+		},
+		{
+			name: "should return 200 with csv when accepted",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: "not x"},
+			},
+			path:         "/expressions/10/truth-table",
+			accept:       "text/csv",
+			httpStatus:   http.StatusOK,
+			contentType:  "text/csv; charset=utf-8",
+			expectedBody: "x,result\nfalse,true\ntrue,false\n",
+		},
+		{
+			name:         "should return 400, unsupported format",
+			databaseMock: repository.Stub{},
+			path:         "/expressions/10/truth-table?format=xml",
+			httpStatus:   http.StatusBadRequest,
+			contentType:  "application/json",
+		},
+		{
+			name: "should return 422, variables are not booleans",
+			databaseMock: repository.Stub{
+				GetExpressionByIdResponse: model.Expression{ID: 10, Definition: "age > 18"},
+			},
+			path:        "/expressions/10/truth-table",
+			httpStatus:  http.StatusUnprocessableEntity,
+			contentType: "application/json",
+		},
+		{
+			name: "should return 404, expression not found",
+			databaseMock: repository.Stub{
+				GetExpressionByIdError: repository.ErrExpressionNotFound,
+			},
+			path:        "/expressions/10/truth-table",
+			httpStatus:  http.StatusNotFound,
+			contentType: "application/json",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := ExpressionHandler{
+				ExpressionService:    service.ExpressionService{},
+				ExpressionRepository: &tc.databaseMock,
+			}
+
+			r := chi.NewRouter()
+			r.Get("/expressions/{expressionId}/truth-table", handler.GetTruthTable)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			request, _ := http.NewRequest(http.MethodGet, ts.URL+tc.path, nil)
+			if tc.accept != "" {
+				request.Header.Set("Accept", tc.accept)
+			}
+			response, _ := http.DefaultClient.Do(request)
+			body, _ := ioutil.ReadAll(response.Body)
+
+			assert.Equal(t, tc.httpStatus, response.StatusCode)
+			assert.Equal(t, tc.contentType, response.Header.Get("Content-Type"))
+			if tc.expectedBody != "" {
+				assert.Equal(t, tc.expectedBody, string(body))
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+)
+
+type contextKey struct{}
+
+const (
+	FieldRequestId    = "requestId"
+	FieldUser         = "user"
+	FieldExpressionId = "expressionId"
+)
+
+// WithLogger returns a copy of ctx carrying logger, so every layer handling
+// the request logs with the same fields.
+func WithLogger(ctx context.Context, logger *log.Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the request-scoped logger stored in ctx, or an entry of
+// the standard logger when none was stored.
+func FromContext(ctx context.Context) *log.Entry {
+	if logger, ok := ctx.Value(contextKey{}).(*log.Entry); ok {
+		return logger
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// WithFields adds fields to the logger stored in ctx and returns the new
+// context together with the enriched logger.
+func WithFields(ctx context.Context, fields log.Fields) (context.Context, *log.Entry) {
+	logger := FromContext(ctx).WithFields(fields)
+	return WithLogger(ctx, logger), logger
+}
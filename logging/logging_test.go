@@ -0,0 +1,20 @@
+package logging
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFromContext(t *testing.T) {
+	logger := FromContext(context.Background())
+	assert.Equal(t, log.StandardLogger(), logger.Logger, "should fall back to the standard logger")
+	assert.Empty(t, logger.Data)
+
+	ctx := WithLogger(context.Background(), log.WithField(FieldRequestId, "abc"))
+	ctx, logger = WithFields(ctx, log.Fields{FieldExpressionId: 10})
+
+	assert.Equal(t, log.Fields{FieldRequestId: "abc", FieldExpressionId: 10}, logger.Data)
+	assert.Equal(t, logger, FromContext(ctx))
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+const namespace = "expression_evaluator"
+
+const (
+	EvaluationResultTrue    = "true"
+	EvaluationResultFalse   = "false"
+	EvaluationResultError   = "error"
+	EvaluationResultUnknown = "unknown"
+)
+
+var (
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests handled, by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests, by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	EvaluationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "evaluations_total",
+		Help:      "Number of expression evaluations, by expression id and result (true, false, unknown or error).",
+	}, []string{"expression_id", "result"})
+
+	ParseFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "parse_failures_total",
+		Help:      "Number of expression definitions that failed to parse.",
+	})
+
+	RepositoryQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "repository_query_duration_seconds",
+		Help:      "Latency of repository queries, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	CacheHitsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_hits_total",
+		Help:      "Number of compiled expression cache hits.",
+	})
+
+	CacheMissesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_misses_total",
+		Help:      "Number of compiled expression cache misses.",
+	})
+
+	CacheEvictionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_evictions_total",
+		Help:      "Number of compiled expressions evicted from the cache.",
+	})
+
+	CacheEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_entries",
+		Help:      "Number of compiled expressions currently cached.",
+	})
+)
+
+// ObserveRepositoryQuery records the time elapsed since start for a repository
+// operation. It is meant to be deferred at the top of each repository method.
+func ObserveRepositoryQuery(operation string, start time.Time) {
+	RepositoryQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
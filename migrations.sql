@@ -0,0 +1,40 @@
+-- Changes to the expression table since init.sql. Every statement can run
+-- again, so the file can be applied to any existing database.
+
+alter table expression add column if not exists missing_variables varchar(16) not null default 'error';
+
+alter table expression add column if not exists name varchar(128) not null default '';
+create unique index if not exists expression_name_key on expression (name) where name <> '';
+
+alter table expression add column if not exists dialect varchar(16) not null default 'native';
+
+create table if not exists expression_reference
+(
+    expression_id int not null
+        constraint expression_reference_expression_id_fkey
+            references expression (id) on delete cascade,
+    referenced_id int not null
+        constraint expression_reference_referenced_id_fkey
+            references expression (id),
+    referenced_name varchar(128) not null default '',
+    constraint expression_reference_pkey
+        primary key (expression_id, referenced_id, referenced_name)
+);
+create index if not exists expression_reference_referenced_id_key on expression_reference (referenced_id);
+
+alter table expression add column if not exists version int not null default 1;
+
+create table if not exists expression_version
+(
+    expression_id int not null
+        constraint expression_version_expression_id_fkey
+            references expression (id) on delete cascade,
+    version int not null,
+    name varchar(128) not null default '',
+    definition varchar(255) not null,
+    missing_variables varchar(16) not null default 'error',
+    dialect varchar(16) not null default 'native',
+    replaced_at timestamptz not null default now(),
+    constraint expression_version_pkey
+        primary key (expression_id, version)
+);
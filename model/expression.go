@@ -1,10 +1,227 @@
 package model
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
+// Expression is a stored definition. Version counts its updates, starting at
+// 1; an update carrying a Version is refused when the expression has changed
+// since that version.
 type Expression struct {
-	ID         int    `gorm:"column:id" json:"id"`
-	Definition string `gorm:"column:definition" json:"definition"`
+	ID               int                   `gorm:"column:id" json:"id"`
+	Name             string                `gorm:"column:name" json:"name,omitempty"`
+	Definition       string                `gorm:"column:definition" json:"definition"`
+	MissingVariables MissingVariablePolicy `gorm:"column:missing_variables" json:"missingVariables,omitempty"`
+	Dialect          Dialect               `gorm:"column:dialect" json:"dialect,omitempty"`
+	Version          int                   `gorm:"column:version" json:"version,omitempty"`
+	Variables        []Variable            `gorm:"-" json:"variables,omitempty"`
+}
+
+// ExpressionUpdate changes a stored expression. A nil Name, MissingVariables
+// or Dialect keeps the stored one, and a Version refuses the update when the expression has changed
+// since that version.
+type ExpressionUpdate struct {
+	ID               int
+	Definition       string
+	Name             *string
+	MissingVariables *MissingVariablePolicy
+	Dialect          *Dialect
+	Version          int
+}
+
+// Apply returns the stored expression with the update applied.
+func (u ExpressionUpdate) Apply(stored Expression) Expression {
+	expression := stored
+	expression.ID = u.ID
+	expression.Definition = u.Definition
+	if u.Name != nil {
+		expression.Name = *u.Name
+	}
+	if u.MissingVariables != nil {
+		expression.MissingVariables = *u.MissingVariables
+	}
+	if u.Dialect != nil {
+		expression.Dialect = *u.Dialect
+	}
+	if u.Version != 0 {
+		expression.Version = u.Version
+	}
+	expression.Variables = nil
+	return expression
+}
+
+// ExpressionVersion is an expression as it was before an update replaced it.
+type ExpressionVersion struct {
+	Version          int                   `json:"version"`
+	Name             string                `json:"name,omitempty"`
+	Definition       string                `json:"definition"`
+	MissingVariables MissingVariablePolicy `json:"missingVariables,omitempty"`
+	Dialect          Dialect               `json:"dialect,omitempty"`
+	ReplacedAt       time.Time             `json:"replacedAt"`
+}
+
+// VersionsResponse lists the previous versions of an expression, oldest
+// first, along with its current version.
+type VersionsResponse struct {
+	ExpressionId int                 `json:"expressionId"`
+	Version      int                 `json:"version"`
+	Versions     []ExpressionVersion `json:"versions"`
+}
+
+// Variable is a value a definition needs, with the type inferred from how the
+// definition uses it: boolean, number, string or any.
+type Variable struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Function documents a function definitions can call. When Variadic the last
+// parameter may be repeated.
+type Function struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Parameters  []string `json:"parameters"`
+	Variadic    bool     `json:"variadic"`
+	Returns     string   `json:"returns"`
+}
+
+type FunctionsResponse struct {
+	Functions []Function `json:"functions"`
+}
+
+// TruthTable lists the result of an expression for every assignment of its
+// variables, in binary counting order starting from all false.
+type TruthTable struct {
+	ExpressionId int             `json:"expressionId"`
+	Definition   string          `json:"definition"`
+	Variables    []string        `json:"variables"`
+	Rows         []TruthTableRow `json:"rows"`
+}
+
+type TruthTableRow struct {
+	Values map[string]bool `json:"values"`
+	Result bool            `json:"result"`
+}
+
+// Analysis classifies a boolean expression. Witness is an assignment making it
+// true and Counterexample one making it false; each is null when none exists.
+type Analysis struct {
+	Satisfiable    bool            `json:"satisfiable"`
+	Tautology      bool            `json:"tautology"`
+	Contradiction  bool            `json:"contradiction"`
+	Witness        map[string]bool `json:"witness"`
+	Counterexample map[string]bool `json:"counterexample"`
+}
+
+// Equivalence tells whether two expressions always agree. Counterexample is
+// an assignment where they differ, with the result of each, or null.
+type Equivalence struct {
+	Equivalent     bool            `json:"equivalent"`
+	Counterexample *Counterexample `json:"counterexample"`
+}
+
+type Counterexample struct {
+	Values map[string]bool `json:"values"`
+	Left   bool            `json:"left"`
+	Right  bool            `json:"right"`
+}
+
+// Simplification holds equivalent rewrites of a boolean expression. Version
+// is set when the rewrite was saved as a new version of the expression.
+type Simplification struct {
+	ExpressionId int    `json:"expressionId"`
+	Definition   string `json:"definition"`
+	Simplified   string `json:"simplified"`
+	DNF          string `json:"dnf"`
+	CNF          string `json:"cnf"`
+	Version      int    `json:"version,omitempty"`
+}
+
+// DependencyGraph lists every expression with the expressions it references
+// and is referenced by, directly, and the variables it uses directly.
+type DependencyGraph struct {
+	Expressions []DependencyNode `json:"expressions"`
+}
+
+type DependencyNode struct {
+	ID                   int      `json:"id"`
+	Name                 string   `json:"name,omitempty"`
+	References           []int    `json:"references"`
+	Dependents           []int    `json:"dependents"`
+	Variables            []string `json:"variables"`
+	UnresolvedReferences []string `json:"unresolvedReferences,omitempty"`
+	Error                string   `json:"error,omitempty"`
+}
+
+// Reference is a reference from one expression to another. Name is set when
+// the definition refers to it by name, as in @isActive, and empty for @42.
+type Reference struct {
+	ID   int    `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+type Warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// SaveResponse is returned by create and update. Analysis is omitted for
+// definitions that are not purely boolean.
+type SaveResponse struct {
+	ExpressionId int       `json:"expressionId,omitempty"`
+	Version      int       `json:"version,omitempty"`
+	Analysis     *Analysis `json:"analysis,omitempty"`
+	Warnings     []Warning `json:"warnings,omitempty"`
+}
+
+type VariablesResponse struct {
+	ExpressionId int        `json:"expressionId"`
+	Variables    []Variable `json:"variables"`
+}
+
+// MissingVariablePolicy decides what an evaluation does with variables the
+// definition references but the request does not provide.
+type MissingVariablePolicy string
+
+const (
+	// MissingVariablesError fails the evaluation. It is the default.
+	MissingVariablesError MissingVariablePolicy = "error"
+	// MissingVariablesFalse treats missing variables as false.
+	MissingVariablesFalse MissingVariablePolicy = "false"
+	// MissingVariablesUnknown applies Kleene three-valued logic: the outcome is
+	// unknown only when it depends on a missing variable.
+	MissingVariablesUnknown MissingVariablePolicy = "unknown"
+)
+
+func (p MissingVariablePolicy) IsValid() bool {
+	switch p {
+	case MissingVariablesError, MissingVariablesFalse, MissingVariablesUnknown:
+		return true
+	default:
+		return false
+	}
+}
+
+// Dialect is the language a definition is written in.
+type Dialect string
+
+const (
+	// DialectNative is the rule language of this API. It is the default.
+	DialectNative Dialect = "native"
+	// DialectGovaluate is the syntax of github.com/Knetic/govaluate.
+	DialectGovaluate Dialect = "govaluate"
+	// DialectCEL is a subset of the Common Expression Language.
+	DialectCEL Dialect = "cel"
+)
+
+func (d Dialect) IsValid() bool {
+	switch d {
+	case DialectNative, DialectGovaluate, DialectCEL:
+		return true
+	default:
+		return false
+	}
 }
 
 func (f Expression) String() string {
@@ -17,7 +234,56 @@ func (Expression) TableName() string {
 }
 
 type Response struct {
-	Definition string `json:"definition"`
-	Values     string `json:"values"`
-	Result     bool   `json:"result"`
+	Definition  string       `json:"definition"`
+	Values      string       `json:"values"`
+	Result      bool         `json:"result"`
+	Outcome     Outcome      `json:"outcome"`
+	Explanation *Explanation `json:"explanation,omitempty"`
+}
+
+// Outcome extends the boolean result with the unknown value of three-valued
+// logic. Result is false whenever Outcome is unknown.
+type Outcome string
+
+const (
+	OutcomeTrue    Outcome = "true"
+	OutcomeFalse   Outcome = "false"
+	OutcomeUnknown Outcome = "unknown"
+)
+
+// Explanation is the value of one sub-expression of an evaluated definition.
+// Value is null when the sub-expression was short-circuited or failed.
+type Explanation struct {
+	Expression     string        `json:"expression"`
+	Operator       string        `json:"operator,omitempty"`
+	Value          any           `json:"value"`
+	ShortCircuited bool          `json:"shortCircuited,omitempty"`
+	Error          string        `json:"error,omitempty"`
+	Operands       []Explanation `json:"operands,omitempty"`
+}
+
+type HealthCheck struct {
+	Status  string         `json:"status"`
+	Error   string         `json:"error,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+type ErrorDetail struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type Error struct {
+	Code    string        `json:"code"`
+	Message string        `json:"message"`
+	Details []ErrorDetail `json:"details,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error Error `json:"error"`
 }
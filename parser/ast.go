@@ -0,0 +1,339 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Operator string
+
+const (
+	OpIff     Operator = "IFF"
+	OpImplies Operator = "IMPLIES"
+	OpOr      Operator = "OR"
+	OpXor     Operator = "XOR"
+	OpAnd     Operator = "AND"
+	OpNot     Operator = "NOT"
+	OpEq      Operator = "=="
+	OpNeq     Operator = "!="
+	OpLt      Operator = "<"
+	OpLte     Operator = "<="
+	OpGt      Operator = ">"
+	OpGte     Operator = ">="
+	// OpIn tests whether the left side is an element of the list on the right,
+	// OpContains whether the list on the left has the right side as an element.
+	OpIn       Operator = "IN"
+	OpContains Operator = "CONTAINS"
+	// OpAnyIn and OpAllIn compare two lists: whether any, or all, elements of
+	// the left list are in the right one. They are written "ANY a IN b".
+	OpAnyIn Operator = "ANY IN"
+	OpAllIn Operator = "ALL IN"
+	// OpMatches tests the string on the left against the regular expression
+	// on the right, also written =~.
+	OpMatches Operator = "MATCHES"
+	OpAdd     Operator = "+"
+	OpSub     Operator = "-"
+	OpMul     Operator = "*"
+	OpDiv     Operator = "/"
+	OpMod     Operator = "%"
+	OpNeg     Operator = "NEG"
+)
+
+// Precedence levels, from loosest to tightest binding. NOT binds looser than
+// comparisons so that "not x > 5" reads as "not (x > 5)".
+const (
+	precedenceIff = iota + 1
+	precedenceImplies
+	precedenceOr
+	precedenceXor
+	precedenceAnd
+	precedenceNot
+	precedenceComparison
+	precedenceAdditive
+	precedenceMultiplicative
+	precedenceNeg
+	precedencePrimary
+)
+
+func (op Operator) precedence() int {
+	switch op {
+	case OpIff:
+		return precedenceIff
+	case OpImplies:
+		return precedenceImplies
+	case OpOr:
+		return precedenceOr
+	case OpXor:
+		return precedenceXor
+	case OpAnd:
+		return precedenceAnd
+	case OpNot:
+		return precedenceNot
+	case OpEq, OpNeq, OpLt, OpLte, OpGt, OpGte, OpIn, OpContains, OpAnyIn, OpAllIn, OpMatches:
+		return precedenceComparison
+	case OpAdd, OpSub:
+		return precedenceAdditive
+	case OpMul, OpDiv, OpMod:
+		return precedenceMultiplicative
+	case OpNeg:
+		return precedenceNeg
+	default:
+		return precedencePrimary
+	}
+}
+
+// IsLogical reports whether the operator combines boolean operands.
+func (op Operator) IsLogical() bool {
+	switch op {
+	case OpIff, OpImplies, OpOr, OpXor, OpAnd, OpNot:
+		return true
+	default:
+		return false
+	}
+}
+
+// Node is an element of the syntax tree produced by Parse. String renders the
+// node back in the rule language with the minimum parentheses needed.
+type Node interface {
+	String() string
+	precedence() int
+}
+
+type Literal struct {
+	Value any
+}
+
+// Variable is a value supplied when evaluating. Its name may be a path into
+// nested values, such as user.country or items[0].price.
+type Variable struct {
+	Name string
+}
+
+// PathSegment is a step of a variable path: a field, or an index into a list
+// when IsIndex.
+type PathSegment struct {
+	Field   string
+	Index   int
+	IsIndex bool
+}
+
+// Path splits the name into its segments: items[0].price is the field items,
+// the index 0 and the field price. A plain name is a single field.
+func (v *Variable) Path() []PathSegment {
+	var segments []PathSegment
+	field := strings.Builder{}
+	flush := func() {
+		if field.Len() > 0 {
+			segments = append(segments, PathSegment{Field: field.String()})
+			field.Reset()
+		}
+	}
+
+	for i := 0; i < len(v.Name); i++ {
+		switch c := v.Name[i]; c {
+		case '.':
+			flush()
+		case '[':
+			flush()
+			end := strings.IndexByte(v.Name[i:], ']') + i
+			index, _ := strconv.Atoi(v.Name[i+1 : end])
+			segments = append(segments, PathSegment{Index: index, IsIndex: true})
+			i = end
+		default:
+			field.WriteByte(c)
+		}
+	}
+	flush()
+	return segments
+}
+
+// Reference stands for another expression, named by Target: its name, or its
+// id when Target is all digits.
+type Reference struct {
+	Target string
+}
+
+// ID returns the id a reference is written with, if any.
+func (r *Reference) ID() (int, bool) {
+	id, err := strconv.Atoi(r.Target)
+	return id, err == nil && id > 0
+}
+
+// Regex is a regular expression literal, the right side of MATCHES. The
+// pattern is compiled when the definition is parsed.
+type Regex struct {
+	Pattern string
+	Flags   string
+
+	compiled *regexp.Regexp
+}
+
+// regexFlags are the RE2 flags a regular expression literal accepts.
+const regexFlags = "imsU"
+
+func newRegex(pattern, flags string) (*Regex, error) {
+	for _, flag := range flags {
+		if !strings.ContainsRune(regexFlags, flag) {
+			return nil, fmt.Errorf("unknown regular expression flag %q", flag)
+		}
+	}
+
+	source := pattern
+	if flags != "" {
+		source = "(?" + flags + ")" + pattern
+	}
+	compiled, err := regexp.Compile(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %s", err)
+	}
+	return &Regex{Pattern: pattern, Flags: flags, compiled: compiled}, nil
+}
+
+// Regexp returns the compiled regular expression.
+func (r *Regex) Regexp() *regexp.Regexp {
+	return r.compiled
+}
+
+// List is a list literal. Its elements may be any expression.
+type List struct {
+	Elements []Node
+}
+
+// Call applies a function to its arguments. Function is nil until the call is
+// bound to an implementation; the parser only records the name.
+type Call struct {
+	Name     string
+	Args     []Node
+	Function *Function
+}
+
+// Function describes a function definitions can call: the types of its
+// parameters, the last of which may repeat when Variadic, the type it
+// returns, and its implementation, which receives the evaluated arguments.
+type Function struct {
+	Name        string
+	Description string
+	Parameters  []Type
+	Variadic    bool
+	Returns     Type
+	Call        func(args ...interface{}) (interface{}, error)
+}
+
+type Unary struct {
+	Operator Operator
+	Operand  Node
+}
+
+type Binary struct {
+	Operator Operator
+	Left     Node
+	Right    Node
+}
+
+func (l *Literal) precedence() int   { return precedencePrimary }
+func (v *Variable) precedence() int  { return precedencePrimary }
+func (r *Reference) precedence() int { return precedencePrimary }
+func (c *Call) precedence() int      { return precedencePrimary }
+func (l *List) precedence() int      { return precedencePrimary }
+func (r *Regex) precedence() int     { return precedencePrimary }
+func (u *Unary) precedence() int     { return u.Operator.precedence() }
+func (b *Binary) precedence() int    { return b.Operator.precedence() }
+
+func (l *Literal) String() string {
+	switch value := l.Value.(type) {
+	case bool:
+		if value {
+			return "TRUE"
+		}
+		return "FALSE"
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case string:
+		return strconv.Quote(value)
+	default:
+		return "?"
+	}
+}
+
+func (v *Variable) String() string {
+	return v.Name
+}
+
+func (r *Reference) String() string {
+	return "@" + r.Target
+}
+
+func (c *Call) String() string {
+	return c.Name + "(" + join(c.Args) + ")"
+}
+
+func (r *Regex) String() string {
+	return "/" + strings.ReplaceAll(r.Pattern, "/", `\/`) + "/" + r.Flags
+}
+
+func (l *List) String() string {
+	return "[" + join(l.Elements) + "]"
+}
+
+func join(nodes []Node) string {
+	rendered := make([]string, len(nodes))
+	for i, node := range nodes {
+		rendered[i] = node.String()
+	}
+	return strings.Join(rendered, ", ")
+}
+
+func (u *Unary) String() string {
+	if u.Operator == OpNeg {
+		return "-" + wrap(u.Operand, u.Operand.precedence() < precedencePrimary)
+	}
+	return string(u.Operator) + " " + wrap(u.Operand, u.Operand.precedence() < u.precedence())
+}
+
+func (b *Binary) String() string {
+	precedence := b.precedence()
+	leftParens := b.Left.precedence() < precedence
+	rightParens := b.Right.precedence() <= precedence
+
+	switch b.Operator {
+	case OpImplies:
+		// right associative: a -> b -> c is a -> (b -> c)
+		leftParens = b.Left.precedence() <= precedence
+		rightParens = b.Right.precedence() < precedence
+	case OpEq, OpNeq, OpLt, OpLte, OpGt, OpGte, OpIn, OpContains, OpAnyIn, OpAllIn, OpMatches:
+		// comparisons do not chain
+		leftParens = b.Left.precedence() <= precedence
+	}
+
+	if quantifier, isQuantified := quantifiers[b.Operator]; isQuantified {
+		leftParens = leftParens || startsWithOperator(quantifier+" "+b.Left.String())
+		return quantifier + " " + wrap(b.Left, leftParens) + " IN " + wrap(b.Right, rightParens)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(wrap(b.Left, leftParens))
+	sb.WriteString(" ")
+	sb.WriteString(string(b.Operator))
+	sb.WriteString(" ")
+	sb.WriteString(wrap(b.Right, rightParens))
+	return sb.String()
+}
+
+var quantifiers = map[Operator]string{OpAnyIn: "ANY", OpAllIn: "ALL"}
+
+// startsWithOperator reports whether the operand after a quantifier starts
+// with an operator, such as a variable named in, which is read as IN right
+// after ANY, or a negation, after which ANY would be a variable name.
+func startsWithOperator(quantified string) bool {
+	tokens, err := tokenize(quantified)
+	return err != nil || tokens[1].kind == tokenOperator
+}
+
+func wrap(node Node, parens bool) string {
+	if parens {
+		return "(" + node.String() + ")"
+	}
+	return node.String()
+}
@@ -0,0 +1,323 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenNumber
+	tokenString
+	tokenOperator
+	tokenBoolean
+	tokenLeftParen
+	tokenRightParen
+	tokenReference
+	tokenComma
+	tokenLeftBracket
+	tokenRightBracket
+	tokenRegex
+)
+
+type token struct {
+	kind     tokenKind
+	text     string
+	operator Operator
+	position int
+	// flags are the flags of a regular expression literal.
+	flags string
+}
+
+// SyntaxError reports an invalid definition and the character offset where
+// the problem was found.
+type SyntaxError struct {
+	Position int
+	Message  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Position, e.Message)
+}
+
+// keywords are matched case-insensitively and take precedence over variable
+// names, except for the contextual ones.
+var keywords = map[string]Operator{
+	"and":      OpAnd,
+	"or":       OpOr,
+	"not":      OpNot,
+	"xor":      OpXor,
+	"implies":  OpImplies,
+	"iff":      OpIff,
+	"in":       OpIn,
+	"contains": OpContains,
+	"any":      OpAnyIn,
+	"all":      OpAllIn,
+	"matches":  OpMatches,
+}
+
+// contextualKeywords came after definitions could already use them as
+// variable names, so they are only read as keywords where one can stand: IN,
+// CONTAINS and MATCHES right after an operand, ANY and ALL right before one.
+// Anywhere else they are variable names, and stored definitions using them
+// that way keep their meaning.
+var contextualKeywords = map[Operator]bool{
+	OpIn:       true,
+	OpContains: true,
+	OpAnyIn:    true,
+	OpAllIn:    true,
+	OpMatches:  true,
+}
+
+// symbols are tried in order, so longer symbols must come before their
+// prefixes.
+var symbols = []struct {
+	text     string
+	operator Operator
+}{
+	{"<->", OpIff},
+	{"->", OpImplies},
+	{"=~", OpMatches},
+	{"&&", OpAnd},
+	{"||", OpOr},
+	{"==", OpEq},
+	{"!=", OpNeq},
+	{"<=", OpLte},
+	{">=", OpGte},
+	{"!", OpNot},
+	{"^", OpXor},
+	{"<", OpLt},
+	{">", OpGt},
+	{"+", OpAdd},
+	{"-", OpSub},
+	{"*", OpMul},
+	{"/", OpDiv},
+	{"%", OpMod},
+}
+
+func tokenize(definition string) ([]token, error) {
+	var tokens []token
+	runes := []rune(definition)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '/' && afterMatches(tokens):
+			regex, end, err := scanRegex(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, regex)
+			i = end
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "(", position: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")", position: i})
+			i++
+		case r == '[':
+			tokens = append(tokens, token{kind: tokenLeftBracket, text: "[", position: i})
+			i++
+		case r == ']':
+			tokens = append(tokens, token{kind: tokenRightBracket, text: "]", position: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", position: i})
+			i++
+		case unicode.IsDigit(r) || r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i]), position: start})
+		case r == '"' || r == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(runes) && runes[i] != r {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if i >= len(runes) {
+				return nil, &SyntaxError{Position: start, Message: "unterminated string"}
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), position: start})
+		case r == '@':
+			start := i
+			i++
+			for i < len(runes) && isIdentifierPart(runes[i]) {
+				i++
+			}
+			if i == start+1 {
+				return nil, &SyntaxError{Position: start, Message: "expected an expression name or id after @"}
+			}
+			tokens = append(tokens, token{kind: tokenReference, text: string(runes[start+1 : i]), position: start})
+		case isIdentifierStart(r):
+			start := i
+			for i < len(runes) && isIdentifierPart(runes[i]) {
+				i++
+			}
+			i = scanPath(runes, i)
+			text := string(runes[start:i])
+			lower := strings.ToLower(text)
+			if operator, exists := keywords[lower]; exists && (!contextualKeywords[operator] || isQuantifier(operator) || endsOperand(tokens)) {
+				tokens = append(tokens, token{kind: tokenOperator, text: text, operator: operator, position: start})
+			} else if lower == "true" || lower == "false" {
+				tokens = append(tokens, token{kind: tokenBoolean, text: lower, position: start})
+			} else {
+				tokens = append(tokens, token{kind: tokenIdentifier, text: text, position: start})
+			}
+		default:
+			matched := false
+			for _, symbol := range symbols {
+				if strings.HasPrefix(string(runes[i:]), symbol.text) {
+					tokens = append(tokens, token{kind: tokenOperator, text: symbol.text, operator: symbol.operator, position: i})
+					i += len([]rune(symbol.text))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, &SyntaxError{Position: i, Message: fmt.Sprintf("unexpected character %q", r)}
+			}
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEOF, position: len(runes)})
+	// backwards, so a quantifier followed by another one sees whether that one
+	// is a variable name
+	for i := len(tokens) - 2; i >= 0; i-- {
+		if t := tokens[i]; t.kind == tokenOperator && isQuantifier(t.operator) && !startsOperand(tokens[i+1]) {
+			tokens[i] = token{kind: tokenIdentifier, text: t.text, position: t.position}
+		}
+	}
+	return tokens, nil
+}
+
+func isQuantifier(operator Operator) bool {
+	return operator == OpAnyIn || operator == OpAllIn
+}
+
+// endsOperand reports whether the last token can end an operand, so that a
+// contextual keyword following it is an operator. A quantifier counts, as it
+// cannot be followed by an operator and is then a variable name itself.
+func endsOperand(tokens []token) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	switch last := tokens[len(tokens)-1]; last.kind {
+	case tokenIdentifier, tokenNumber, tokenString, tokenBoolean, tokenReference, tokenRegex, tokenRightParen, tokenRightBracket:
+		return true
+	case tokenOperator:
+		return isQuantifier(last.operator)
+	default:
+		return false
+	}
+}
+
+func startsOperand(t token) bool {
+	switch t.kind {
+	case tokenIdentifier, tokenNumber, tokenString, tokenBoolean, tokenReference, tokenRegex, tokenLeftParen, tokenLeftBracket:
+		return true
+	default:
+		return false
+	}
+}
+
+func afterMatches(tokens []token) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	last := tokens[len(tokens)-1]
+	return last.kind == tokenOperator && last.operator == OpMatches
+}
+
+// scanRegex reads a /pattern/flags literal starting at i, where \/ stands for
+// a slash in the pattern and every other escape is kept for the pattern.
+func scanRegex(runes []rune, i int) (token, int, error) {
+	start := i
+	i++
+	var sb strings.Builder
+	for i < len(runes) && runes[i] != '/' {
+		if runes[i] == '\\' && i+1 < len(runes) && runes[i+1] == '/' {
+			i++
+		} else if runes[i] == '\\' && i+1 < len(runes) {
+			sb.WriteRune(runes[i])
+			i++
+		}
+		sb.WriteRune(runes[i])
+		i++
+	}
+	if i >= len(runes) {
+		return token{}, 0, &SyntaxError{Position: start, Message: "unterminated regular expression"}
+	}
+	i++
+
+	flagsStart := i
+	for i < len(runes) && unicode.IsLetter(runes[i]) {
+		i++
+	}
+	return token{kind: tokenRegex, text: sb.String(), flags: string(runes[flagsStart:i]), position: start}, i, nil
+}
+
+// scanPath extends an identifier ending at i with the .field and [index]
+// steps that directly follow it, returning the new end.
+func scanPath(runes []rune, i int) int {
+	for i < len(runes) {
+		switch {
+		case runes[i] == '.' && i+1 < len(runes) && isIdentifierStart(runes[i+1]):
+			i++
+			for i < len(runes) && isIdentifierPart(runes[i]) {
+				i++
+			}
+		case runes[i] == '[':
+			end := i + 1
+			for end < len(runes) && unicode.IsDigit(runes[end]) {
+				end++
+			}
+			if end == i+1 || end >= len(runes) || runes[end] != ']' {
+				return i
+			}
+			i = end + 1
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// IsIdentifier reports whether name is read as a variable or function name
+// everywhere, rather than as a keyword or literal. Contextual keywords are
+// not identifiers, although definitions may still use them as variables.
+func IsIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if i == 0 && !isIdentifierStart(r) || !isIdentifierPart(r) {
+			return false
+		}
+	}
+	lower := strings.ToLower(name)
+	_, isKeyword := keywords[lower]
+	return !isKeyword && lower != "true" && lower != "false"
+}
+
+func isIdentifierStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentifierPart(r rune) bool {
+	return isIdentifierStart(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,319 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse turns a rule definition into a syntax tree. Operators, from loosest
+// to tightest binding:
+//
+//	IFF, <->                 left associative
+//	IMPLIES, ->              right associative
+//	OR, ||                   left associative
+//	XOR, ^                   left associative
+//	AND, &&                  left associative
+//	NOT, !                   prefix, applies to a whole comparison
+//	== != < <= > >=          do not chain
+//	IN CONTAINS ANY..IN ALL..IN MATCHES =~
+//	+ -                      left associative
+//	* / %                    left associative
+//	-                        prefix negation
+//
+// Keywords are case-insensitive and parentheses group as usual. @name and
+// @42 refer to another expression by name or id; they are left unresolved.
+// name(a, b) calls a function; calls are not checked against any function.
+// [a, b] is a list. The right side of MATCHES may be a /pattern/flags literal;
+// it and string patterns are compiled here, so invalid ones are syntax errors.
+// IN, CONTAINS, ANY, ALL and MATCHES are only keywords where an operator can
+// stand, and variable names elsewhere; "in(", "contains(" and "matches(" call
+// the functions of that name.
+func Parse(definition string) (Node, error) {
+	tokens, err := tokenize(definition)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{tokens: tokens}
+	node, err := p.parseIff()
+	if err != nil {
+		return nil, err
+	}
+
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, p.unexpected(next)
+	}
+
+	return node, nil
+}
+
+type parser struct {
+	tokens   []token
+	position int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.position]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.position]
+	if t.kind != tokenEOF {
+		p.position++
+	}
+	return t
+}
+
+// accept consumes the next token when it is one of the given operators.
+func (p *parser) accept(operators ...Operator) (Operator, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return "", false
+	}
+	for _, operator := range operators {
+		if t.operator == operator {
+			p.next()
+			return operator, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokenEOF {
+		return &SyntaxError{Position: t.position, Message: "unexpected end of definition"}
+	}
+	return &SyntaxError{Position: t.position, Message: fmt.Sprintf("unexpected %q", t.text)}
+}
+
+// parseBinary parses a left associative chain of the given operators.
+func (p *parser) parseBinary(operand func() (Node, error), operators ...Operator) (Node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		operator, ok := p.accept(operators...)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Operator: operator, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseIff() (Node, error) {
+	return p.parseBinary(p.parseImplies, OpIff)
+}
+
+func (p *parser) parseImplies() (Node, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := p.accept(OpImplies); !ok {
+		return left, nil
+	}
+
+	right, err := p.parseImplies()
+	if err != nil {
+		return nil, err
+	}
+	return &Binary{Operator: OpImplies, Left: left, Right: right}, nil
+}
+
+func (p *parser) parseOr() (Node, error) {
+	return p.parseBinary(p.parseXor, OpOr)
+}
+
+func (p *parser) parseXor() (Node, error) {
+	return p.parseBinary(p.parseAnd, OpXor)
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	return p.parseBinary(p.parseNot, OpAnd)
+}
+
+func (p *parser) parseNot() (Node, error) {
+	if _, ok := p.accept(OpNot); !ok {
+		return p.parseComparison()
+	}
+
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return &Unary{Operator: OpNot, Operand: operand}, nil
+}
+
+func (p *parser) parseComparison() (Node, error) {
+	comparisons := []Operator{OpEq, OpNeq, OpLt, OpLte, OpGt, OpGte, OpIn, OpContains, OpMatches}
+
+	if quantifier, ok := p.accept(OpAnyIn, OpAllIn); ok {
+		return p.parseQuantified(quantifier)
+	}
+
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	operator, ok := p.accept(comparisons...)
+	if !ok {
+		return left, nil
+	}
+
+	return p.finishComparison(operator, left)
+}
+
+// parseQuantified parses the rest of "ANY a IN b" or "ALL a IN b".
+func (p *parser) parseQuantified(quantifier Operator) (Node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenOperator || t.operator != OpIn {
+		return nil, &SyntaxError{Position: t.position, Message: fmt.Sprintf("expected IN after %s", quantifiers[quantifier])}
+	}
+	p.next()
+
+	return p.finishComparison(quantifier, left)
+}
+
+func (p *parser) finishComparison(operator Operator, left Node) (Node, error) {
+	position := p.peek().position
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	// a string pattern is compiled up front like a regular expression literal
+	if literal, isString := right.(*Literal); isString && operator == OpMatches {
+		if pattern, ok := literal.Value.(string); ok {
+			regex, err := newRegex(pattern, "")
+			if err != nil {
+				return nil, &SyntaxError{Position: position, Message: err.Error()}
+			}
+			right = regex
+		}
+	}
+
+	if t := p.peek(); t.kind == tokenOperator && t.operator.precedence() == precedenceComparison {
+		return nil, &SyntaxError{Position: t.position, Message: "comparisons cannot be chained"}
+	}
+
+	return &Binary{Operator: operator, Left: left, Right: right}, nil
+}
+
+func (p *parser) parseAdditive() (Node, error) {
+	return p.parseBinary(p.parseMultiplicative, OpAdd, OpSub)
+}
+
+func (p *parser) parseMultiplicative() (Node, error) {
+	return p.parseBinary(p.parseNegation, OpMul, OpDiv, OpMod)
+}
+
+func (p *parser) parseNegation() (Node, error) {
+	if _, ok := p.accept(OpSub); !ok {
+		return p.parsePrimary()
+	}
+
+	operand, err := p.parseNegation()
+	if err != nil {
+		return nil, err
+	}
+	return &Unary{Operator: OpNeg, Operand: operand}, nil
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenNumber:
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &SyntaxError{Position: t.position, Message: fmt.Sprintf("invalid number %q", t.text)}
+		}
+		return &Literal{Value: value}, nil
+	case tokenString:
+		return &Literal{Value: t.text}, nil
+	case tokenBoolean:
+		return &Literal{Value: t.text == "true"}, nil
+	case tokenIdentifier:
+		if p.peek().kind == tokenLeftParen {
+			if _, isKeyword := keywords[strings.ToLower(t.text)]; isKeyword {
+				t.text = strings.ToLower(t.text)
+			}
+			return p.parseCall(t)
+		}
+		return &Variable{Name: t.text}, nil
+	case tokenReference:
+		return &Reference{Target: t.text}, nil
+	case tokenRegex:
+		regex, err := newRegex(t.text, t.flags)
+		if err != nil {
+			return nil, &SyntaxError{Position: t.position, Message: err.Error()}
+		}
+		return regex, nil
+	case tokenLeftBracket:
+		elements, err := p.parseList(tokenRightBracket)
+		if err != nil {
+			return nil, err
+		}
+		return &List{Elements: elements}, nil
+	case tokenLeftParen:
+		node, err := p.parseIff()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRightParen {
+			return nil, p.unexpected(closing)
+		}
+		return node, nil
+	default:
+		return nil, p.unexpected(t)
+	}
+}
+
+// parseCall parses the comma separated arguments following a function name.
+func (p *parser) parseCall(name token) (Node, error) {
+	p.next()
+	args, err := p.parseList(tokenRightParen)
+	if err != nil {
+		return nil, err
+	}
+	return &Call{Name: name.text, Args: args}, nil
+}
+
+// parseList parses comma separated expressions up to and including closing.
+func (p *parser) parseList(closing tokenKind) ([]Node, error) {
+	nodes := []Node{}
+
+	if p.peek().kind == closing {
+		p.next()
+		return nodes, nil
+	}
+
+	for {
+		node, err := p.parseIff()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+
+		switch t := p.next(); t.kind {
+		case tokenComma:
+		case closing:
+			return nodes, nil
+		default:
+			return nil, p.unexpected(t)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package parser
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name       string
+		definition string
+		expected   string
+	}{
+		{
+			name:       "should accept keywords in any case",
+			definition: "x Or y aNd z",
+			expected:   "x OR y AND z",
+		},
+		{
+			name:       "should accept symbol forms",
+			definition: "!a && b || c ^ d -> e <-> f",
+			expected:   "NOT a AND b OR c XOR d IMPLIES e IFF f",
+		},
+		{
+			name:       "should bind AND tighter than XOR and XOR tighter than OR",
+			definition: "a or b xor c and d",
+			expected:   "a OR b XOR c AND d",
+		},
+		{
+			name:       "should keep parentheses that change precedence",
+			definition: "(a or b) and not (c xor d)",
+			expected:   "(a OR b) AND NOT (c XOR d)",
+		},
+		{
+			name:       "should make IMPLIES right associative",
+			definition: "a implies b implies c",
+			expected:   "a IMPLIES b IMPLIES c",
+		},
+		{
+			name:       "should keep parentheses on the left of IMPLIES",
+			definition: "(a -> b) -> c",
+			expected:   "(a IMPLIES b) IMPLIES c",
+		},
+		{
+			name:       "should apply NOT to a whole comparison",
+			definition: "not x > 5",
+			expected:   "NOT x > 5",
+		},
+		{
+			name:       "should not treat keywords inside names as operators",
+			definition: "color and brand",
+			expected:   "color AND brand",
+		},
+		{
+			name:       "should parse literals and arithmetic",
+			definition: "price * -2 + 1.5 >= 10 and name == 'bob' or TRUE",
+			expected:   `price * -2 + 1.5 >= 10 AND name == "bob" OR TRUE`,
+		},
+		{
+			name:       "should parse references by name and id",
+			definition: "@isActive and not @42",
+			expected:   "@isActive AND NOT @42",
+		},
+		{
+			name:       "should parse function calls",
+			definition: "contains(lower(name), 'bo') and max(a, b + 1, 3) > 2 or now() == ''",
+			expected:   `contains(lower(name), "bo") AND max(a, b + 1, 3) > 2 OR now() == ""`,
+		},
+		{
+			name:       "should parse list operators",
+			definition: "role in ['admin', 'owner'] and tags contains 'beta' and not any tags in [] or all (a) in b",
+			expected:   `role IN ["admin", "owner"] AND tags CONTAINS "beta" AND NOT ANY tags IN [] OR ALL a IN b`,
+		},
+		{
+			name:       "should call in and contains as functions",
+			definition: "in(x, 1, 2) and contains(name, 'a')",
+			expected:   `in(x, 1, 2) AND contains(name, "a")`,
+		},
+		{
+			name:       "should parse regular expressions",
+			definition: `email =~ /^[a-z]+@example\.com$/i and path matches '^/api/' and not code MATCHES pattern`,
+			expected:   `email MATCHES /^[a-z]+@example\.com$/i AND path MATCHES /^\/api\// AND NOT code MATCHES pattern`,
+		},
+		{
+			name:       "should call matches as a function",
+			definition: "matches(name, 'a+') and 6 / 2 == 3",
+			expected:   `matches(name, "a+") AND 6 / 2 == 3`,
+		},
+		{
+			name:       "should read list and pattern keywords as variables where no operator can stand",
+			definition: "in and not contains or any xor all -> matches / 2 > any - 1",
+			expected:   "in AND NOT contains OR any XOR all IMPLIES matches / 2 > any - 1",
+		},
+		{
+			name:       "should mix list and pattern keywords used as variables with the operators",
+			definition: "in in [in] and all contains any and ANY all IN matches and contains matches /a/",
+			expected:   `in IN [in] AND all CONTAINS any AND ANY all IN matches AND contains MATCHES /a/`,
+		},
+		{
+			name:       "should keep quantified variables named like keywords in parentheses",
+			definition: "ANY (in) IN allowed or all (contains + 1) in [2] or any (-x) in [1]",
+			expected:   "ANY (in) IN allowed OR ALL (contains + 1) IN [2] OR ANY (-x) IN [1]",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, err := Parse(tc.definition)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, node.String())
+
+			reparsed, err := Parse(node.String())
+			assert.NoError(t, err)
+			assert.Equal(t, node, reparsed, "rendered definition should parse to the same tree")
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		definition    string
+		expectedError string
+	}{
+		{
+			name:          "should reject unknown characters",
+			definition:    "a & b",
+			expectedError: `syntax error at position 2: unexpected character '&'`,
+		},
+		{
+			name:          "should reject missing operands",
+			definition:    "a and",
+			expectedError: "syntax error at position 5: unexpected end of definition",
+		},
+		{
+			name:          "should reject unbalanced parentheses",
+			definition:    "(a or b",
+			expectedError: "syntax error at position 7: unexpected end of definition",
+		},
+		{
+			name:          "should reject chained comparisons",
+			definition:    "1 < x < 3",
+			expectedError: "syntax error at position 6: comparisons cannot be chained",
+		},
+		{
+			name:          "should reject unterminated strings",
+			definition:    "name == 'bob",
+			expectedError: "syntax error at position 8: unterminated string",
+		},
+		{
+			name:          "should reject trailing tokens",
+			definition:    "a b",
+			expectedError: `syntax error at position 2: unexpected "b"`,
+		},
+		{
+			name:          "should reject references without a target",
+			definition:    "a and @ b",
+			expectedError: "syntax error at position 6: expected an expression name or id after @",
+		},
+		{
+			name:          "should reject unterminated calls",
+			definition:    "contains(name, 'bo'",
+			expectedError: "syntax error at position 19: unexpected end of definition",
+		},
+		{
+			name:          "should reject commas outside calls",
+			definition:    "a, b",
+			expectedError: `syntax error at position 1: unexpected ","`,
+		},
+		{
+			name:          "should reject quantifiers without IN",
+			definition:    "any tags contains 'a'",
+			expectedError: "syntax error at position 9: expected IN after ANY",
+		},
+		{
+			name:          "should reject chained list operators",
+			definition:    "a in b in c",
+			expectedError: "syntax error at position 7: comparisons cannot be chained",
+		},
+		{
+			name:          "should reject unterminated lists",
+			definition:    "a in [1, 2",
+			expectedError: "syntax error at position 10: unexpected end of definition",
+		},
+		{
+			name:          "should reject invalid regular expressions",
+			definition:    "name =~ /a(b/",
+			expectedError: "syntax error at position 8: invalid regular expression: error parsing regexp: missing closing ): `a(b`",
+		},
+		{
+			name:          "should reject invalid string patterns",
+			definition:    "name matches '[a-'",
+			expectedError: "syntax error at position 13: invalid regular expression: error parsing regexp: missing closing ]: `[a-`",
+		},
+		{
+			name:          "should reject unknown regular expression flags",
+			definition:    "name =~ /a/x",
+			expectedError: `syntax error at position 8: unknown regular expression flag 'x'`,
+		},
+		{
+			name:          "should reject unterminated regular expressions",
+			definition:    "name =~ /a",
+			expectedError: "syntax error at position 8: unterminated regular expression",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.definition)
+			assert.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestIsIdentifier(t *testing.T) {
+	assert.True(t, IsIdentifier("isBusinessDay"))
+	assert.True(t, IsIdentifier("_days2"))
+	assert.False(t, IsIdentifier(""))
+	assert.False(t, IsIdentifier("2days"))
+	assert.False(t, IsIdentifier("is-day"))
+	assert.False(t, IsIdentifier("AND"))
+	assert.False(t, IsIdentifier("True"))
+}
@@ -0,0 +1,133 @@
+package parser
+
+type Type string
+
+const (
+	TypeBoolean Type = "boolean"
+	TypeNumber  Type = "number"
+	TypeString  Type = "string"
+	TypeList    Type = "list"
+	TypeAny     Type = "any"
+)
+
+// StaticType is the type node evaluates to when it can be known without
+// values, or TypeAny for variables and calls not bound to a function.
+func StaticType(node Node) Type {
+	switch n := node.(type) {
+	case *Literal:
+		switch n.Value.(type) {
+		case bool:
+			return TypeBoolean
+		case float64:
+			return TypeNumber
+		case string:
+			return TypeString
+		}
+	case *Unary:
+		if n.Operator == OpNeg {
+			return TypeNumber
+		}
+		return TypeBoolean
+	case *Binary:
+		if n.Operator.precedence() >= precedenceAdditive {
+			return TypeNumber
+		}
+		return TypeBoolean
+	case *Call:
+		if n.Function != nil {
+			return n.Function.Returns
+		}
+	case *List:
+		return TypeList
+	}
+	return TypeAny
+}
+
+// ParameterType is the type the function expects for the argument at index,
+// or TypeAny when the index is past its parameters.
+func (f *Function) ParameterType(index int) Type {
+	switch {
+	case index < len(f.Parameters):
+		return f.Parameters[index]
+	case f.Variadic && len(f.Parameters) > 0:
+		return f.Parameters[len(f.Parameters)-1]
+	default:
+		return TypeAny
+	}
+}
+
+// InferTypes guesses the type of every variable from how the definition uses
+// it: operands of connectives are booleans, operands of arithmetic and
+// ordering comparisons are numbers, equality takes the type of the other
+// side, and the list sides of IN, CONTAINS, ANY and ALL are lists. Arguments of bound calls take the type of their parameter. Variables
+// used inconsistently or only compared with each other are
+// reported as TypeAny.
+func InferTypes(node Node) map[string]Type {
+	constraints := make(map[string]map[Type]bool)
+	infer(node, TypeAny, constraints)
+
+	types := make(map[string]Type, len(constraints))
+	for name, seen := range constraints {
+		types[name] = TypeAny
+		if len(seen) == 1 {
+			for t := range seen {
+				types[name] = t
+			}
+		}
+	}
+	return types
+}
+
+func infer(node Node, expected Type, constraints map[string]map[Type]bool) {
+	switch n := node.(type) {
+	case *Variable:
+		if constraints[n.Name] == nil {
+			constraints[n.Name] = make(map[Type]bool)
+		}
+		if expected != TypeAny {
+			constraints[n.Name][expected] = true
+		}
+	case *Unary:
+		if n.Operator == OpNeg {
+			infer(n.Operand, TypeNumber, constraints)
+		} else {
+			infer(n.Operand, TypeBoolean, constraints)
+		}
+	case *Binary:
+		switch {
+		case n.Operator.IsLogical():
+			infer(n.Left, TypeBoolean, constraints)
+			infer(n.Right, TypeBoolean, constraints)
+		case n.Operator == OpEq || n.Operator == OpNeq:
+			infer(n.Left, StaticType(n.Right), constraints)
+			infer(n.Right, StaticType(n.Left), constraints)
+		case n.Operator == OpIn:
+			infer(n.Left, TypeAny, constraints)
+			infer(n.Right, TypeList, constraints)
+		case n.Operator == OpContains:
+			infer(n.Left, TypeList, constraints)
+			infer(n.Right, TypeAny, constraints)
+		case n.Operator == OpMatches:
+			infer(n.Left, TypeString, constraints)
+			infer(n.Right, TypeString, constraints)
+		case n.Operator == OpAnyIn || n.Operator == OpAllIn:
+			infer(n.Left, TypeList, constraints)
+			infer(n.Right, TypeList, constraints)
+		default:
+			infer(n.Left, TypeNumber, constraints)
+			infer(n.Right, TypeNumber, constraints)
+		}
+	case *Call:
+		for i, arg := range n.Args {
+			expected := TypeAny
+			if n.Function != nil {
+				expected = n.Function.ParameterType(i)
+			}
+			infer(arg, expected, constraints)
+		}
+	case *List:
+		for _, element := range n.Elements {
+			infer(element, TypeAny, constraints)
+		}
+	}
+}
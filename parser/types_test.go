@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestInferTypes(t *testing.T) {
+	testCases := []struct {
+		name       string
+		definition string
+		expected   map[string]Type
+	}{
+		{
+			name:       "should infer booleans from connectives",
+			definition: "a and not b",
+			expected:   map[string]Type{"a": TypeBoolean, "b": TypeBoolean},
+		},
+		{
+			name:       "should infer numbers from arithmetic and ordering",
+			definition: "price * quantity > limit",
+			expected:   map[string]Type{"price": TypeNumber, "quantity": TypeNumber, "limit": TypeNumber},
+		},
+		{
+			name:       "should infer equality from the other side",
+			definition: "country == 'BR' and active == true and score != total + 1",
+			expected:   map[string]Type{"country": TypeString, "active": TypeBoolean, "score": TypeNumber, "total": TypeNumber},
+		},
+		{
+			name:       "should fall back to any",
+			definition: "x == y or (z and z > 1)",
+			expected:   map[string]Type{"x": TypeAny, "y": TypeAny, "z": TypeAny},
+		},
+		{
+			name:       "should infer arguments from the parameters of bound calls",
+			definition: "contains(name, part) and abs(delta) > 1 and in(code, 1, 2)",
+			expected:   map[string]Type{"name": TypeString, "part": TypeString, "delta": TypeNumber, "code": TypeAny},
+		},
+		{
+			name:       "should infer strings from MATCHES",
+			definition: "name =~ pattern",
+			expected:   map[string]Type{"name": TypeString, "pattern": TypeString},
+		},
+		{
+			name:       "should infer lists from list operators",
+			definition: "role in roles and tags contains tag and any granted in [required, 'admin']",
+			expected:   map[string]Type{"role": TypeAny, "roles": TypeList, "tags": TypeList, "tag": TypeAny, "granted": TypeList, "required": TypeAny},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, err := Parse(tc.definition)
+			assert.NoError(t, err)
+			Walk(node, func(n Node) {
+				if call, ok := n.(*Call); ok {
+					call.Function = signatures[call.Name]
+				}
+			})
+			assert.Equal(t, tc.expected, InferTypes(node))
+		})
+	}
+}
+
+var signatures = map[string]*Function{
+	"contains": {Parameters: []Type{TypeString, TypeString}, Returns: TypeBoolean},
+	"abs":      {Parameters: []Type{TypeNumber}, Returns: TypeNumber},
+	"in":       {Parameters: []Type{TypeAny, TypeAny}, Variadic: true, Returns: TypeBoolean},
+}
@@ -0,0 +1,80 @@
+package parser
+
+import "sort"
+
+// Walk calls visit for node and then for each of its operands, depth first
+// and left to right.
+func Walk(node Node, visit func(Node)) {
+	visit(node)
+
+	for _, operand := range operands(node) {
+		Walk(operand, visit)
+	}
+}
+
+// Depth returns the number of nodes on the longest path from node down to a
+// leaf, so a single variable has depth 1.
+func Depth(node Node) int {
+	deepest := 0
+	for _, operand := range operands(node) {
+		if depth := Depth(operand); depth > deepest {
+			deepest = depth
+		}
+	}
+	return deepest + 1
+}
+
+// Size returns the number of nodes in the tree rooted at node.
+func Size(node Node) int {
+	size := 0
+	Walk(node, func(Node) { size++ })
+	return size
+}
+
+func operands(node Node) []Node {
+	switch n := node.(type) {
+	case *Unary:
+		return []Node{n.Operand}
+	case *Binary:
+		return []Node{n.Left, n.Right}
+	case *Call:
+		return n.Args
+	case *List:
+		return n.Elements
+	}
+	return nil
+}
+
+// Variables returns the names of the variables referenced by node, sorted
+// and without duplicates.
+func Variables(node Node) []string {
+	seen := make(map[string]bool)
+	var names []string
+
+	Walk(node, func(n Node) {
+		if variable, ok := n.(*Variable); ok && !seen[variable.Name] {
+			seen[variable.Name] = true
+			names = append(names, variable.Name)
+		}
+	})
+
+	sort.Strings(names)
+	return names
+}
+
+// References returns the targets of the references in node, sorted and
+// without duplicates.
+func References(node Node) []string {
+	seen := make(map[string]bool)
+	var targets []string
+
+	Walk(node, func(n Node) {
+		if reference, ok := n.(*Reference); ok && !seen[reference.Target] {
+			seen[reference.Target] = true
+			targets = append(targets, reference.Target)
+		}
+	})
+
+	sort.Strings(targets)
+	return targets
+}
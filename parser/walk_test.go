@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestVariables(t *testing.T) {
+	node, err := Parse("(b or a) and not (c > 5 xor a)")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"a", "b", "c"}, Variables(node))
+
+	node, err = Parse("true or 1 > 0")
+	assert.NoError(t, err)
+
+	assert.Empty(t, Variables(node))
+}
+
+func TestReferences(t *testing.T) {
+	node, err := Parse("@isActive and (@7 or premium) and not @isActive")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"7", "isActive"}, References(node))
+	assert.Equal(t, []string{"premium"}, Variables(node))
+
+	id, isId := (&Reference{Target: "7"}).ID()
+	assert.True(t, isId)
+	assert.Equal(t, 7, id)
+
+	_, isId = (&Reference{Target: "isActive"}).ID()
+	assert.False(t, isId)
+}
+
+func TestSize(t *testing.T) {
+	testCases := []struct {
+		definition string
+		depth      int
+		size       int
+	}{
+		{definition: "a", depth: 1, size: 1},
+		{definition: "a and not (b or c > 1)", depth: 5, size: 8},
+		{definition: "max(a, 1, -b) in [1, 2]", depth: 4, size: 9},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.definition, func(t *testing.T) {
+			node, err := Parse(tc.definition)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.depth, Depth(node))
+			assert.Equal(t, tc.size, Size(node))
+		})
+	}
+}
+
+func TestVariablePath(t *testing.T) {
+	node, err := Parse("user.country == 'BR' and items[0].price > 1 and a.b[12][3]")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.b[12][3]", "items[0].price", "user.country"}, Variables(node))
+
+	assert.Equal(t, []PathSegment{{Field: "items"}, {Index: 0, IsIndex: true}, {Field: "price"}}, (&Variable{Name: "items[0].price"}).Path())
+	assert.Equal(t, []PathSegment{{Field: "a"}, {Field: "b"}, {Index: 12, IsIndex: true}, {Index: 3, IsIndex: true}}, (&Variable{Name: "a.b[12][3]"}).Path())
+	assert.Equal(t, []PathSegment{{Field: "x"}}, (&Variable{Name: "x"}).Path())
+}
@@ -1,31 +1,180 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	_gorm "github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/lib/pq"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/logging"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/metrics"
 	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/tracing"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"time"
 )
 
 type ExpressionInterface interface {
-	GetAllExpressions() ([]model.Expression, error)
-	GetExpressionById(expressionId int) (model.Expression, error)
-	CreateExpression(definition string) error
-	SaveExpression(expressionId int, definition string) error
-	DeleteExpression(expressionId int) error
+	GetAllExpressions(ctx context.Context) ([]model.Expression, error)
+	GetExpressionById(ctx context.Context, expressionId int) (model.Expression, error)
+	GetExpressionByName(ctx context.Context, name string) (model.Expression, error)
+	CreateExpression(ctx context.Context, expression model.Expression, references []model.Reference) (model.Expression, error)
+	SaveExpression(ctx context.Context, expression model.Expression, references []model.Reference) (model.Expression, error)
+	GetExpressionVersions(ctx context.Context, expressionId int) ([]model.ExpressionVersion, error)
+	DeleteExpression(ctx context.Context, expressionId int, force bool) error
+	SaveReferences(ctx context.Context, expressionId int, references []model.Reference) error
+	Ping(ctx context.Context) error
+	CheckMigrations(ctx context.Context) error
 }
 
 var _ ExpressionInterface = (*Repository)(nil)
 
+var (
+	ErrExpressionNotFound = errors.New(util.ErrExpressionNotFound)
+	ErrQueryFailed        = errors.New(util.ErrExecutingQuery)
+	ErrNameTaken          = errors.New(util.ErrExpressionNameTaken)
+	ErrHasDependents      = errors.New(util.ErrHasDependents)
+	ErrReferenceNotFound  = errors.New(util.ErrUnknownReference)
+	ErrNameReferenced     = errors.New(util.ErrNameReferenced)
+	ErrVersionConflict    = errors.New(util.ErrVersionConflict)
+)
+
+// DependentsError refuses a write because of the expressions with the ids in
+// Dependents: deleting an expression they reference (ErrHasDependents), or
+// renaming one they reference by name (ErrNameReferenced).
+type DependentsError struct {
+	Err        error
+	Dependents []int
+}
+
+func (e *DependentsError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DependentsError) Unwrap() error {
+	return e.Err
+}
+
+// Postgres error codes. Duplicate keys on the expression table can only come
+// from the name index, and foreign keys only from expression_reference, when
+// a referenced expression is deleted while the reference is written.
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
 type Repository struct {
 	db *_gorm.DB
 }
 
+// startSpan opens a client span for a repository operation. Callers must end
+// the returned span.
+func startSpan(ctx context.Context, operation string, attributes ...attribute.KeyValue) trace.Span {
+	_, span := tracing.Tracer().Start(ctx, "Repository."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationKey.String(operation)),
+		trace.WithAttributes(attributes...),
+	)
+	return span
+}
+
+// run executes query, which hands ctx to database/sql so the driver cancels
+// the statement on the server once ctx is done and its connection returns to
+// the pool. gorm v1 has no context support, so queries go through r.db.DB().
+// A query failing because ctx is done reports the context error.
+func run(ctx context.Context, query func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := query(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return err
+	}
+	return nil
+}
+
+const selectExpressions = "select id, name, definition, missing_variables, dialect, version from expression"
+
+func scanExpression(row interface{ Scan(...interface{}) error }) (model.Expression, error) {
+	var expression model.Expression
+	err := row.Scan(&expression.ID, &expression.Name, &expression.Definition, &expression.MissingVariables, &expression.Dialect, &expression.Version)
+	return expression, err
+}
+
+// queryError hides driver details from callers while keeping missing rows,
+// cancellations and deadlines recognisable with errors.Is.
+func queryError(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrExpressionNotFound), errors.Is(err, ErrHasDependents), errors.Is(err, ErrNameReferenced),
+		errors.Is(err, ErrVersionConflict):
+		return err
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrExpressionNotFound
+	case isViolation(err, uniqueViolation):
+		return ErrNameTaken
+	case isViolation(err, foreignKeyViolation):
+		return ErrReferenceNotFound
+	default:
+		return ErrQueryFailed
+	}
+}
+
+func isViolation(err error, code pq.ErrorCode) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == code
+}
+
+// inTransaction runs work in a transaction, committing it when work succeeds
+// and rolling it back otherwise.
+func (r *Repository) inTransaction(ctx context.Context, work func(tx *sql.Tx) error) error {
+	tx, err := r.db.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := work(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// writeReferences replaces the references of an expression. Each referenced
+// row is locked while its reference is written, and must still exist and,
+// for references by name, still have that name: a referenced expression
+// deleted or renamed since the definition was resolved fails the write with
+// ErrReferenceNotFound, and one deleted or renamed later sees the reference.
+func writeReferences(ctx context.Context, tx *sql.Tx, expressionId int, references []model.Reference) error {
+	if _, err := tx.ExecContext(ctx, "delete from expression_reference where expression_id = $1", expressionId); err != nil {
+		return err
+	}
+	for _, reference := range references {
+		result, err := tx.ExecContext(ctx,
+			"insert into expression_reference (expression_id, referenced_id, referenced_name) "+
+				"select $1, id, $3 from expression where id = $2 and ($3 = '' or name = $3) for key share",
+			expressionId, reference.ID, reference.Name,
+		)
+		if err = expectRows(result, err); err != nil {
+			if errors.Is(err, ErrExpressionNotFound) {
+				return ErrReferenceNotFound
+			}
+			return err
+		}
+	}
+	return nil
+}
+
 func NewRepository(database, connectionString string) (Repository, error) {
 	db, err := _gorm.Open(database, connectionString)
 	if err != nil {
-		fmt.Println(err)
+		logging.FromContext(context.Background()).WithField("err", err.Error()).Error("failed to open database")
 		panic(err)
 	}
 
@@ -34,67 +183,395 @@ func NewRepository(database, connectionString string) (Repository, error) {
 	}, nil
 }
 
-func (r *Repository) GetAllExpressions() ([]model.Expression, error) {
+func (r *Repository) GetAllExpressions(ctx context.Context) ([]model.Expression, error) {
+	span := startSpan(ctx, "GetAllExpressions")
+	defer span.End()
+	defer metrics.ObserveRepositoryQuery("get_all_expressions", time.Now())
+
 	var expressions []model.Expression
-	result := r.db.Model(model.Expression{}).
-		Find(&expressions)
+	err := run(ctx, func() error {
+		rows, err := r.db.DB().QueryContext(ctx, selectExpressions+" order by id")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			expression, err := scanExpression(rows)
+			if err != nil {
+				return err
+			}
+			expressions = append(expressions, expression)
+		}
+		return rows.Err()
+	})
 
-	if result.Error != nil {
-		fmt.Println("Failed to execute query", "err", result.Error)
-		return nil, errors.New("failed to execute query")
+	if err != nil {
+		logging.FromContext(ctx).WithField("err", err.Error()).Error("failed to execute query")
+		tracing.RecordError(span, err)
+		return nil, queryError(err)
 	}
 
 	return expressions, nil
 }
 
-func (r *Repository) GetExpressionById(expressionId int) (model.Expression, error) {
+func (r *Repository) GetExpressionById(ctx context.Context, expressionId int) (model.Expression, error) {
+	span := startSpan(ctx, "GetExpressionById", attribute.Int("expression.id", expressionId))
+	defer span.End()
+	defer metrics.ObserveRepositoryQuery("get_expression_by_id", time.Now())
+
 	var expression model.Expression
-	result := r.db.First(&expression, []int{expressionId})
+	err := run(ctx, func() error {
+		var err error
+		expression, err = scanExpression(r.db.DB().QueryRowContext(ctx, selectExpressions+" where id = $1", expressionId))
+		return err
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).WithField("err", err.Error()).Error("failed to execute query")
+		tracing.RecordError(span, err)
+		return model.Expression{}, queryError(err)
+	}
+
+	return expression, nil
+}
+
+func (r *Repository) GetExpressionByName(ctx context.Context, name string) (model.Expression, error) {
+	span := startSpan(ctx, "GetExpressionByName", attribute.String("expression.name", name))
+	defer span.End()
+	defer metrics.ObserveRepositoryQuery("get_expression_by_name", time.Now())
+
+	var expression model.Expression
+	err := run(ctx, func() error {
+		var err error
+		expression, err = scanExpression(r.db.DB().QueryRowContext(ctx, selectExpressions+" where name = $1", name))
+		return err
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).WithField("err", err.Error()).Error("failed to execute query")
+		tracing.RecordError(span, err)
+		return model.Expression{}, queryError(err)
+	}
+
+	return expression, nil
+}
+
+// CreateExpression stores a new expression and the expressions it references,
+// and returns it with its id.
+func (r *Repository) CreateExpression(ctx context.Context, expression model.Expression, references []model.Reference) (model.Expression, error) {
+	span := startSpan(ctx, "CreateExpression")
+	defer span.End()
+	defer metrics.ObserveRepositoryQuery("create_expression", time.Now())
 
-	if result.Error != nil {
-		fmt.Println("Failed to execute query", "err", result.Error)
-		return model.Expression{}, errors.New("failed to execute query")
+	if expression.MissingVariables == "" {
+		expression.MissingVariables = model.MissingVariablesError
+	}
+	if expression.Dialect == "" {
+		expression.Dialect = model.DialectNative
+	}
+
+	err := run(ctx, func() error {
+		return r.inTransaction(ctx, func(tx *sql.Tx) error {
+			err := tx.QueryRowContext(ctx,
+				"insert into expression (name, definition, missing_variables, dialect) values ($1, $2, $3, $4) returning id, version",
+				expression.Name, expression.Definition, expression.MissingVariables, expression.Dialect,
+			).Scan(&expression.ID, &expression.Version)
+			if err != nil {
+				return err
+			}
+			return writeReferences(ctx, tx, expression.ID, references)
+		})
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).WithField("err", err.Error()).Error("error while trying to create expression")
+		tracing.RecordError(span, err)
+		return model.Expression{}, queryError(err)
 	}
 
+	logging.FromContext(ctx).WithField(logging.FieldExpressionId, expression.ID).Info("expression created successfully")
 	return expression, nil
 }
 
-func (r *Repository) CreateExpression(definition string) error {
-	expression := model.Expression{
-		Definition: definition,
+// SaveExpression updates an expression to its next version, keeping the
+// replaced one in expression_version, and replaces the expressions it
+// references. The row is locked before the checks, like DeleteExpression
+// does: an expression carrying a Version other than the stored one is
+// refused with ErrVersionConflict, and renaming it is refused with a
+// DependentsError while other expressions reference it by its current name.
+// An empty MissingVariables or Dialect keeps the stored one.
+func (r *Repository) SaveExpression(ctx context.Context, expression model.Expression, references []model.Reference) (model.Expression, error) {
+	span := startSpan(ctx, "SaveExpression", attribute.Int("expression.id", expression.ID))
+	defer span.End()
+	defer metrics.ObserveRepositoryQuery("save_expression", time.Now())
+
+	err := run(ctx, func() error {
+		return r.inTransaction(ctx, func(tx *sql.Tx) error {
+			var name string
+			var version int
+			err := tx.QueryRowContext(ctx, "select name, version from expression where id = $1 for update", expression.ID).Scan(&name, &version)
+			if err != nil {
+				return err
+			}
+			if expression.Version != 0 && expression.Version != version {
+				return fmt.Errorf("%w: it is at version %d", ErrVersionConflict, version)
+			}
+			if name != "" && name != expression.Name {
+				dependents, err := dependents(ctx, tx, expression.ID, name)
+				if err != nil {
+					return err
+				}
+				if len(dependents) > 0 {
+					return &DependentsError{Err: ErrNameReferenced, Dependents: dependents}
+				}
+			}
+
+			_, err = tx.ExecContext(ctx,
+				"insert into expression_version (expression_id, version, name, definition, missing_variables, dialect) "+
+					"select id, version, name, definition, missing_variables, dialect from expression where id = $1",
+				expression.ID,
+			)
+			if err != nil {
+				return err
+			}
+
+			err = tx.QueryRowContext(ctx,
+				"update expression set name = $2, definition = $3, missing_variables = coalesce(nullif($4, ''), missing_variables), "+
+					"dialect = coalesce(nullif($5, ''), dialect), version = version + 1 where id = $1 returning missing_variables, dialect, version",
+				expression.ID, expression.Name, expression.Definition, expression.MissingVariables, expression.Dialect,
+			).Scan(&expression.MissingVariables, &expression.Dialect, &expression.Version)
+			if err != nil {
+				return err
+			}
+			return writeReferences(ctx, tx, expression.ID, references)
+		})
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).WithField("err", err.Error()).Error("failed to execute query")
+		tracing.RecordError(span, err)
+		return model.Expression{}, queryError(err)
 	}
+	return expression, nil
+}
 
-	createResponse := r.db.Create(&expression)
+// GetExpressionVersions returns the versions an expression had before its
+// updates, oldest first. They are deleted along with it.
+func (r *Repository) GetExpressionVersions(ctx context.Context, expressionId int) ([]model.ExpressionVersion, error) {
+	span := startSpan(ctx, "GetExpressionVersions", attribute.Int("expression.id", expressionId))
+	defer span.End()
+	defer metrics.ObserveRepositoryQuery("get_expression_versions", time.Now())
 
-	if createResponse.Error != nil {
-		fmt.Println(fmt.Sprintf("error while trying to create user, err: %s", createResponse.Error.Error()))
-		return createResponse.Error
+	var versions []model.ExpressionVersion
+	err := run(ctx, func() error {
+		rows, err := r.db.DB().QueryContext(ctx,
+			"select version, name, definition, missing_variables, dialect, replaced_at from expression_version where expression_id = $1 order by version",
+			expressionId)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var version model.ExpressionVersion
+			err := rows.Scan(&version.Version, &version.Name, &version.Definition, &version.MissingVariables, &version.Dialect, &version.ReplacedAt)
+			if err != nil {
+				return err
+			}
+			versions = append(versions, version)
+		}
+		return rows.Err()
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).WithField("err", err.Error()).Error("failed to execute query")
+		tracing.RecordError(span, err)
+		return nil, queryError(err)
 	}
 
-	fmt.Println("user created successfully")
+	return versions, nil
+}
+
+// DeleteExpression deletes an expression, refusing with a DependentsError
+// while other expressions reference it unless force is set, in which case
+// their references to it are dropped. The row is locked before the check, so
+// a reference written concurrently either is seen by it or fails on the
+// foreign key once the expression is gone.
+func (r *Repository) DeleteExpression(ctx context.Context, expressionId int, force bool) error {
+	span := startSpan(ctx, "DeleteExpression", attribute.Int("expression.id", expressionId), attribute.Bool("force", force))
+	defer span.End()
+	defer metrics.ObserveRepositoryQuery("delete_expression", time.Now())
+
+	err := run(ctx, func() error {
+		return r.inTransaction(ctx, func(tx *sql.Tx) error {
+			var id int
+			if err := tx.QueryRowContext(ctx, "select id from expression where id = $1 for update", expressionId).Scan(&id); err != nil {
+				return err
+			}
+
+			if force {
+				if _, err := tx.ExecContext(ctx, "delete from expression_reference where referenced_id = $1", expressionId); err != nil {
+					return err
+				}
+			} else {
+				dependents, err := dependents(ctx, tx, expressionId, "")
+				if err != nil {
+					return err
+				}
+				if len(dependents) > 0 {
+					return &DependentsError{Err: ErrHasDependents, Dependents: dependents}
+				}
+			}
+
+			result, err := tx.ExecContext(ctx, "delete from expression where id = $1", expressionId)
+			return expectRows(result, err)
+		})
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).WithField("err", err.Error()).Error("failed to execute delete query")
+		tracing.RecordError(span, err)
+		return queryError(err)
+	}
 	return nil
 }
 
-func (r *Repository) SaveExpression(expressionId int, definition string) error {
-	var expression model.Expression
-	result := r.db.Model(&expression).Where("id = ?", expressionId).Update("definition", definition)
+// dependents returns the ids of the expressions referencing the given one, or
+// only those referencing it by name when name is set.
+func dependents(ctx context.Context, tx *sql.Tx, expressionId int, name string) ([]int, error) {
+	rows, err := tx.QueryContext(ctx,
+		"select distinct expression_id from expression_reference "+
+			"where referenced_id = $1 and expression_id <> $1 and ($2 = '' or referenced_name = $2) order by expression_id",
+		expressionId, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	if result.Error != nil {
-		fmt.Println("Failed to execute query", "err", result.Error)
-		return errors.New("failed to execute query")
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SaveReferences replaces the references recorded for an expression, for
+// expressions stored before references were.
+func (r *Repository) SaveReferences(ctx context.Context, expressionId int, references []model.Reference) error {
+	span := startSpan(ctx, "SaveReferences", attribute.Int("expression.id", expressionId))
+	defer span.End()
+	defer metrics.ObserveRepositoryQuery("save_references", time.Now())
+
+	err := run(ctx, func() error {
+		return r.inTransaction(ctx, func(tx *sql.Tx) error {
+			return writeReferences(ctx, tx, expressionId, references)
+		})
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).WithField("err", err.Error()).Error("failed to execute query")
+		tracing.RecordError(span, err)
+		return queryError(err)
 	}
 	return nil
 }
 
-func (r *Repository) DeleteExpression(expressionId int) error {
-	expression := model.Expression{
-		ID: expressionId,
+// expectRows reports a statement that matched no row as ErrExpressionNotFound.
+func expectRows(result sql.Result, err error) error {
+	if err != nil {
+		return err
 	}
-	result := r.db.Delete(&expression)
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrExpressionNotFound
+	}
+	return nil
+}
+
+func (r *Repository) Close() error {
+	return r.db.Close()
+}
 
-	if result.Error != nil {
-		fmt.Println("Failed to execute delete query", "err", result.Error)
-		return errors.New("failed to execute query")
+func (r *Repository) Ping(ctx context.Context) error {
+	span := startSpan(ctx, "Ping")
+	defer span.End()
+	defer metrics.ObserveRepositoryQuery("ping", time.Now())
+
+	if err := r.db.DB().PingContext(ctx); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	return nil
+}
+
+// requiredColumns lists the columns added after the expression table was first
+// created, and requiredTables the tables, so readiness fails until migrations.sql
+// is applied.
+var (
+	requiredColumns = []string{"missing_variables", "name", "dialect", "version"}
+	requiredTables  = []string{"expression_reference", "expression_version"}
+)
+
+func (r *Repository) CheckMigrations(ctx context.Context) error {
+	span := startSpan(ctx, "CheckMigrations")
+	defer span.End()
+
+	table := model.Expression{}.TableName()
+	err := run(ctx, func() error {
+		rows, err := r.db.DB().QueryContext(ctx,
+			"select column_name from information_schema.columns where table_schema = current_schema() and table_name = $1", table)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		columns := make(map[string]bool)
+		for rows.Next() {
+			var column string
+			if err := rows.Scan(&column); err != nil {
+				return err
+			}
+			columns[column] = true
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(columns) == 0 {
+			return fmt.Errorf("table %s does not exist", table)
+		}
+		for _, column := range requiredColumns {
+			if !columns[column] {
+				return fmt.Errorf("column %s.%s does not exist", table, column)
+			}
+		}
+
+		for _, required := range requiredTables {
+			var exists bool
+			err := r.db.DB().QueryRowContext(ctx,
+				"select exists (select 1 from information_schema.tables where table_schema = current_schema() and table_name = $1)", required,
+			).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("table %s does not exist", required)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		tracing.RecordError(span, err)
+		return err
 	}
 	return nil
 }
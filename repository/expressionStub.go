@@ -1,12 +1,15 @@
 package repository
 
 import (
+	"context"
 	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"sort"
 )
 
 var _ ExpressionInterface = (*Stub)(nil)
 
 type Stub struct {
+	CreateExpressionId         int
 	CreateExpressionError      error
 	CreateExpressionCalledWith map[string]any
 
@@ -20,40 +23,184 @@ type Stub struct {
 	GetExpressionByIdError      error
 	GetExpressionByIdCalledWith map[string]any
 
+	// Expressions, when set, answers lookups by id and name instead of the
+	// fixed GetExpressionById response, and is updated by writes.
+	Expressions []model.Expression
+
 	DeleteExpressionCalledWith map[string]any
 	DeleteExpressionError      error
+
+	// References holds the references written with each expression, by id,
+	// and refuses deletes the way the repository does.
+	References map[int][]model.Reference
+
+	// Versions holds the versions replaced by updates of Expressions, by id.
+	Versions                   map[int][]model.ExpressionVersion
+	GetExpressionVersionsError error
+
+	PingError            error
+	CheckMigrationsError error
 }
 
-func (s *Stub) GetAllExpressions() ([]model.Expression, error) {
+func (s *Stub) GetAllExpressions(ctx context.Context) ([]model.Expression, error) {
 	return s.GetAllExpressionsResponse, s.GetAllExpressionsError
 }
 
-func (s *Stub) GetExpressionById(expressionId int) (model.Expression, error) {
+func (s *Stub) GetExpressionById(ctx context.Context, expressionId int) (model.Expression, error) {
 	s.GetExpressionByIdCalledWith = map[string]any{
 		"expressionId": expressionId,
 	}
 
+	if s.Expressions != nil {
+		for _, expression := range s.Expressions {
+			if expression.ID == expressionId {
+				return expression, nil
+			}
+		}
+		return model.Expression{}, ErrExpressionNotFound
+	}
 	return s.GetExpressionByIdResponse, s.GetExpressionByIdError
 }
 
-func (s *Stub) CreateExpression(definition string) error {
+func (s *Stub) GetExpressionByName(ctx context.Context, name string) (model.Expression, error) {
+	for _, expression := range s.Expressions {
+		if expression.Name == name {
+			return expression, nil
+		}
+	}
+	return model.Expression{}, ErrExpressionNotFound
+}
+
+func (s *Stub) CreateExpression(ctx context.Context, expression model.Expression, references []model.Reference) (model.Expression, error) {
 	s.CreateExpressionCalledWith = map[string]any{
-		"definition": definition,
+		"name":             expression.Name,
+		"definition":       expression.Definition,
+		"missingVariables": expression.MissingVariables,
+		"dialect":          expression.Dialect,
+		"references":       references,
 	}
-	return s.CreateExpressionError
+	if s.CreateExpressionError != nil {
+		return model.Expression{}, s.CreateExpressionError
+	}
+	expression.ID = s.CreateExpressionId
+	expression.Version = 1
+	if s.Expressions != nil {
+		s.Expressions = append(s.Expressions, expression)
+	}
+	s.saveReferences(expression.ID, references)
+	return expression, nil
 }
 
-func (s *Stub) SaveExpression(expressionId int, definition string) error {
+func (s *Stub) SaveExpression(ctx context.Context, expression model.Expression, references []model.Reference) (model.Expression, error) {
 	s.SaveExpressionCalledWith = map[string]any{
-		"expressionId": expressionId,
-		"definition":   definition,
+		"expressionId":     expression.ID,
+		"name":             expression.Name,
+		"definition":       expression.Definition,
+		"missingVariables": expression.MissingVariables,
+		"dialect":          expression.Dialect,
+		"version":          expression.Version,
+		"references":       references,
+	}
+	if s.SaveExpressionError != nil {
+		return model.Expression{}, s.SaveExpressionError
 	}
-	return s.SaveExpressionError
+	for i := range s.Expressions {
+		stored := s.Expressions[i]
+		if stored.ID != expression.ID {
+			continue
+		}
+		if stored.Version == 0 {
+			stored.Version = 1
+		}
+		if expression.Version != 0 && expression.Version != stored.Version {
+			return model.Expression{}, ErrVersionConflict
+		}
+		if stored.Name != "" && stored.Name != expression.Name {
+			if dependents := s.dependents(expression.ID, stored.Name); len(dependents) > 0 {
+				return model.Expression{}, &DependentsError{Err: ErrNameReferenced, Dependents: dependents}
+			}
+		}
+		if s.Versions == nil {
+			s.Versions = make(map[int][]model.ExpressionVersion)
+		}
+		s.Versions[expression.ID] = append(s.Versions[expression.ID], model.ExpressionVersion{
+			Version:          stored.Version,
+			Name:             stored.Name,
+			Definition:       stored.Definition,
+			MissingVariables: stored.MissingVariables,
+			Dialect:          stored.Dialect,
+		})
+		if expression.MissingVariables == "" {
+			expression.MissingVariables = stored.MissingVariables
+		}
+		if expression.Dialect == "" {
+			expression.Dialect = stored.Dialect
+		}
+		expression.Version = stored.Version + 1
+		s.Expressions[i] = expression
+	}
+	s.saveReferences(expression.ID, references)
+	return expression, nil
+}
+
+func (s *Stub) GetExpressionVersions(ctx context.Context, expressionId int) ([]model.ExpressionVersion, error) {
+	return s.Versions[expressionId], s.GetExpressionVersionsError
 }
 
-func (s *Stub) DeleteExpression(expressionId int) error {
+func (s *Stub) DeleteExpression(ctx context.Context, expressionId int, force bool) error {
 	s.DeleteExpressionCalledWith = map[string]any{
 		"expressionId": expressionId,
+		"force":        force,
+	}
+	if s.DeleteExpressionError != nil {
+		return s.DeleteExpressionError
 	}
-	return s.DeleteExpressionError
+
+	if dependents := s.dependents(expressionId, ""); len(dependents) > 0 && !force {
+		return &DependentsError{Err: ErrHasDependents, Dependents: dependents}
+	}
+	delete(s.References, expressionId)
+	for i, expression := range s.Expressions {
+		if expression.ID == expressionId {
+			s.Expressions = append(s.Expressions[:i], s.Expressions[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *Stub) SaveReferences(ctx context.Context, expressionId int, references []model.Reference) error {
+	s.saveReferences(expressionId, references)
+	return nil
+}
+
+// dependents returns the ids of the expressions referencing the given one, or
+// only those referencing it by name when name is set.
+func (s *Stub) dependents(expressionId int, name string) []int {
+	var dependents []int
+	for id, references := range s.References {
+		for _, reference := range references {
+			if reference.ID == expressionId && id != expressionId && (name == "" || reference.Name == name) {
+				dependents = append(dependents, id)
+				break
+			}
+		}
+	}
+	sort.Ints(dependents)
+	return dependents
+}
+
+func (s *Stub) saveReferences(expressionId int, references []model.Reference) {
+	if s.References == nil {
+		s.References = make(map[int][]model.Reference)
+	}
+	s.References[expressionId] = references
+}
+
+func (s *Stub) Ping(ctx context.Context) error {
+	return s.PingError
+}
+
+func (s *Stub) CheckMigrations(ctx context.Context) error {
+	return s.CheckMigrationsError
 }
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	_gorm "github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("should return the query error", func(t *testing.T) {
+		queryErr := errors.New("connection reset")
+		err := run(context.Background(), func() error { return queryErr })
+		assert.Equal(t, queryErr, err)
+	})
+
+	t.Run("should not start the query when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		called := false
+		err := run(ctx, func() error {
+			called = true
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.False(t, called)
+	})
+
+	t.Run("should report the context error of a cancelled query", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		err := run(ctx, func() error {
+			cancel()
+			return errors.New("pq: canceling statement due to user request")
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+// blockingDriver holds every statement until its context is done, like a
+// database working on a slow query, and counts the statements it cancelled.
+type blockingDriver struct {
+	cancelled chan struct{}
+}
+
+func (d *blockingDriver) Open(string) (driver.Conn, error) {
+	return &blockingConn{driver: d}, nil
+}
+
+type blockingConn struct {
+	driver *blockingDriver
+}
+
+func (c *blockingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("statements must be run with a context")
+}
+
+func (c *blockingConn) Close() error {
+	return nil
+}
+
+func (c *blockingConn) Begin() (driver.Tx, error) {
+	return blockingTx{}, nil
+}
+
+// blockingTx lets transactions start, so their statements are the ones held.
+type blockingTx struct{}
+
+func (blockingTx) Commit() error {
+	return nil
+}
+
+func (blockingTx) Rollback() error {
+	return nil
+}
+
+func (c *blockingConn) QueryContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	<-ctx.Done()
+	c.driver.cancelled <- struct{}{}
+	return nil, errors.New("pq: canceling statement due to user request")
+}
+
+func (c *blockingConn) ExecContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Result, error) {
+	<-ctx.Done()
+	c.driver.cancelled <- struct{}{}
+	return nil, errors.New("pq: canceling statement due to user request")
+}
+
+var blocking = &blockingDriver{cancelled: make(chan struct{}, 10)}
+
+func init() {
+	sql.Register("blocking", blocking)
+}
+
+func TestRepositoryCancelsQueries(t *testing.T) {
+	sqlDB, err := sql.Open("blocking", "")
+	assert.NoError(t, err)
+	defer sqlDB.Close()
+
+	db, err := _gorm.Open("postgres", sqlDB)
+	assert.NoError(t, err)
+	r := Repository{db: db}
+
+	testCases := []struct {
+		name  string
+		query func(ctx context.Context) error
+	}{
+		{
+			name: "should cancel reads",
+			query: func(ctx context.Context) error {
+				_, err := r.GetExpressionById(ctx, 1)
+				return err
+			},
+		},
+		{
+			name: "should cancel writes",
+			query: func(ctx context.Context) error {
+				return r.DeleteExpression(ctx, 1, false)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			err := tc.query(ctx)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+			select {
+			case <-blocking.cancelled:
+			default:
+				t.Fatal("the driver should have been told to cancel the statement")
+			}
+			// a cancelled transaction is rolled back, and its connection
+			// released, in the background
+			assert.Eventually(t, func() bool { return sqlDB.Stats().InUse == 0 }, time.Second, time.Millisecond, "the connection should be back in the pool")
+		})
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	assert.ErrorIs(t, queryError(context.DeadlineExceeded), context.DeadlineExceeded)
+	assert.ErrorIs(t, queryError(context.Canceled), context.Canceled)
+	assert.ErrorIs(t, queryError(sql.ErrNoRows), ErrExpressionNotFound)
+	assert.ErrorIs(t, queryError(ErrExpressionNotFound), ErrExpressionNotFound)
+	assert.ErrorIs(t, queryError(&pq.Error{Code: uniqueViolation}), ErrNameTaken)
+	assert.ErrorIs(t, queryError(&pq.Error{Code: foreignKeyViolation}), ErrReferenceNotFound)
+	assert.ErrorIs(t, queryError(&DependentsError{Err: ErrHasDependents, Dependents: []int{2}}), ErrHasDependents)
+	assert.ErrorIs(t, queryError(&DependentsError{Err: ErrNameReferenced, Dependents: []int{2}}), ErrNameReferenced)
+	assert.ErrorIs(t, queryError(errors.New("pq: relation does not exist")), ErrQueryFailed)
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/evaluator"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/logging"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/tracing"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var ErrAnalysisTooLarge = errors.New(util.ErrAnalysisTooLarge)
+
+// MaxAnalysisVariables bounds the search behind Analyze, which is exponential
+// in the number of variables for definitions that do not simplify early.
+const MaxAnalysisVariables = 20
+
+// Analyze decides whether a boolean expression can be true, can be false, or
+// both, returning an assignment for each case that exists.
+func (es *ExpressionService) Analyze(ctx context.Context, expression model.Expression) (model.Analysis, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ExpressionService.Analyze")
+	defer span.End()
+	span.SetAttributes(attribute.Int("expression.id", expression.ID))
+
+	logger := logging.FromContext(ctx).WithField(logging.FieldExpressionId, expression.ID)
+
+	compiled, err := es.compileWithTree(ctx, expression, FeatureAnalysis)
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.WithField("err", err.Error()).Error("error creating evaluable expression")
+		return model.Analysis{}, err
+	}
+
+	analysis, err := analyze(ctx, compiled.node)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return model.Analysis{}, err
+	}
+
+	span.SetAttributes(
+		attribute.Bool("expression.satisfiable", analysis.Satisfiable),
+		attribute.Bool("expression.tautology", analysis.Tautology),
+	)
+	return analysis, nil
+}
+
+func analyze(ctx context.Context, node parser.Node) (model.Analysis, error) {
+	variables, err := booleanVariables(node)
+	if err != nil {
+		return model.Analysis{}, err
+	}
+	if len(variables) > MaxAnalysisVariables {
+		return model.Analysis{}, fmt.Errorf("%w: %d variables, at most %d allowed", ErrAnalysisTooLarge, len(variables), MaxAnalysisVariables)
+	}
+
+	witness, err := satisfy(ctx, node, true, variables)
+	if err != nil {
+		return model.Analysis{}, err
+	}
+	counterexample, err := satisfy(ctx, node, false, variables)
+	if err != nil {
+		return model.Analysis{}, err
+	}
+
+	return model.Analysis{
+		Satisfiable:    witness != nil,
+		Tautology:      counterexample == nil,
+		Contradiction:  witness == nil,
+		Witness:        witness,
+		Counterexample: counterexample,
+	}, nil
+}
+
+// satisfy looks for an assignment of variables under which node evaluates to
+// want, returning nil when there is none. It splits on one variable at a time
+// and simplifies after each choice, so a branch is abandoned as soon as the
+// connectives decide it. Variables the result does not depend on are false.
+func satisfy(ctx context.Context, node parser.Node, want bool, variables []string) (map[string]bool, error) {
+	assignment := make(map[string]bool, len(variables))
+	found, err := search(ctx, node, want, assignment)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	for _, name := range variables {
+		if _, assigned := assignment[name]; !assigned {
+			assignment[name] = false
+		}
+	}
+	return assignment, nil
+}
+
+func search(ctx context.Context, node parser.Node, want bool, assignment map[string]bool) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	remaining := parser.Variables(node)
+	if len(remaining) == 0 {
+		value, err := constantValue(ctx, node)
+		if err != nil {
+			return false, err
+		}
+		return value == want, nil
+	}
+
+	name := remaining[0]
+	for _, value := range []bool{true, false} {
+		assignment[name] = value
+		found, err := search(ctx, assign(node, name, value), want, assignment)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	delete(assignment, name)
+	return false, nil
+}
+
+// constantValue evaluates a node without variables, which must be boolean.
+func constantValue(ctx context.Context, node parser.Node) (bool, error) {
+	if value, isBool := boolLiteral(node); isBool {
+		return value, nil
+	}
+
+	result, err := evaluateConstant(ctx, node)
+	if err != nil {
+		return false, fmt.Errorf("%w: %s", ErrEvaluatingExpression, err)
+	}
+	value, isBool := result.(bool)
+	if !isBool {
+		return false, fmt.Errorf("%w: %s is not a boolean", ErrEvaluatingExpression, node.String())
+	}
+	return value, nil
+}
+
+// assign replaces the variable with a boolean literal and folds what becomes
+// constant: connectives are simplified with their identities, and other
+// operators are evaluated once none of their operands are variables.
+func assign(node parser.Node, name string, value bool) parser.Node {
+	switch n := node.(type) {
+	case *parser.Variable:
+		if n.Name == name {
+			return &parser.Literal{Value: value}
+		}
+	case *parser.Unary:
+		operand := assign(n.Operand, name, value)
+		if n.Operator == parser.OpNot {
+			return not(operand)
+		}
+		return foldConstant(&parser.Unary{Operator: n.Operator, Operand: operand})
+	case *parser.Binary:
+		left, right := assign(n.Left, name, value), assign(n.Right, name, value)
+		if n.Operator.IsLogical() {
+			return foldLogical(n.Operator, left, right)
+		}
+		return foldConstant(&parser.Binary{Operator: n.Operator, Left: left, Right: right})
+	case *parser.Call:
+		args := make([]parser.Node, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = assign(arg, name, value)
+		}
+		return foldConstant(&parser.Call{Name: n.Name, Args: args, Function: n.Function})
+	case *parser.List:
+		elements := make([]parser.Node, len(n.Elements))
+		for i, element := range n.Elements {
+			elements[i] = assign(element, name, value)
+		}
+		return &parser.List{Elements: elements}
+	}
+	return node
+}
+
+func not(operand parser.Node) parser.Node {
+	if value, isBool := boolLiteral(operand); isBool {
+		return &parser.Literal{Value: !value}
+	}
+	if inner, isNot := operand.(*parser.Unary); isNot && inner.Operator == parser.OpNot {
+		return inner.Operand
+	}
+	return &parser.Unary{Operator: parser.OpNot, Operand: operand}
+}
+
+// foldLogical builds the connective, simplifying it when an operand is a
+// boolean literal.
+func foldLogical(operator parser.Operator, left, right parser.Node) parser.Node {
+	l, leftIsBool := boolLiteral(left)
+	r, rightIsBool := boolLiteral(right)
+
+	switch operator {
+	case parser.OpAnd:
+		switch {
+		case leftIsBool && !l, rightIsBool && !r:
+			return &parser.Literal{Value: false}
+		case leftIsBool:
+			return right
+		case rightIsBool:
+			return left
+		}
+	case parser.OpOr:
+		switch {
+		case leftIsBool && l, rightIsBool && r:
+			return &parser.Literal{Value: true}
+		case leftIsBool:
+			return right
+		case rightIsBool:
+			return left
+		}
+	case parser.OpImplies:
+		switch {
+		case leftIsBool && !l, rightIsBool && r:
+			return &parser.Literal{Value: true}
+		case leftIsBool:
+			return right
+		case rightIsBool:
+			return not(left)
+		}
+	case parser.OpXor:
+		switch {
+		case leftIsBool && l:
+			return not(right)
+		case leftIsBool:
+			return right
+		case rightIsBool && r:
+			return not(left)
+		case rightIsBool:
+			return left
+		}
+	case parser.OpIff:
+		switch {
+		case leftIsBool && l:
+			return right
+		case leftIsBool:
+			return not(right)
+		case rightIsBool && r:
+			return left
+		case rightIsBool:
+			return not(left)
+		}
+	}
+	return &parser.Binary{Operator: operator, Left: left, Right: right}
+}
+
+// foldConstant replaces a non-logical node without variables by its value,
+// leaving it untouched when it cannot be evaluated so the error surfaces later.
+// Such nodes are small, so they are evaluated without a deadline.
+func foldConstant(node parser.Node) parser.Node {
+	if len(parser.Variables(node)) > 0 {
+		return node
+	}
+	value, err := evaluateConstant(context.Background(), node)
+	if err != nil {
+		return node
+	}
+	switch value.(type) {
+	case bool, float64, string:
+		return &parser.Literal{Value: value}
+	}
+	return node
+}
+
+// evaluateConstant compiles and evaluates a node without variables with the
+// built-in evaluator, whatever the Engine of the service: the nodes are built
+// during the search and compiled each time. With another Engine the analyses
+// follow the semantics of the evaluator, which that engine may not share.
+func evaluateConstant(ctx context.Context, node parser.Node) (interface{}, error) {
+	program, err := evaluator.Compile(node)
+	if err != nil {
+		return nil, err
+	}
+	return program.Evaluate(ctx, map[string]interface{}{})
+}
+
+func boolLiteral(node parser.Node) (bool, bool) {
+	literal, isLiteral := node.(*parser.Literal)
+	if !isLiteral {
+		return false, false
+	}
+	value, isBool := literal.Value.(bool)
+	return value, isBool
+}
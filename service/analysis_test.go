@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExpression_Analyze(t *testing.T) {
+	testCases := []struct {
+		name       string
+		definition string
+		expected   model.Analysis
+		err        error
+	}{
+		{
+			name:       "should find both assignments of a contingent expression",
+			definition: "x and not y",
+			expected: model.Analysis{
+				Satisfiable:    true,
+				Witness:        map[string]bool{"x": true, "y": false},
+				Counterexample: map[string]bool{"x": true, "y": true},
+			},
+		},
+		{
+			name:       "should detect contradictions",
+			definition: "x and not x",
+			expected: model.Analysis{
+				Contradiction:  true,
+				Counterexample: map[string]bool{"x": true},
+			},
+		},
+		{
+			name:       "should detect tautologies",
+			definition: "(a and b) or (a and not b) or not a",
+			expected: model.Analysis{
+				Satisfiable: true,
+				Tautology:   true,
+				Witness:     map[string]bool{"a": true, "b": true},
+			},
+		},
+		{
+			name:       "should set variables the result does not depend on to false",
+			definition: "x or y",
+			expected: model.Analysis{
+				Satisfiable:    true,
+				Witness:        map[string]bool{"x": true, "y": false},
+				Counterexample: map[string]bool{"x": false, "y": false},
+			},
+		},
+		{
+			name:       "should analyse constant definitions",
+			definition: "1 > 2",
+			expected: model.Analysis{
+				Contradiction:  true,
+				Counterexample: map[string]bool{},
+			},
+		},
+		{
+			name:       "should analyse equality between boolean variables",
+			definition: "(x == y) xor (x iff y)",
+			expected: model.Analysis{
+				Contradiction:  true,
+				Counterexample: map[string]bool{"x": true, "y": true},
+			},
+		},
+		{
+			name:       "should reject variables used as numbers",
+			definition: "age > 18",
+			err:        ErrNotBooleanVariables,
+		},
+		{
+			name:       "should reject invalid definitions",
+			definition: "x and",
+			err:        ErrCreatingEvaluableExpression,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			es := ExpressionService{}
+			analysis, err := es.Analyze(context.Background(), model.Expression{ID: 1, Definition: tc.definition})
+
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, tc.expected, analysis)
+		})
+	}
+}
+
+func TestExpression_AnalyzeTooLarge(t *testing.T) {
+	variables := make([]string, MaxAnalysisVariables+1)
+	for i := range variables {
+		variables[i] = "x" + strconv.Itoa(i)
+	}
+
+	es := ExpressionService{}
+	_, err := es.Analyze(context.Background(), model.Expression{ID: 1, Definition: strings.Join(variables, " or ")})
+
+	assert.ErrorIs(t, err, ErrAnalysisTooLarge)
+}
+
+func TestAssign(t *testing.T) {
+	testCases := []struct {
+		definition string
+		name       string
+		value      bool
+		expected   string
+	}{
+		{definition: "x and y", name: "x", value: true, expected: "y"},
+		{definition: "x and y", name: "x", value: false, expected: "FALSE"},
+		{definition: "x or y", name: "y", value: false, expected: "x"},
+		{definition: "x implies y", name: "y", value: false, expected: "NOT x"},
+		{definition: "x xor y", name: "x", value: true, expected: "NOT y"},
+		{definition: "not (x iff y)", name: "y", value: false, expected: "x"},
+		{definition: "x == y", name: "x", value: true, expected: "TRUE == y"},
+		{definition: "a or (x and b)", name: "x", value: false, expected: "a"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.definition, func(t *testing.T) {
+			node, err := parser.Parse(tc.definition)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, assign(node, tc.name, tc.value).String())
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"container/list"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/metrics"
+	"sync"
+)
+
+// ExpressionCache keeps the most recently used compiled expressions, keyed by
+// their definition so an updated definition never hits a stale entry. The
+// generation counts the invalidations, so that an expression compiled from
+// references read before one is not added after it.
+type ExpressionCache struct {
+	mu         sync.Mutex
+	capacity   int
+	generation uint64
+	entries    map[string]*list.Element
+	order      *list.List
+}
+
+type cacheEntry struct {
+	key        string
+	expression *compiledExpression
+}
+
+type CacheStats struct {
+	Entries  int `json:"entries"`
+	Capacity int `json:"capacity"`
+}
+
+func NewExpressionCache(capacity int) *ExpressionCache {
+	return &ExpressionCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+func (c *ExpressionCache) Get(key string) (*compiledExpression, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, exists := c.entries[key]
+	if !exists {
+		metrics.CacheMissesTotal.Inc()
+		return nil, false
+	}
+
+	metrics.CacheHitsTotal.Inc()
+	c.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).expression, true
+}
+
+func (c *ExpressionCache) Add(key string, expression *compiledExpression) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.add(key, expression)
+}
+
+// Generation returns the current generation, to pass to AddIfCurrent.
+func (c *ExpressionCache) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+// AddIfCurrent adds the expression unless the cache was invalidated since
+// the given generation, and reports whether it was added.
+func (c *ExpressionCache) AddIfCurrent(key string, expression *compiledExpression, generation uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation != generation {
+		return false
+	}
+	c.add(key, expression)
+	return true
+}
+
+func (c *ExpressionCache) add(key string, expression *compiledExpression) {
+	if element, exists := c.entries[key]; exists {
+		element.Value.(*cacheEntry).expression = expression
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, expression: expression})
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		metrics.CacheEvictionsTotal.Inc()
+	}
+	metrics.CacheEntries.Set(float64(c.order.Len()))
+}
+
+// RemoveDependents drops the entries that inline the given expression and
+// returns how many were dropped.
+func (c *ExpressionCache) RemoveDependents(expressionId int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	removed := 0
+	for key, element := range c.entries {
+		if element.Value.(*cacheEntry).expression.dependsOn(expressionId) {
+			c.order.Remove(element)
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	metrics.CacheEntries.Set(float64(c.order.Len()))
+	return removed
+}
+
+func (c *ExpressionCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.entries = make(map[string]*list.Element, c.capacity)
+	c.order.Init()
+	metrics.CacheEntries.Set(0)
+}
+
+func (c *ExpressionCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Entries:  c.order.Len(),
+		Capacity: c.capacity,
+	}
+}
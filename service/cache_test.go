@@ -0,0 +1,35 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExpressionCache(t *testing.T) {
+	compiled := &compiledExpression{}
+
+	cache := NewExpressionCache(2)
+	cache.Add("a", compiled)
+	cache.Add("b", compiled)
+
+	_, exists := cache.Get("a")
+	assert.True(t, exists, "recently added entry should be cached")
+
+	cache.Add("c", compiled)
+
+	_, exists = cache.Get("b")
+	assert.False(t, exists, "least recently used entry should be evicted")
+	_, exists = cache.Get("a")
+	assert.True(t, exists, "recently used entry should be kept")
+	assert.Equal(t, CacheStats{Entries: 2, Capacity: 2}, cache.Stats())
+
+	cache.Purge()
+	assert.Equal(t, CacheStats{Entries: 0, Capacity: 2}, cache.Stats())
+
+	generation := cache.Generation()
+	assert.True(t, cache.AddIfCurrent("a", compiled, generation), "entry compiled in the current generation should be added")
+	cache.RemoveDependents(1)
+	assert.False(t, cache.AddIfCurrent("b", compiled, generation), "entry compiled before an invalidation should be dropped")
+	_, exists = cache.Get("b")
+	assert.False(t, exists)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/tracing"
+	"sort"
+)
+
+// DependencyGraph maps which of the given expressions reference which, and
+// the variables each one uses directly. References are matched by id or name
+// within expressions; the ones matching nothing are reported as unresolved.
+func (es *ExpressionService) DependencyGraph(ctx context.Context, expressions []model.Expression) model.DependencyGraph {
+	ctx, span := tracing.Tracer().Start(ctx, "ExpressionService.DependencyGraph")
+	defer span.End()
+
+	ids := make(map[int]bool, len(expressions))
+	names := make(map[string]int, len(expressions))
+	for _, expression := range expressions {
+		ids[expression.ID] = true
+		if expression.Name != "" {
+			names[expression.Name] = expression.ID
+		}
+	}
+
+	nodes := make([]model.DependencyNode, 0, len(expressions))
+	dependents := make(map[int][]int)
+	for _, expression := range expressions {
+		node := model.DependencyNode{
+			ID:         expression.ID,
+			Name:       expression.Name,
+			References: []int{},
+			Dependents: []int{},
+			Variables:  []string{},
+		}
+
+		parse, translates := translator(expression.Dialect)
+		if !translates {
+			variables, err := es.dialectVariables(ctx, expression)
+			if err != nil {
+				node.Error = err.Error()
+			}
+			node.Variables = append(node.Variables, variables...)
+			nodes = append(nodes, node)
+			continue
+		}
+
+		tree, err := parse(expression.Definition)
+		if err != nil {
+			node.Error = err.Error()
+			nodes = append(nodes, node)
+			continue
+		}
+
+		node.Variables = append(node.Variables, parser.Variables(tree)...)
+		for _, target := range parser.References(tree) {
+			id, isId := (&parser.Reference{Target: target}).ID()
+			if !isId {
+				id, isId = names[target]
+			}
+			if !isId || !ids[id] {
+				node.UnresolvedReferences = append(node.UnresolvedReferences, target)
+				continue
+			}
+			node.References = appendUnique(node.References, id)
+			dependents[id] = appendUnique(dependents[id], expression.ID)
+		}
+		sort.Ints(node.References)
+		nodes = append(nodes, node)
+	}
+
+	for i := range nodes {
+		nodes[i].Dependents = append(nodes[i].Dependents, dependents[nodes[i].ID]...)
+		sort.Ints(nodes[i].Dependents)
+	}
+	sort.Slice(nodes, func(a, b int) bool { return nodes[a].ID < nodes[b].ID })
+
+	return model.DependencyGraph{Expressions: nodes}
+}
+
+// dialectVariables lists the variables of an expression whose dialect has no
+// syntax tree, and so no references either.
+func (es *ExpressionService) dialectVariables(ctx context.Context, expression model.Expression) ([]string, error) {
+	engine, err := es.engine(expression.Dialect)
+	if err != nil {
+		return nil, err
+	}
+	program, err := engine.Compile(ctx, Source{Definition: expression.Definition})
+	if err != nil {
+		return nil, err
+	}
+	return program.Variables(), nil
+}
+
+// DependencySubgraph keeps the expression with the given id, everything it
+// references and everything referencing it, transitively. It reports false
+// when the graph has no such expression.
+func DependencySubgraph(graph model.DependencyGraph, expressionId int) (model.DependencyGraph, bool) {
+	byId := make(map[int]model.DependencyNode, len(graph.Expressions))
+	for _, node := range graph.Expressions {
+		byId[node.ID] = node
+	}
+	if _, exists := byId[expressionId]; !exists {
+		return model.DependencyGraph{}, false
+	}
+
+	keep := map[int]bool{expressionId: true}
+	for _, edges := range []func(model.DependencyNode) []int{
+		func(node model.DependencyNode) []int { return node.References },
+		func(node model.DependencyNode) []int { return node.Dependents },
+	} {
+		pending := []int{expressionId}
+		visited := map[int]bool{expressionId: true}
+		for len(pending) > 0 {
+			id := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			for _, next := range edges(byId[id]) {
+				if !visited[next] {
+					visited[next] = true
+					keep[next] = true
+					pending = append(pending, next)
+				}
+			}
+		}
+	}
+
+	subgraph := model.DependencyGraph{Expressions: []model.DependencyNode{}}
+	for _, node := range graph.Expressions {
+		if keep[node.ID] {
+			subgraph.Expressions = append(subgraph.Expressions, node)
+		}
+	}
+	return subgraph, true
+}
+
+func appendUnique(ids []int, id int) []int {
+	for _, existing := range ids {
+		if existing == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
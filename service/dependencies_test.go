@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"testing"
+)
+
+func TestExpression_DependencyGraph(t *testing.T) {
+	expressions := []model.Expression{
+		{ID: 3, Definition: "@isPremium or @1 or @missing"},
+		{ID: 1, Name: "isActive", Definition: "active and not banned"},
+		{ID: 2, Name: "isPremium", Definition: "@isActive and premium"},
+		{ID: 4, Definition: "a and"},
+		{ID: 5, Definition: "other"},
+		{ID: 6, Definition: "c || b && c", Dialect: model.DialectGovaluate},
+		{ID: 7, Definition: "user.age >= 18", Dialect: model.DialectCEL},
+	}
+
+	es := ExpressionService{}
+	graph := es.DependencyGraph(context.Background(), expressions)
+
+	assert.Equal(t, model.DependencyGraph{Expressions: []model.DependencyNode{
+		{ID: 1, Name: "isActive", References: []int{}, Dependents: []int{2, 3}, Variables: []string{"active", "banned"}},
+		{ID: 2, Name: "isPremium", References: []int{1}, Dependents: []int{3}, Variables: []string{"premium"}},
+		{ID: 3, References: []int{1, 2}, Dependents: []int{}, Variables: []string{}, UnresolvedReferences: []string{"missing"}},
+		{ID: 4, References: []int{}, Dependents: []int{}, Variables: []string{}, Error: "syntax error at position 5: unexpected end of definition"},
+		{ID: 5, References: []int{}, Dependents: []int{}, Variables: []string{"other"}},
+		{ID: 6, References: []int{}, Dependents: []int{}, Variables: []string{"b", "c"}},
+		{ID: 7, References: []int{}, Dependents: []int{}, Variables: []string{"user.age"}},
+	}}, graph)
+
+	subgraph, exists := DependencySubgraph(graph, 2)
+	assert.True(t, exists)
+	assert.Equal(t, []model.DependencyNode{graph.Expressions[0], graph.Expressions[1], graph.Expressions[2]}, subgraph.Expressions)
+
+	subgraph, exists = DependencySubgraph(graph, 5)
+	assert.True(t, exists)
+	assert.Equal(t, []model.DependencyNode{graph.Expressions[4]}, subgraph.Expressions)
+
+	_, exists = DependencySubgraph(graph, 42)
+	assert.False(t, exists)
+}
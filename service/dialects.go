@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/cel"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+)
+
+var ErrUnsupportedDialect = errors.New(util.ErrUnsupportedDialect)
+
+// The features a DialectError names.
+const (
+	FeatureExplanations       = "explanations"
+	FeatureAnalysis           = "analysis"
+	FeatureSimplification     = "simplification"
+	FeatureTruthTables        = "truth tables"
+	FeatureEquivalence        = "equivalence checks"
+	FeatureReferences         = "references"
+	FeatureFunctions          = "function calls"
+	FeaturePaths              = "variable paths"
+	FeatureRegularExpressions = "regular expressions"
+)
+
+// DialectError reports a feature the dialect of an expression does not
+// support, so clients learn which part of the request to change.
+type DialectError struct {
+	Dialect model.Dialect
+	Feature string
+}
+
+func (e *DialectError) Error() string {
+	return fmt.Sprintf("%s: %s", util.ErrUnsupportedDialect, e.Reason())
+}
+
+// Reason names the dialect and the feature it lacks.
+func (e *DialectError) Reason() string {
+	return fmt.Sprintf("%s does not support %s", e.Dialect, e.Feature)
+}
+
+func (e *DialectError) Unwrap() error {
+	return ErrUnsupportedDialect
+}
+
+// translators parse the dialects that translate into the syntax tree of the
+// native rule language. Their expressions can reference and be referenced by
+// native ones, support explanations, truth tables and the analyses, and their
+// engine is handed the tree.
+var translators = map[model.Dialect]func(definition string) (parser.Node, error){
+	model.DialectNative: parser.Parse,
+	model.DialectCEL:    cel.Parse,
+}
+
+// engines are the built-in engines of each dialect.
+var engines = map[model.Dialect]Engine{
+	model.DialectNative:    NativeEngine{},
+	model.DialectCEL:       NativeEngine{},
+	model.DialectGovaluate: GovaluateEngine{},
+}
+
+// translator returns the parser of a dialect, if it translates into the
+// native syntax tree. An empty dialect is the native one.
+func translator(dialect model.Dialect) (func(definition string) (parser.Node, error), bool) {
+	if dialect == "" {
+		dialect = model.DialectNative
+	}
+	parse, exists := translators[dialect]
+	return parse, exists
+}
+
+// engine returns the engine of a dialect: the one configured in Engines, or
+// the built-in one. An empty dialect is the native one.
+func (es *ExpressionService) engine(dialect model.Dialect) (Engine, error) {
+	if dialect == "" {
+		dialect = model.DialectNative
+	}
+	if engine, exists := es.Engines[dialect]; exists {
+		return engine, nil
+	}
+	if engine, exists := engines[dialect]; exists {
+		return engine, nil
+	}
+	return nil, fmt.Errorf("%w: unknown dialect %q", ErrUnsupportedDialect, dialect)
+}
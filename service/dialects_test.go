@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
+	"testing"
+)
+
+func TestExpression_ExecuteExpressionDialects(t *testing.T) {
+	source := &repository.Stub{Expressions: []model.Expression{
+		{ID: 1, Name: "isAdult", Definition: "age >= 18", Dialect: model.DialectCEL},
+		{ID: 2, Name: "isActive", Definition: "active and not banned"},
+		{ID: 3, Name: "legacy", Definition: "a && b", Dialect: model.DialectGovaluate},
+	}}
+
+	testCases := []struct {
+		name       string
+		expression model.Expression
+		urlParams  string
+		options    EvaluationOptions
+		expected   model.Outcome
+		err        error
+	}{
+		{
+			name:       "should evaluate native definitions by default",
+			expression: model.Expression{ID: 10, Definition: "a and not b"},
+			urlParams:  "a=1,b=0",
+			expected:   model.OutcomeTrue,
+		},
+		{
+			name:       "should evaluate CEL definitions",
+			expression: model.Expression{ID: 10, Definition: `name.startsWith("A") && size(tags) > 1`, Dialect: model.DialectCEL},
+			urlParams:  "name=Ana,tags=[a,b]",
+			expected:   model.OutcomeTrue,
+		},
+		{
+			name:       "should evaluate govaluate definitions",
+			expression: model.Expression{ID: 10, Definition: "(a || b) && name == 'bob' && n * 2 > 3", Dialect: model.DialectGovaluate},
+			urlParams:  "a=0,b=1,name=bob,n=2",
+			expected:   model.OutcomeTrue,
+		},
+		{
+			name:       "should reference CEL expressions from native ones",
+			expression: model.Expression{ID: 10, Definition: "@isAdult and @isActive"},
+			urlParams:  "age=20,active=1,banned=0",
+			expected:   model.OutcomeTrue,
+		},
+		{
+			name:       "should reject references to govaluate expressions",
+			expression: model.Expression{ID: 10, Definition: "@legacy or c"},
+			err:        ErrUnsupportedDialect,
+		},
+		{
+			name:       "should reject definitions that are not valid in their dialect",
+			expression: model.Expression{ID: 10, Definition: "a and b", Dialect: model.DialectCEL},
+			err:        ErrCreatingEvaluableExpression,
+		},
+		{
+			name:       "should apply the false policy to govaluate definitions",
+			expression: model.Expression{ID: 10, Definition: "a || b", Dialect: model.DialectGovaluate},
+			urlParams:  "b=0",
+			options:    EvaluationOptions{MissingVariables: model.MissingVariablesFalse},
+			expected:   model.OutcomeFalse,
+		},
+		{
+			name:       "should apply the unknown policy to govaluate definitions",
+			expression: model.Expression{ID: 10, Definition: "a || b", Dialect: model.DialectGovaluate},
+			urlParams:  "b=1",
+			options:    EvaluationOptions{MissingVariables: model.MissingVariablesUnknown},
+			expected:   model.OutcomeUnknown,
+		},
+		{
+			name:       "should reject explanations of govaluate definitions",
+			expression: model.Expression{ID: 10, Definition: "a || b", Dialect: model.DialectGovaluate},
+			urlParams:  "a=1,b=0",
+			options:    EvaluationOptions{Explain: true},
+			err:        ErrUnsupportedDialect,
+		},
+		{
+			name:       "should reject unknown dialects",
+			expression: model.Expression{ID: 10, Definition: "a", Dialect: "sql"},
+			err:        ErrUnsupportedDialect,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			es := ExpressionService{Source: source}
+			response, err := es.ExecuteExpression(context.Background(), tc.expression, tc.urlParams, tc.options)
+
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, tc.expected, response.Outcome)
+		})
+	}
+}
+
+func TestExpression_VariablesDialects(t *testing.T) {
+	es := ExpressionService{}
+	ctx := context.Background()
+
+	variables, err := es.Variables(ctx, model.Expression{Definition: "b > 1 && a || b < 0", Dialect: model.DialectGovaluate})
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Variable{{Name: "a", Type: "any"}, {Name: "b", Type: "any"}}, variables)
+
+	variables, err = es.Variables(ctx, model.Expression{Definition: "user.age > 1 && ok", Dialect: model.DialectCEL})
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Variable{{Name: "ok", Type: "boolean"}, {Name: "user.age", Type: "number"}}, variables)
+
+	_, err = es.Analyze(ctx, model.Expression{Definition: "a && b", Dialect: model.DialectGovaluate})
+	assert.ErrorIs(t, err, ErrUnsupportedDialect)
+
+	analysis, err := es.Analyze(ctx, model.Expression{Definition: "a && !a", Dialect: model.DialectCEL})
+	assert.NoError(t, err)
+	assert.True(t, analysis.Contradiction)
+}
+
+type allowEngine struct{}
+
+func (allowEngine) Compile(context.Context, Source) (Program, error) {
+	return allowProgram{}, nil
+}
+
+type allowProgram struct{}
+
+func (allowProgram) Evaluate(context.Context, map[string]interface{}) (interface{}, error) {
+	return true, nil
+}
+
+func (allowProgram) Variables() []string {
+	return nil
+}
+
+func TestExpression_ExecuteExpressionDialectEngines(t *testing.T) {
+	es := ExpressionService{
+		Cache:   NewExpressionCache(10),
+		Engines: map[model.Dialect]Engine{model.DialectGovaluate: allowEngine{}},
+	}
+	ctx := context.Background()
+
+	response, err := es.ExecuteExpression(ctx, model.Expression{ID: 1, Definition: "a", Dialect: model.DialectGovaluate}, "a=0", EvaluationOptions{})
+	assert.NoError(t, err)
+	assert.True(t, response.Result, "the result should come from the configured engine")
+
+	response, err = es.ExecuteExpression(ctx, model.Expression{ID: 2, Definition: "a"}, "a=0", EvaluationOptions{})
+	assert.NoError(t, err)
+	assert.False(t, response.Result, "the same definition in another dialect should be compiled apart")
+	assert.Equal(t, 2, es.Cache.Stats().Entries)
+}
+
+func TestGovaluateEngine_UnsupportedFeatures(t *testing.T) {
+	testCases := []struct {
+		name       string
+		definition string
+		feature    string
+	}{
+		{
+			name:       "should reject function calls",
+			definition: "len(name) > 1",
+			feature:    FeatureFunctions,
+		},
+		{
+			name:       "should reject variable paths",
+			definition: "[user.age] > 18",
+			feature:    FeaturePaths,
+		},
+		{
+			name:       "should reject regular expressions",
+			definition: "email =~ '@example.com$'",
+			feature:    FeatureRegularExpressions,
+		},
+		{
+			name:       "should reject negated regular expressions",
+			definition: "email !~ '@example.com$'",
+			feature:    FeatureRegularExpressions,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := GovaluateEngine{}.Compile(context.Background(), Source{Definition: tc.definition})
+
+			var dialectError *DialectError
+			assert.ErrorAs(t, err, &dialectError)
+			assert.ErrorIs(t, err, ErrUnsupportedDialect)
+			assert.Equal(t, &DialectError{Dialect: model.DialectGovaluate, Feature: tc.feature}, dialectError)
+		})
+	}
+}
+
+func TestExpression_DialectErrors(t *testing.T) {
+	es := ExpressionService{Source: &repository.Stub{Expressions: []model.Expression{
+		{ID: 3, Name: "legacy", Definition: "a && b", Dialect: model.DialectGovaluate},
+	}}}
+	ctx := context.Background()
+	legacy := model.Expression{ID: 1, Definition: "a && b", Dialect: model.DialectGovaluate}
+
+	_, err := es.ExecuteExpression(ctx, legacy, "a=1,b=1", EvaluationOptions{Explain: true})
+	assert.Equal(t, &DialectError{Dialect: model.DialectGovaluate, Feature: FeatureExplanations}, err)
+
+	_, err = es.Analyze(ctx, legacy)
+	assert.EqualError(t, err, "expression dialect does not support this operation: govaluate does not support analysis")
+
+	_, err = es.TruthTable(ctx, legacy)
+	assert.EqualError(t, err, "expression dialect does not support this operation: govaluate does not support truth tables")
+
+	_, err = es.ExecuteExpression(ctx, model.Expression{ID: 2, Definition: "@legacy"}, "a=1,b=1", EvaluationOptions{})
+	assert.EqualError(t, err, "referenced expression 3: expression dialect does not support this operation: govaluate does not support references")
+}
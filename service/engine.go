@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/evaluator"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+)
+
+// Source is what an Engine compiles: the definition as written and, for the
+// dialects that translate into the syntax tree of the rule language, that tree
+// with its references inlined, its calls bound and MATCHES patterns compiled.
+// Explanations and the unknown policy also compile sub-expressions of the tree
+// on their own, with Definition empty.
+type Source struct {
+	Definition string
+	Tree       parser.Node
+}
+
+// Engine compiles the definitions of a dialect into a Program. Compile is also
+// how definitions are validated on create and update, so it must reject every
+// definition it cannot run. Errors not wrapping ErrUnsupportedDialect are
+// reported as ErrCreatingEvaluableExpression.
+type Engine interface {
+	Compile(ctx context.Context, source Source) (Program, error)
+}
+
+// Program evaluates a compiled definition. Programs are cached and shared, so
+// they must be safe for concurrent use. Evaluate should stop with the context
+// error once ctx is done, so cancelled and timed out evaluations do not keep
+// running. Variables names the variables the program reads, sorted, so
+// missing values are handled by the policy of the expression.
+type Program interface {
+	Evaluate(ctx context.Context, values map[string]interface{}) (interface{}, error)
+	Variables() []string
+}
+
+// NativeEngine compiles syntax trees with the evaluator package. It is the
+// engine of the native and cel dialects unless Engines replaces it.
+type NativeEngine struct{}
+
+func (NativeEngine) Compile(ctx context.Context, source Source) (Program, error) {
+	program, err := evaluator.Compile(source.Tree)
+	if err != nil {
+		return nil, err
+	}
+	return nativeProgram{Program: program, variables: parser.Variables(source.Tree)}, nil
+}
+
+type nativeProgram struct {
+	*evaluator.Program
+	variables []string
+}
+
+func (p nativeProgram) Variables() []string {
+	return p.variables
+}
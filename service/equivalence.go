@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/logging"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/tracing"
+)
+
+// Equivalent decides whether two boolean expressions give the same result for
+// every assignment of their variables, by searching for an assignment under
+// which exactly one of them is true.
+func (es *ExpressionService) Equivalent(ctx context.Context, left, right model.Expression) (model.Equivalence, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ExpressionService.Equivalent")
+	defer span.End()
+
+	logger := logging.FromContext(ctx)
+
+	compiledLeft, err := es.compileWithTree(ctx, left, FeatureEquivalence)
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.WithField("err", err.Error()).Error("error creating evaluable expression")
+		return model.Equivalence{}, err
+	}
+	compiledRight, err := es.compileWithTree(ctx, right, FeatureEquivalence)
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.WithField("err", err.Error()).Error("error creating evaluable expression")
+		return model.Equivalence{}, err
+	}
+
+	for _, node := range []parser.Node{compiledLeft.node, compiledRight.node} {
+		if _, err := booleanVariables(node); err != nil {
+			tracing.RecordError(span, err)
+			return model.Equivalence{}, err
+		}
+	}
+
+	difference := &parser.Binary{Operator: parser.OpXor, Left: compiledLeft.node, Right: compiledRight.node}
+	variables := parser.Variables(difference)
+	if len(variables) > MaxAnalysisVariables {
+		err := fmt.Errorf("%w: %d variables, at most %d allowed", ErrAnalysisTooLarge, len(variables), MaxAnalysisVariables)
+		tracing.RecordError(span, err)
+		return model.Equivalence{}, err
+	}
+
+	values, err := satisfy(ctx, difference, true, variables)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return model.Equivalence{}, err
+	}
+	if values == nil {
+		return model.Equivalence{Equivalent: true}, nil
+	}
+
+	parameters := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		parameters[name] = value
+	}
+	leftResult, err := compiledLeft.program.Evaluate(ctx, parameters)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return model.Equivalence{}, fmt.Errorf("%w: %s", ErrEvaluatingExpression, err)
+	}
+
+	return model.Equivalence{
+		Counterexample: &model.Counterexample{
+			Values: values,
+			Left:   leftResult == true,
+			Right:  leftResult != true,
+		},
+	}, nil
+}
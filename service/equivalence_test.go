@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"testing"
+)
+
+func TestExpression_Equivalent(t *testing.T) {
+	testCases := []struct {
+		name     string
+		left     string
+		right    string
+		expected model.Equivalence
+		err      error
+	}{
+		{
+			name:     "should prove De Morgan's law",
+			left:     "not (a and b)",
+			right:    "not a or not b",
+			expected: model.Equivalence{Equivalent: true},
+		},
+		{
+			name:     "should ignore redundant terms",
+			left:     "(a and b) or (a and not b)",
+			right:    "a",
+			expected: model.Equivalence{Equivalent: true},
+		},
+		{
+			name:  "should return a counterexample when they differ",
+			left:  "a implies b",
+			right: "b implies a",
+			expected: model.Equivalence{
+				Counterexample: &model.Counterexample{
+					Values: map[string]bool{"a": true, "b": false},
+					Left:   false,
+					Right:  true,
+				},
+			},
+		},
+		{
+			name:  "should compare expressions with different variables",
+			left:  "a or b",
+			right: "a",
+			expected: model.Equivalence{
+				Counterexample: &model.Counterexample{
+					Values: map[string]bool{"a": false, "b": true},
+					Left:   true,
+					Right:  false,
+				},
+			},
+		},
+		{
+			name:  "should reject variables used as numbers",
+			left:  "a",
+			right: "a > 1",
+			err:   ErrNotBooleanVariables,
+		},
+		{
+			name:  "should reject invalid definitions",
+			left:  "a",
+			right: "a or",
+			err:   ErrCreatingEvaluableExpression,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			es := ExpressionService{}
+			equivalence, err := es.Equivalent(context.Background(), model.Expression{Definition: tc.left}, model.Expression{Definition: tc.right})
+
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, tc.expected, equivalence)
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+)
+
+// explain evaluates node recording the value of every sub-expression. Logical
+// operators evaluate their operands left to right and stop as soon as the
+// result is known, like the evaluator does; the operands they skip are
+// reported as short-circuited. Any other sub-expression is evaluated on its
+// own by the engine that compiled the expression, reusing the programs compiled
+// for earlier requests, so the values come from the same engine as the result.
+func (c *compiledExpression) explain(ctx context.Context, node parser.Node, parameters map[string]interface{}) model.Explanation {
+	explanation := model.Explanation{Expression: node.String()}
+
+	switch n := node.(type) {
+	case *parser.Literal:
+		explanation.Value = n.Value
+	case *parser.Regex:
+		explanation.Value = n.String()
+	case *parser.Variable:
+		value, exists := parameters[n.Name]
+		if !exists {
+			explanation.Error = fmt.Sprintf("missing value for variable %s", n.Name)
+			break
+		}
+		explanation.Value = value
+	case *parser.Unary:
+		explanation.Operator = string(n.Operator)
+		operand := c.explain(ctx, n.Operand, parameters)
+		explanation.Operands = []model.Explanation{operand}
+		if n.Operator != parser.OpNot {
+			c.evaluateOperation(ctx, node, parameters, &explanation)
+			break
+		}
+		if value, ok := booleanOperand(operand, &explanation); ok {
+			explanation.Value = !value
+		}
+	case *parser.Binary:
+		explanation.Operator = string(n.Operator)
+		if !n.Operator.IsLogical() {
+			explanation.Operands = []model.Explanation{c.explain(ctx, n.Left, parameters), c.explain(ctx, n.Right, parameters)}
+			c.evaluateOperation(ctx, node, parameters, &explanation)
+			break
+		}
+		c.explainLogical(ctx, n, parameters, &explanation)
+	case *parser.Call:
+		explanation.Operator = n.Name
+		for _, arg := range n.Args {
+			explanation.Operands = append(explanation.Operands, c.explain(ctx, arg, parameters))
+		}
+		c.evaluateOperation(ctx, node, parameters, &explanation)
+	case *parser.List:
+		for _, element := range n.Elements {
+			explanation.Operands = append(explanation.Operands, c.explain(ctx, element, parameters))
+		}
+		c.evaluateOperation(ctx, node, parameters, &explanation)
+	}
+
+	return explanation
+}
+
+func (c *compiledExpression) explainLogical(ctx context.Context, node *parser.Binary, parameters map[string]interface{}, explanation *model.Explanation) {
+	left := c.explain(ctx, node.Left, parameters)
+	explanation.Operands = append(explanation.Operands, left)
+
+	leftValue, ok := booleanOperand(left, explanation)
+	if !ok {
+		explanation.Operands = append(explanation.Operands, shortCircuited(node.Right))
+		return
+	}
+
+	if result, decided := shortCircuit(node.Operator, leftValue); decided {
+		explanation.Value = result
+		explanation.Operands = append(explanation.Operands, shortCircuited(node.Right))
+		return
+	}
+
+	right := c.explain(ctx, node.Right, parameters)
+	explanation.Operands = append(explanation.Operands, right)
+
+	rightValue, ok := booleanOperand(right, explanation)
+	if !ok {
+		return
+	}
+
+	switch node.Operator {
+	case parser.OpAnd:
+		explanation.Value = leftValue && rightValue
+	case parser.OpOr:
+		explanation.Value = leftValue || rightValue
+	case parser.OpImplies:
+		explanation.Value = !leftValue || rightValue
+	case parser.OpXor:
+		explanation.Value = leftValue != rightValue
+	case parser.OpIff:
+		explanation.Value = leftValue == rightValue
+	}
+}
+
+// shortCircuit reports whether the left operand alone decides the result.
+func shortCircuit(operator parser.Operator, left bool) (bool, bool) {
+	switch {
+	case operator == parser.OpAnd && !left:
+		return false, true
+	case operator == parser.OpOr && left:
+		return true, true
+	case operator == parser.OpImplies && !left:
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+func shortCircuited(node parser.Node) model.Explanation {
+	explanation := model.Explanation{
+		Expression:     node.String(),
+		ShortCircuited: true,
+	}
+	switch n := node.(type) {
+	case *parser.Unary:
+		explanation.Operator = string(n.Operator)
+	case *parser.Binary:
+		explanation.Operator = string(n.Operator)
+	case *parser.Call:
+		explanation.Operator = n.Name
+	}
+	return explanation
+}
+
+// booleanOperand returns the operand value, flagging parent as failed when
+// the operand failed or is not a boolean.
+func booleanOperand(operand model.Explanation, parent *model.Explanation) (bool, bool) {
+	if operand.Error != "" {
+		parent.Error = fmt.Sprintf("operand %s could not be evaluated", operand.Expression)
+		return false, false
+	}
+
+	value, isBool := operand.Value.(bool)
+	if !isBool {
+		parent.Error = fmt.Sprintf("operand %s is not a boolean", operand.Expression)
+		return false, false
+	}
+
+	return value, true
+}
+
+func (c *compiledExpression) evaluateOperation(ctx context.Context, node parser.Node, parameters map[string]interface{}, explanation *model.Explanation) {
+	value, err := c.evaluateNode(ctx, node, parameters)
+	if err != nil {
+		explanation.Error = err.Error()
+		return
+	}
+
+	explanation.Value = value
+}
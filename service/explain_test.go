@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	testCases := []struct {
+		name       string
+		definition string
+		urlParams  string
+		expected   model.Explanation
+	}{
+		{
+			name:       "should short-circuit AND when the left side is false",
+			definition: "x and (y or z)",
+			urlParams:  "x=0,y=1,z=0",
+			expected: model.Explanation{
+				Expression: "x AND (y OR z)",
+				Operator:   "AND",
+				Value:      false,
+				Operands: []model.Explanation{
+					{Expression: "x", Value: false},
+					{Expression: "y OR z", Operator: "OR", ShortCircuited: true},
+				},
+			},
+		},
+		{
+			name:       "should evaluate every operand when none decides early",
+			definition: "not x or y",
+			urlParams:  "x=1,y=1",
+			expected: model.Explanation{
+				Expression: "NOT x OR y",
+				Operator:   "OR",
+				Value:      true,
+				Operands: []model.Explanation{
+					{
+						Expression: "NOT x",
+						Operator:   "NOT",
+						Value:      false,
+						Operands:   []model.Explanation{{Expression: "x", Value: true}},
+					},
+					{Expression: "y", Value: true},
+				},
+			},
+		},
+		{
+			name:       "should short-circuit IMPLIES when the premise is false",
+			definition: "x -> y",
+			urlParams:  "x=0",
+			expected: model.Explanation{
+				Expression: "x IMPLIES y",
+				Operator:   "IMPLIES",
+				Value:      true,
+				Operands: []model.Explanation{
+					{Expression: "x", Value: false},
+					{Expression: "y", ShortCircuited: true},
+				},
+			},
+		},
+		{
+			name:       "should report missing variables",
+			definition: "x xor y",
+			urlParams:  "x=1",
+			expected: model.Explanation{
+				Expression: "x XOR y",
+				Operator:   "XOR",
+				Error:      "operand y could not be evaluated",
+				Operands: []model.Explanation{
+					{Expression: "x", Value: true},
+					{Expression: "y", Error: "missing value for variable y"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, err := parser.Parse(tc.definition)
+			assert.NoError(t, err)
+
+			compiled := &compiledExpression{node: node, engine: NativeEngine{}}
+			values, err := parseParameters(tc.urlParams, parser.InferTypes(node), Limits{})
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.expected, compiled.explain(context.Background(), node, values))
+		})
+	}
+}
+
+func TestExplainReusesPrograms(t *testing.T) {
+	node, err := parser.Parse("x > 1 and y")
+	assert.NoError(t, err)
+	engine := &constantEngine{}
+	compiled := &compiledExpression{node: node, engine: engine}
+	values := map[string]interface{}{"x": 2.0, "y": true}
+
+	compiled.explain(context.Background(), node, values)
+	compiled.explain(context.Background(), node, values)
+
+	assert.Equal(t, []string{"x > 1"}, engine.compiled, "sub-expressions should be compiled once per expression")
+}
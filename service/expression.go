@@ -1,67 +1,536 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
-	"github.com/Knetic/govaluate"
+	"fmt"
 	log "github.com/sirupsen/logrus"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/logging"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/metrics"
 	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/tracing"
 	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
-	"regexp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrCreatingEvaluableExpression = errors.New(util.ErrCreatingEvaluableExpression)
+	ErrEvaluatingExpression        = errors.New(util.ErrEvaluatingExpression)
 )
 
 type ExpressionService struct {
-	Logger log.Logger
+	Cache *ExpressionCache
+	// Source resolves references to other expressions. Without it definitions
+	// cannot use references.
+	Source ExpressionSource
+	// Store writes expressions. Without it expressions cannot be created,
+	// updated or deleted through the service.
+	Store ExpressionStore
+	// MaxTruthTableVariables caps the variables of a truth table, which has
+	// 2^n rows. Zero means DefaultMaxTruthTableVariables.
+	MaxTruthTableVariables int
+	// Limits bound the size of definitions and the duration of evaluations.
+	Limits Limits
+	// Engines replace the built-in engines of the given dialects: NativeEngine
+	// for native and cel, GovaluateEngine for govaluate.
+	Engines map[model.Dialect]Engine
+	// functions holds the *functionRegistry of the functions added with
+	// RegisterFunction. A registry is never modified: registering replaces it.
+	functions atomic.Value
 }
 
-func (es *ExpressionService) ExecuteExpression(expression model.Expression, urlParams string) (model.Response, error) {
-	logger := es.Logger.WithField("expressionId", expression.ID)
-	searchRegexOr := regexp.MustCompile("(?i)" + "or")
-	searchRegexAnd := regexp.MustCompile("(?i)" + "and")
+// compiledExpression keeps the syntax tree next to the engine's compiled form
+// so features that walk the tree do not parse the definition again. node is
+// nil for dialects that do not translate into a syntax tree.
+type compiledExpression struct {
+	node    parser.Node
+	program Program
+	// engine compiled program, and compiles the sub-expressions of node.
+	engine Engine
+	// variables holds the names of the variables read by program, sorted.
+	variables []string
+	// dependencies holds the ids of every expression inlined into node,
+	// directly or through other references.
+	dependencies map[int]bool
+	// subprograms holds the programs of the sub-expressions of node that
+	// explanations and the unknown policy evaluate on their own, compiled on
+	// first use and kept with the cached expression.
+	subprograms sync.Map
+}
+
+func (c *compiledExpression) Evaluate(ctx context.Context, values map[string]interface{}) (interface{}, error) {
+	return c.program.Evaluate(ctx, values)
+}
 
-	expressionString := expression.Definition
-	expressionString = searchRegexOr.ReplaceAllString(expressionString, "||")
-	expressionString = searchRegexAnd.ReplaceAllString(expressionString, "&&")
+// evaluateNode evaluates a sub-expression of node on its own.
+func (c *compiledExpression) evaluateNode(ctx context.Context, node parser.Node, values map[string]interface{}) (interface{}, error) {
+	program, err := c.subprogram(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	return program.Evaluate(ctx, values)
+}
 
-	logger.WithFields(log.Fields{
-		"expression": expression.Definition,
-		"params":     urlParams,
+func (c *compiledExpression) subprogram(ctx context.Context, node parser.Node) (Program, error) {
+	if program, exists := c.subprograms.Load(node); exists {
+		return program.(Program), nil
+	}
+	program, err := c.engine.Compile(ctx, Source{Tree: node})
+	if err != nil {
+		return nil, err
+	}
+	stored, _ := c.subprograms.LoadOrStore(node, program)
+	return stored.(Program), nil
+}
+
+func (c *compiledExpression) Variables() []string {
+	return c.variables
+}
+
+// types returns the types inferred for the variables, empty when there is no
+// syntax tree.
+func (c *compiledExpression) types() map[string]parser.Type {
+	if c.node == nil {
+		return nil
+	}
+	return parser.InferTypes(c.node)
+}
+
+func (c *compiledExpression) dependsOn(expressionId int) bool {
+	return expressionId != 0 && c.dependencies[expressionId]
+}
+
+// EvaluationOptions tune a single evaluation.
+type EvaluationOptions struct {
+	// Explain attaches the value of every sub-expression to the response.
+	Explain bool
+	// MissingVariables overrides the policy stored with the expression.
+	MissingVariables model.MissingVariablePolicy
+}
+
+// ExecuteExpression evaluates the expression with values given as comma
+// separated name=value pairs, see parseParameters.
+func (es *ExpressionService) ExecuteExpression(ctx context.Context, expression model.Expression, urlParams string, options EvaluationOptions) (model.Response, error) {
+	return es.execute(ctx, expression, urlParams, func(compiled *compiledExpression) (map[string]interface{}, error) {
+		return parseParameters(urlParams, compiled.types(), es.Limits)
+	}, options)
+}
+
+// ExecuteExpressionWithValues evaluates the expression with values that are
+// already typed: booleans, float64 numbers, strings and []interface{} lists,
+// as decoded from JSON, within the value limits. The response echoes them as
+// JSON.
+func (es *ExpressionService) ExecuteExpressionWithValues(ctx context.Context, expression model.Expression, values map[string]interface{}, options EvaluationOptions) (model.Response, error) {
+	if err := es.Limits.checkValues(values); err != nil {
+		return model.Response{}, err
+	}
+
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return model.Response{}, fmt.Errorf("%w: %s", ErrEvaluatingExpression, err)
+	}
+
+	return es.execute(ctx, expression, string(encoded), func(*compiledExpression) (map[string]interface{}, error) {
+		parameters := make(map[string]interface{}, len(values))
+		for name, value := range values {
+			parameters[name] = value
+		}
+		return parameters, nil
+	}, options)
+}
+
+// execute compiles and evaluates the expression. input describes the values
+// for the response and logs, and parameters builds them once the expression
+// is compiled.
+func (es *ExpressionService) execute(ctx context.Context, expression model.Expression, input string, parameters func(*compiledExpression) (map[string]interface{}, error), options EvaluationOptions) (model.Response, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ExpressionService.ExecuteExpression")
+	defer span.End()
+	span.SetAttributes(attribute.Int("expression.id", expression.ID))
+
+	logger := logging.FromContext(ctx).WithFields(log.Fields{
+		logging.FieldExpressionId: expression.ID,
+		"expression":              expression.Definition,
+		"params":                  input,
 	})
+	expressionId := strconv.Itoa(expression.ID)
 
-	evaluateExpression, err := govaluate.NewEvaluableExpression(expressionString)
+	if err := ctx.Err(); err != nil {
+		logger.WithField("err", err.Error()).Warn("expression evaluation abandoned")
+		return model.Response{}, err
+	}
+
+	compiled, err := es.compile(ctx, expression)
 	if err != nil {
-		logger.WithField("err", err.Error())
-		logger.Error("error creating evaluable expression")
-		return model.Response{}, errors.New(util.ErrCreatingEvaluableExpression)
+		tracing.RecordError(span, err)
+		logger.WithField("err", err.Error()).Error("error creating evaluable expression")
+		metrics.EvaluationsTotal.WithLabelValues(expressionId, metrics.EvaluationResultError).Inc()
+		if errors.Is(err, ErrCreatingEvaluableExpression) {
+			return model.Response{}, ErrCreatingEvaluableExpression
+		}
+		return model.Response{}, err
 	}
 
-	params := strings.Split(urlParams, ",")
-	parameters := make(map[string]interface{}, len(params))
+	if options.Explain && compiled.node == nil {
+		err := &DialectError{Dialect: expression.Dialect, Feature: FeatureExplanations}
+		tracing.RecordError(span, err)
+		logger.WithField("err", err.Error()).Error("error explaining expression")
+		metrics.EvaluationsTotal.WithLabelValues(expressionId, metrics.EvaluationResultError).Inc()
+		return model.Response{}, err
+	}
 
-	for _, param := range params {
-		variable := strings.Split(param, "=")
-		if len(variable) > 1 {
-			boolValue, err := strconv.ParseBool(variable[1])
-			if err == nil {
-				parameters[variable[0]] = boolValue
+	values, err := parameters(compiled)
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.WithField("err", err.Error()).Error("evaluation values rejected")
+		return model.Response{}, err
+	}
+	policy := missingVariablePolicy(expression, options)
+	var pathErrors []*PathError
+	if compiled.node != nil {
+		pathErrors = resolvePaths(compiled.node, values)
+	}
+	missing := missingVariables(compiled.variables, values)
+
+	if len(pathErrors) > 0 && policy == model.MissingVariablesError {
+		err := pathErrors[0]
+		tracing.RecordError(span, err)
+		logger.WithField("err", err.Error()).Error("error resolving variable path")
+		metrics.EvaluationsTotal.WithLabelValues(expressionId, metrics.EvaluationResultError).Inc()
+		return model.Response{}, err
+	}
+
+	run := func(ctx context.Context) (interface{}, error) {
+		return compiled.program.Evaluate(ctx, values)
+	}
+	if len(missing) > 0 {
+		logger = logger.WithFields(log.Fields{"missing": missing, "policy": policy})
+		switch policy {
+		case model.MissingVariablesFalse:
+			for _, name := range missing {
+				values[name] = false
+			}
+		case model.MissingVariablesUnknown:
+			run = func(ctx context.Context) (interface{}, error) {
+				if compiled.node == nil {
+					return model.OutcomeUnknown, nil
+				}
+				outcome, err := compiled.kleene(ctx, compiled.node, values)
+				return outcome, err
 			}
 		}
 	}
 
-	result, err := evaluateExpression.Evaluate(parameters)
+	evaluateCtx, evaluateSpan := tracing.Tracer().Start(ctx, "ExpressionService.evaluate")
+	evaluateCtx, cancel := context.WithTimeout(evaluateCtx, es.Limits.evaluationTimeout())
+	result, err := run(evaluateCtx)
+	cancel()
+	evaluateSpan.End()
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		err = fmt.Errorf("%w: exceeded %s", ErrEvaluationTimeout, es.Limits.evaluationTimeout())
+		tracing.RecordError(span, err)
+		logger.WithField("err", err.Error()).Warn("expression evaluation timed out")
+		metrics.EvaluationsTotal.WithLabelValues(expressionId, metrics.EvaluationResultError).Inc()
+		return model.Response{}, err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		tracing.RecordError(span, err)
+		logger.WithField("err", err.Error()).Warn("expression evaluation abandoned")
+		metrics.EvaluationsTotal.WithLabelValues(expressionId, metrics.EvaluationResultError).Inc()
+		return model.Response{}, err
+	}
 	if err != nil {
-		logger.WithField("err", err.Error())
-		logger.Error("error evaluating expression")
-		return model.Response{}, errors.New(util.ErrEvaluatingExpression)
+		tracing.RecordError(span, err)
+		logger.WithField("err", err.Error()).Error("error evaluating expression")
+		metrics.EvaluationsTotal.WithLabelValues(expressionId, metrics.EvaluationResultError).Inc()
+		return model.Response{}, ErrEvaluatingExpression
 	}
 
+	outcome, isOutcome := toOutcome(result)
+	if !isOutcome {
+		logger.WithField("result", result).Error("expression did not evaluate to a boolean")
+		metrics.EvaluationsTotal.WithLabelValues(expressionId, metrics.EvaluationResultError).Inc()
+		return model.Response{}, ErrEvaluatingExpression
+	}
+
+	metrics.EvaluationsTotal.WithLabelValues(expressionId, string(outcome)).Inc()
+	span.SetAttributes(attribute.String("expression.result", string(outcome)))
+
 	response := model.Response{
 		Definition: expression.Definition,
-		Values:     urlParams,
-		Result:     result.(bool),
+		Values:     input,
+		Result:     outcome == model.OutcomeTrue,
+		Outcome:    outcome,
 	}
-	logger.WithField("result", result).Info("expression evaluated successfully")
+	if options.Explain {
+		explanation := compiled.explain(ctx, compiled.node, values)
+		response.Explanation = &explanation
+	}
+
+	logger.WithField("result", outcome).Info("expression evaluated successfully")
 
 	return response, nil
 }
+
+// Variables returns the variables referenced by the expression, sorted by
+// name, with the type inferred from how the definition uses them.
+func (es *ExpressionService) Variables(ctx context.Context, expression model.Expression) ([]model.Variable, error) {
+	compiled, err := es.compile(ctx, expression)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{
+			logging.FieldExpressionId: expression.ID,
+			"err":                     err.Error(),
+		}).Error("error creating evaluable expression")
+		return nil, err
+	}
+
+	types := compiled.types()
+	variables := make([]model.Variable, 0, len(compiled.variables))
+	for _, name := range compiled.variables {
+		t, known := types[name]
+		if !known {
+			t = parser.TypeAny
+		}
+		variables = append(variables, model.Variable{Name: name, Type: string(t)})
+	}
+
+	return variables, nil
+}
+
+// parseParameters reads comma separated name=value pairs, converting each
+// URL-unescaped value to the type inferred for its variable. Lists are written
+// [a,b,c]. A variable of unknown type is read as a list when bracketed, then
+// as a boolean, then as a number, and otherwise kept as a string. Values that
+// do not fit the type of their variable are ignored, and booleans are read with
+// strconv.ParseBool. It fails with ErrValuesTooLarge past the value limits.
+func parseParameters(urlParams string, types map[string]parser.Type, limits Limits) (map[string]interface{}, error) {
+	params := splitParameters(urlParams)
+	parameters := make(map[string]interface{}, len(params))
+
+	for _, param := range params {
+		name, raw, found := strings.Cut(param, "=")
+		if !found {
+			continue
+		}
+		if converted, ok := convertParameter(raw, types[name]); ok {
+			parameters[name] = converted
+		}
+	}
+
+	if err := limits.checkValues(parameters); err != nil {
+		return nil, err
+	}
+	return parameters, nil
+}
+
+func convertParameter(raw string, t parser.Type) (interface{}, bool) {
+	if t == "" {
+		t = parser.TypeAny
+	}
+	if t == parser.TypeList || t == parser.TypeAny && isListStart(raw) {
+		return parseList(raw)
+	}
+
+	value, err := url.QueryUnescape(raw)
+	if err != nil {
+		return nil, false
+	}
+	if t == parser.TypeBoolean || t == parser.TypeAny {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue, true
+		}
+	}
+	if t == parser.TypeNumber || t == parser.TypeAny {
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			return number, true
+		}
+	}
+	if t == parser.TypeString || t == parser.TypeAny {
+		return value, true
+	}
+	return nil, false
+}
+
+// missingVariablePolicy prefers the policy requested for this evaluation over
+// the one stored with the expression, defaulting to failing the evaluation.
+func missingVariablePolicy(expression model.Expression, options EvaluationOptions) model.MissingVariablePolicy {
+	if options.MissingVariables != "" {
+		return options.MissingVariables
+	}
+	if expression.MissingVariables != "" {
+		return expression.MissingVariables
+	}
+	return model.MissingVariablesError
+}
+
+func missingVariables(names []string, parameters map[string]interface{}) []string {
+	var missing []string
+	for _, name := range names {
+		if _, exists := parameters[name]; !exists {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+func toOutcome(result interface{}) (model.Outcome, bool) {
+	switch value := result.(type) {
+	case bool:
+		if value {
+			return model.OutcomeTrue, true
+		}
+		return model.OutcomeFalse, true
+	case model.Outcome:
+		return value, true
+	default:
+		return "", false
+	}
+}
+
+// compile hands the definition to the engine of its dialect, reusing a
+// previously compiled expression when a cache is configured. It fails when the
+// definition refers back to the expression.
+func (es *ExpressionService) compile(ctx context.Context, expression model.Expression) (*compiledExpression, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ExpressionService.compile")
+	defer span.End()
+
+	compiled, err := es.compileDefinition(ctx, expression.Dialect, expression.Definition)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+
+	if compiled.dependsOn(expression.ID) {
+		err := fmt.Errorf("%w: expression %d refers to itself", ErrReferenceCycle, expression.ID)
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	return compiled, nil
+}
+
+// compileWithTree compiles an expression for the features that walk its
+// syntax tree, failing with a DialectError naming feature for dialects that
+// have none.
+func (es *ExpressionService) compileWithTree(ctx context.Context, expression model.Expression, feature string) (*compiledExpression, error) {
+	compiled, err := es.compile(ctx, expression)
+	if err != nil {
+		return nil, err
+	}
+	if compiled.node == nil {
+		return nil, &DialectError{Dialect: expression.Dialect, Feature: feature}
+	}
+	return compiled, nil
+}
+
+func (es *ExpressionService) compileDefinition(ctx context.Context, dialect model.Dialect, definition string) (*compiledExpression, error) {
+	span := trace.SpanFromContext(ctx)
+	if dialect != "" {
+		span.SetAttributes(attribute.String("expression.dialect", string(dialect)))
+	}
+
+	if err := es.Limits.checkDefinition(definition); err != nil {
+		return nil, err
+	}
+
+	key := cacheKey(es.registry().id, dialect, definition)
+	var generation uint64
+	if es.Cache != nil {
+		if compiled, exists := es.Cache.Get(key); exists {
+			span.SetAttributes(attribute.Bool("cache.hit", true))
+			return compiled, nil
+		}
+		generation = es.Cache.Generation()
+	}
+
+	engine, err := es.engine(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var compiled *compiledExpression
+	if parse, translates := translator(dialect); translates {
+		node, err := parse(definition)
+		if err != nil {
+			metrics.ParseFailuresTotal.Inc()
+			return nil, fmt.Errorf("%w: %s", ErrCreatingEvaluableExpression, err)
+		}
+		compiled, err = es.compileTree(ctx, engine, definition, node)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		program, err := engine.Compile(ctx, Source{Definition: definition})
+		if err != nil {
+			return nil, engineError(err)
+		}
+		variables := program.Variables()
+		if err = es.Limits.checkVariables(len(variables)); err != nil {
+			return nil, err
+		}
+		compiled = &compiledExpression{program: program, engine: engine, variables: variables}
+	}
+
+	// References are read while compiling: an invalidation since then may
+	// have been for one of them, and the compilation is only used this time.
+	if es.Cache != nil {
+		es.Cache.AddIfCurrent(key, compiled, generation)
+	}
+
+	return compiled, nil
+}
+
+// compileTree resolves the references of a syntax tree, checks it against the
+// limits, binds its calls and hands it to the engine.
+func (es *ExpressionService) compileTree(ctx context.Context, engine Engine, definition string, node parser.Node) (*compiledExpression, error) {
+	dependencies := make(map[int]bool)
+	node, err := es.resolve(ctx, node, dependencies)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = es.Limits.checkTree(node); err != nil {
+		return nil, err
+	}
+
+	if err = es.bind(node); err != nil {
+		return nil, err
+	}
+
+	program, err := engine.Compile(ctx, Source{Definition: definition, Tree: node})
+	if err != nil {
+		metrics.ParseFailuresTotal.Inc()
+		return nil, engineError(err)
+	}
+
+	return &compiledExpression{node: node, program: program, engine: engine, variables: parser.Variables(node), dependencies: dependencies}, nil
+}
+
+// engineError reports the errors of an engine as ErrCreatingEvaluableExpression
+// unless they already name the dialect as unsupported.
+func engineError(err error) error {
+	if errors.Is(err, ErrCreatingEvaluableExpression) || errors.Is(err, ErrUnsupportedDialect) {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrCreatingEvaluableExpression, err)
+}
+
+// cacheKey keeps native definitions of services without registered functions
+// under their own text, so the same text in another dialect, or compiled
+// against other functions, is cached apart.
+func cacheKey(registry uint64, dialect model.Dialect, definition string) string {
+	key := definition
+	if dialect != "" && dialect != model.DialectNative {
+		key = string(dialect) + ":" + key
+	}
+	if registry != 0 {
+		key = "functions " + strconv.FormatUint(registry, 10) + ":" + key
+	}
+	return key
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
@@ -49,6 +50,7 @@ func TestExpression_ExecuteExpression(t *testing.T) {
 				Definition: "x OR y",
 				Values:     "x=1,y=0",
 				Result:     true,
+				Outcome:    model.OutcomeTrue,
 			},
 			expectedError: nil,
 			urlParams:     "x=1,y=0",
@@ -64,6 +66,7 @@ func TestExpression_ExecuteExpression(t *testing.T) {
 				Definition: "x or y",
 				Values:     "x=1,y=0",
 				Result:     true,
+				Outcome:    model.OutcomeTrue,
 			},
 			expectedError: nil,
 			urlParams:     "x=1,y=0",
@@ -75,7 +78,8 @@ func TestExpression_ExecuteExpression(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			service := ExpressionService{}
 
-			result, err := service.ExecuteExpression(tc.expression, tc.urlParams)
+			result, err := service.ExecuteExpression(context.Background(), tc.expression, tc.urlParams, EvaluationOptions{})
+			assert.Equal(t, tc.expectedError == nil, err == nil, "error presence should match")
 			assert.Equal(t, tc.expectedResult, result, "values should be the same")
 
 			if err != nil {
@@ -84,3 +88,92 @@ func TestExpression_ExecuteExpression(t *testing.T) {
 		})
 	}
 }
+
+func TestExpression_ExecuteExpressionConnectives(t *testing.T) {
+	testCases := []struct {
+		definition string
+		urlParams  string
+		expected   bool
+	}{
+		{definition: "not x", urlParams: "x=1", expected: false},
+		{definition: "!x or y", urlParams: "x=0,y=0", expected: true},
+		{definition: "x xor y", urlParams: "x=1,y=1", expected: false},
+		{definition: "x ^ y", urlParams: "x=1,y=0", expected: true},
+		{definition: "x implies y", urlParams: "x=1,y=0", expected: false},
+		{definition: "x -> y", urlParams: "x=0,y=0", expected: true},
+		{definition: "x iff y", urlParams: "x=0,y=0", expected: true},
+		{definition: "x <-> y", urlParams: "x=1,y=0", expected: false},
+		{definition: "x or y and z", urlParams: "x=1,y=0,z=0", expected: true},
+		{definition: "x -> y -> z", urlParams: "x=1,y=1,z=0", expected: false},
+		{definition: "NOT x AND y", urlParams: "x=0,y=1", expected: true},
+		{definition: "color and brand", urlParams: "color=1,brand=1", expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.definition+" with "+tc.urlParams, func(t *testing.T) {
+			service := ExpressionService{}
+			expression := model.Expression{
+				ID:         1,
+				Definition: tc.definition,
+			}
+
+			result, err := service.ExecuteExpression(context.Background(), expression, tc.urlParams, EvaluationOptions{})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result.Result)
+		})
+	}
+}
+
+func TestExpression_ExecuteExpressionCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	service := ExpressionService{}
+	expression := model.Expression{
+		ID:         1,
+		Definition: "x or y",
+	}
+
+	result, err := service.ExecuteExpression(ctx, expression, "x=1,y=0", EvaluationOptions{})
+	assert.Equal(t, model.Response{}, result)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+type constantEngine struct {
+	compiled []string
+}
+
+func (e *constantEngine) Compile(ctx context.Context, source Source) (Program, error) {
+	e.compiled = append(e.compiled, source.Tree.String())
+	return constantProgram{}, nil
+}
+
+type constantProgram struct{}
+
+func (constantProgram) Evaluate(context.Context, map[string]interface{}) (interface{}, error) {
+	return true, nil
+}
+
+func (constantProgram) Variables() []string {
+	return nil
+}
+
+func TestExpression_ExecuteExpressionEngine(t *testing.T) {
+	engine := &constantEngine{}
+	service := ExpressionService{Engines: map[model.Dialect]Engine{model.DialectNative: engine}}
+
+	result, err := service.ExecuteExpression(context.Background(), model.Expression{ID: 1, Definition: "x and not x"}, "x=1", EvaluationOptions{})
+	assert.NoError(t, err)
+	assert.True(t, result.Result, "the result should come from the configured engine")
+	assert.Equal(t, []string{"x AND NOT x"}, engine.compiled)
+}
+
+func TestExpression_ExplainEngine(t *testing.T) {
+	engine := &constantEngine{}
+	service := ExpressionService{Engines: map[model.Dialect]Engine{model.DialectNative: engine}}
+
+	result, err := service.ExecuteExpression(context.Background(), model.Expression{ID: 1, Definition: "x > 1 and y"}, "x=0,y=1", EvaluationOptions{Explain: true})
+	assert.NoError(t, err)
+	assert.Equal(t, true, result.Explanation.Operands[0].Value, "sub-expressions should be evaluated by the configured engine")
+	assert.Equal(t, []string{"x > 1 AND y", "x > 1"}, engine.compiled)
+}
@@ -0,0 +1,370 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/evaluator"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrUnknownFunction  = errors.New(util.ErrUnknownFunction)
+	ErrInvalidArguments = errors.New(util.ErrInvalidArguments)
+	ErrInvalidFunction  = errors.New(util.ErrInvalidFunction)
+)
+
+// Function is a function definitions can call by name. Call receives
+// arguments of the declared Parameters types and must return a value of the
+// Returns type: bool for boolean, float64 for number, string for string and
+// []interface{} for list.
+type Function = parser.Function
+
+// clock is replaced in tests to pin the result of date functions.
+var clock = time.Now
+
+// builtins are the functions every ExpressionService knows.
+var builtins = []*Function{
+	{
+		Name:        "contains",
+		Description: "reports whether the first string contains the second",
+		Parameters:  []parser.Type{parser.TypeString, parser.TypeString},
+		Returns:     parser.TypeBoolean,
+		Call: func(args ...interface{}) (interface{}, error) {
+			return strings.Contains(args[0].(string), args[1].(string)), nil
+		},
+	},
+	{
+		Name:        "startsWith",
+		Description: "reports whether the first string begins with the second",
+		Parameters:  []parser.Type{parser.TypeString, parser.TypeString},
+		Returns:     parser.TypeBoolean,
+		Call: func(args ...interface{}) (interface{}, error) {
+			return strings.HasPrefix(args[0].(string), args[1].(string)), nil
+		},
+	},
+	{
+		Name:        "lower",
+		Description: "returns the string in lower case",
+		Parameters:  []parser.Type{parser.TypeString},
+		Returns:     parser.TypeString,
+		Call: func(args ...interface{}) (interface{}, error) {
+			return strings.ToLower(args[0].(string)), nil
+		},
+	},
+	{
+		Name:        "len",
+		Description: "returns the number of characters in the string",
+		Parameters:  []parser.Type{parser.TypeString},
+		Returns:     parser.TypeNumber,
+		Call: func(args ...interface{}) (interface{}, error) {
+			return float64(utf8.RuneCountInString(args[0].(string))), nil
+		},
+	},
+	{
+		Name:        "matches",
+		Description: "reports whether the string contains a match of the regular expression, in RE2 syntax",
+		Parameters:  []parser.Type{parser.TypeString, parser.TypeString},
+		Returns:     parser.TypeBoolean,
+		Call: func(args ...interface{}) (interface{}, error) {
+			pattern, err := evaluator.Pattern(args[1].(string))
+			if err != nil {
+				return nil, err
+			}
+			return pattern.MatchString(args[0].(string)), nil
+		},
+	},
+	{
+		Name:        "abs",
+		Description: "returns the absolute value of the number",
+		Parameters:  []parser.Type{parser.TypeNumber},
+		Returns:     parser.TypeNumber,
+		Call: func(args ...interface{}) (interface{}, error) {
+			return math.Abs(args[0].(float64)), nil
+		},
+	},
+	{
+		Name:        "min",
+		Description: "returns the smallest of one or more numbers",
+		Parameters:  []parser.Type{parser.TypeNumber},
+		Variadic:    true,
+		Returns:     parser.TypeNumber,
+		Call: func(args ...interface{}) (interface{}, error) {
+			result := args[0].(float64)
+			for _, arg := range args[1:] {
+				result = math.Min(result, arg.(float64))
+			}
+			return result, nil
+		},
+	},
+	{
+		Name:        "max",
+		Description: "returns the largest of one or more numbers",
+		Parameters:  []parser.Type{parser.TypeNumber},
+		Variadic:    true,
+		Returns:     parser.TypeNumber,
+		Call: func(args ...interface{}) (interface{}, error) {
+			result := args[0].(float64)
+			for _, arg := range args[1:] {
+				result = math.Max(result, arg.(float64))
+			}
+			return result, nil
+		},
+	},
+	{
+		Name:        "in",
+		Description: "reports whether the first value equals any of the others",
+		Parameters:  []parser.Type{parser.TypeAny, parser.TypeAny},
+		Variadic:    true,
+		Returns:     parser.TypeBoolean,
+		Call: func(args ...interface{}) (interface{}, error) {
+			for _, candidate := range args[1:] {
+				if evaluator.Equal(candidate, args[0]) {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+	},
+	{
+		Name:        "now",
+		Description: "returns the current time as an RFC 3339 string",
+		Returns:     parser.TypeString,
+		Call: func(args ...interface{}) (interface{}, error) {
+			return clock().UTC().Format(time.RFC3339), nil
+		},
+	},
+	{
+		Name:        "before",
+		Description: "reports whether the first date is earlier than the second; dates are RFC 3339 timestamps or YYYY-MM-DD",
+		Parameters:  []parser.Type{parser.TypeString, parser.TypeString},
+		Returns:     parser.TypeBoolean,
+		Call: func(args ...interface{}) (interface{}, error) {
+			first, err := parseDate(args[0].(string))
+			if err != nil {
+				return nil, err
+			}
+			second, err := parseDate(args[1].(string))
+			if err != nil {
+				return nil, err
+			}
+			return first.Before(second), nil
+		},
+	},
+	{
+		Name:        "daysSince",
+		Description: "returns the number of whole days elapsed since the date; dates are RFC 3339 timestamps or YYYY-MM-DD",
+		Parameters:  []parser.Type{parser.TypeString},
+		Returns:     parser.TypeNumber,
+		Call: func(args ...interface{}) (interface{}, error) {
+			date, err := parseDate(args[0].(string))
+			if err != nil {
+				return nil, err
+			}
+			return math.Floor(clock().Sub(date).Hours() / 24), nil
+		},
+	},
+}
+
+var builtinsByName = indexFunctions(builtins)
+
+func indexFunctions(functions []*Function) map[string]*Function {
+	index := make(map[string]*Function, len(functions))
+	for _, function := range functions {
+		index[function.Name] = function
+	}
+	return index
+}
+
+// RegisterFunction makes a custom function available to the definitions this
+// service compiles, next to the built-in ones. Calls are checked against its
+// declared types when a definition is created or updated, and arguments and
+// results are checked again on every call. Registering is safe alongside
+// evaluations: definitions compiled before it keep the functions they were
+// bound to, and are compiled again rather than read from the cache.
+func (es *ExpressionService) RegisterFunction(function Function) error {
+	if !parser.IsIdentifier(function.Name) {
+		return fmt.Errorf("%w: %q is not a valid function name", ErrInvalidFunction, function.Name)
+	}
+	if function.Call == nil {
+		return fmt.Errorf("%w: %s has no implementation", ErrInvalidFunction, function.Name)
+	}
+	if function.Variadic && len(function.Parameters) == 0 {
+		return fmt.Errorf("%w: variadic %s needs at least one parameter", ErrInvalidFunction, function.Name)
+	}
+	for _, parameter := range function.Parameters {
+		if !isValueType(parameter) {
+			return fmt.Errorf("%w: %s has a parameter of unknown type %q", ErrInvalidFunction, function.Name, parameter)
+		}
+	}
+	if !isValueType(function.Returns) {
+		return fmt.Errorf("%w: %s returns unknown type %q", ErrInvalidFunction, function.Name, function.Returns)
+	}
+
+	if _, exists := builtinsByName[function.Name]; exists {
+		return fmt.Errorf("%w: %s is already defined", ErrInvalidFunction, function.Name)
+	}
+
+	for {
+		stored := es.functions.Load()
+		current, _ := stored.(*functionRegistry)
+		if current == nil {
+			current = &functionRegistry{}
+		}
+		if _, exists := current.functions[function.Name]; exists {
+			return fmt.Errorf("%w: %s is already defined", ErrInvalidFunction, function.Name)
+		}
+		functions := make(map[string]*Function, len(current.functions)+1)
+		for name, registered := range current.functions {
+			functions[name] = registered
+		}
+		functions[function.Name] = &function
+
+		next := &functionRegistry{functions: functions, id: atomic.AddUint64(&registries, 1)}
+		if es.functions.CompareAndSwap(stored, next) {
+			return nil
+		}
+	}
+}
+
+// functionRegistry is the set of functions registered with a service at some
+// point. id identifies it in cache keys and is zero only for the empty
+// registry of a service nothing was registered with.
+type functionRegistry struct {
+	functions map[string]*Function
+	id        uint64
+}
+
+// registries numbers every registry, so an id is never shared by two services
+// or by two states of the same service.
+var registries uint64
+
+func (es *ExpressionService) registry() *functionRegistry {
+	if registry, _ := es.functions.Load().(*functionRegistry); registry != nil {
+		return registry
+	}
+	return &functionRegistry{}
+}
+
+func isValueType(t parser.Type) bool {
+	switch t {
+	case parser.TypeBoolean, parser.TypeNumber, parser.TypeString, parser.TypeList, parser.TypeAny:
+		return true
+	default:
+		return false
+	}
+}
+
+func (es *ExpressionService) function(name string) (*Function, bool) {
+	if function, exists := builtinsByName[name]; exists {
+		return function, true
+	}
+	function, exists := es.registry().functions[name]
+	return function, exists
+}
+
+// Functions lists the functions definitions can call, built-in and
+// registered, sorted by name.
+func (es *ExpressionService) Functions() []model.Function {
+	registered := es.registry().functions
+	functions := make([]model.Function, 0, len(builtinsByName)+len(registered))
+	for _, function := range builtins {
+		functions = append(functions, describe(function))
+	}
+	for _, function := range registered {
+		functions = append(functions, describe(function))
+	}
+
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].Name < functions[j].Name
+	})
+	return functions
+}
+
+func describe(function *Function) model.Function {
+	parameters := make([]string, len(function.Parameters))
+	for i, parameter := range function.Parameters {
+		parameters[i] = string(parameter)
+	}
+	return model.Function{
+		Name:        function.Name,
+		Description: function.Description,
+		Parameters:  parameters,
+		Variadic:    function.Variadic,
+		Returns:     string(function.Returns),
+	}
+}
+
+// bind attaches the implementation to every call in node, checking the number
+// of arguments and the type of those known without values. Arguments are
+// bound first so nested calls have a type. Arguments whose type depends on
+// variables are checked when the function is called.
+func (es *ExpressionService) bind(node parser.Node) error {
+	switch n := node.(type) {
+	case *parser.Unary:
+		return es.bind(n.Operand)
+	case *parser.Binary:
+		if err := es.bind(n.Left); err != nil {
+			return err
+		}
+		return es.bind(n.Right)
+	case *parser.List:
+		for _, element := range n.Elements {
+			if err := es.bind(element); err != nil {
+				return err
+			}
+		}
+	case *parser.Call:
+		for _, arg := range n.Args {
+			if err := es.bind(arg); err != nil {
+				return err
+			}
+		}
+
+		function, exists := es.function(n.Name)
+		if !exists {
+			return fmt.Errorf("%w: %s", ErrUnknownFunction, n.Name)
+		}
+		if err := checkArguments(function, n.Args); err != nil {
+			return err
+		}
+		n.Function = function
+	}
+	return nil
+}
+
+func checkArguments(function *Function, args []parser.Node) error {
+	count := len(function.Parameters)
+	switch {
+	case function.Variadic && len(args) < count:
+		return fmt.Errorf("%w: %s expects at least %d arguments, got %d", ErrInvalidArguments, function.Name, count, len(args))
+	case !function.Variadic && len(args) != count:
+		return fmt.Errorf("%w: %s expects %d arguments, got %d", ErrInvalidArguments, function.Name, count, len(args))
+	}
+
+	for i, arg := range args {
+		expected, actual := function.ParameterType(i), parser.StaticType(arg)
+		if expected != parser.TypeAny && actual != parser.TypeAny && expected != actual {
+			return fmt.Errorf("%w: argument %d of %s must be a %s, got %s", ErrInvalidArguments, i+1, function.Name, expected, actual)
+		}
+	}
+	return nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected RFC 3339 or YYYY-MM-DD", value)
+	}
+	return date, nil
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExpression_Functions(t *testing.T) {
+	clock = func() time.Time { return time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC) }
+	defer func() { clock = time.Now }()
+
+	testCases := []struct {
+		name       string
+		definition string
+		urlParams  string
+		expected   bool
+		err        error
+	}{
+		{
+			name:       "should call string functions",
+			definition: `contains(lower(name), "ali") and startsWith(name, "A") and len(name) == 5`,
+			urlParams:  "name=Alice",
+			expected:   true,
+		},
+		{
+			name:       "should unescape string values",
+			definition: `name == "Ana Maria"`,
+			urlParams:  "name=Ana%20Maria",
+			expected:   true,
+		},
+		{
+			name:       "should match regular expressions",
+			definition: `matches(email, "^[a-z]+@example\\.com$")`,
+			urlParams:  "email=bob@example.com",
+			expected:   true,
+		},
+		{
+			name:       "should call numeric functions",
+			definition: "abs(delta) < 3 and min(a, b, 10) == 2 and max(a, b) == 7",
+			urlParams:  "delta=-2,a=2,b=7",
+			expected:   true,
+		},
+		{
+			name:       "should check membership",
+			definition: `in(country, "BR", "PT") and not in(code, 1, 2)`,
+			urlParams:  "country=PT,code=3",
+			expected:   true,
+		},
+		{
+			name:       "should compare dates",
+			definition: `before(signup, now()) and daysSince(signup) == 14 and before("2024-01-01", "2024-01-02T00:00:00Z")`,
+			urlParams:  "signup=2024-03-01",
+			expected:   true,
+		},
+		{
+			name:       "should reject unknown functions",
+			definition: "shout(name)",
+			err:        ErrUnknownFunction,
+		},
+		{
+			name:       "should reject the wrong number of arguments",
+			definition: `contains("a")`,
+			err:        ErrInvalidArguments,
+		},
+		{
+			name:       "should reject arguments of the wrong type",
+			definition: `contains(lower("A"), 1)`,
+			err:        ErrInvalidArguments,
+		},
+		{
+			name:       "should fail on values of the wrong type at evaluation",
+			definition: `contains(x, "a") or abs(x) > 0`,
+			urlParams:  "x=b",
+			err:        ErrEvaluatingExpression,
+		},
+		{
+			name:       "should fail on invalid dates",
+			definition: "before(start, end)",
+			urlParams:  "start=yesterday,end=2024-01-01",
+			err:        ErrEvaluatingExpression,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			es := ExpressionService{}
+			response, err := es.ExecuteExpression(context.Background(), model.Expression{ID: 1, Definition: tc.definition}, tc.urlParams, EvaluationOptions{})
+
+			assert.ErrorIs(t, err, tc.err)
+			if tc.err == nil {
+				assert.Equal(t, tc.expected, response.Result)
+			}
+		})
+	}
+}
+
+func TestExpression_Matches(t *testing.T) {
+	testCases := []struct {
+		name       string
+		definition string
+		urlParams  string
+		expected   bool
+		err        error
+	}{
+		{
+			name:       "should match regular expression literals",
+			definition: `email =~ /^[a-z]+@example\.com$/`,
+			urlParams:  "email=bob@example.com",
+			expected:   true,
+		},
+		{
+			name:       "should apply flags",
+			definition: `name MATCHES /^ali/i and not name MATCHES /^ali/`,
+			urlParams:  "name=Alice",
+			expected:   true,
+		},
+		{
+			name:       "should match string patterns",
+			definition: `path matches "^/api/v[0-9]+/"`,
+			urlParams:  "path=/api/v2/users",
+			expected:   true,
+		},
+		{
+			name:       "should match patterns from variables",
+			definition: "code =~ pattern",
+			urlParams:  "code=AB-12,pattern=^[A-Z]{2}-",
+			expected:   true,
+		},
+		{
+			name:       "should reject invalid patterns",
+			definition: "name =~ /a(b/",
+			err:        ErrCreatingEvaluableExpression,
+		},
+		{
+			name:       "should fail on invalid patterns from variables",
+			definition: "code =~ pattern",
+			urlParams:  "code=a,pattern=a(b",
+			err:        ErrEvaluatingExpression,
+		},
+		{
+			name:       "should fail on values that are not strings",
+			definition: "[1] =~ /1/",
+			err:        ErrEvaluatingExpression,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			es := ExpressionService{}
+			response, err := es.ExecuteExpression(context.Background(), model.Expression{ID: 1, Definition: tc.definition}, tc.urlParams, EvaluationOptions{})
+
+			assert.ErrorIs(t, err, tc.err)
+			if tc.err == nil {
+				assert.Equal(t, tc.expected, response.Result)
+			}
+		})
+	}
+}
+
+func TestExpression_FunctionsList(t *testing.T) {
+	es := ExpressionService{}
+	functions := es.Functions()
+
+	assert.Len(t, functions, len(builtins))
+	assert.Equal(t, "abs", functions[0].Name)
+	assert.Contains(t, functions, model.Function{
+		Name:        "max",
+		Description: "returns the largest of one or more numbers",
+		Parameters:  []string{"number"},
+		Variadic:    true,
+		Returns:     "number",
+	})
+}
+
+func TestExpression_RegisterFunction(t *testing.T) {
+	es := ExpressionService{}
+	err := es.RegisterFunction(Function{
+		Name:        "isBusinessDay",
+		Description: "reports whether the date falls on a weekday",
+		Parameters:  []parser.Type{parser.TypeString},
+		Returns:     parser.TypeBoolean,
+		Call: func(args ...interface{}) (interface{}, error) {
+			date, err := time.Parse("2006-01-02", args[0].(string))
+			if err != nil {
+				return nil, err
+			}
+			return date.Weekday() != time.Saturday && date.Weekday() != time.Sunday, nil
+		},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, es.RegisterFunction(Function{
+		Name:    "broken",
+		Returns: parser.TypeNumber,
+		Call: func(args ...interface{}) (interface{}, error) {
+			return "not a number", nil
+		},
+	}))
+
+	testCases := []struct {
+		name       string
+		definition string
+		urlParams  string
+		expected   bool
+		err        error
+	}{
+		{
+			name:       "should call registered functions",
+			definition: "isBusinessDay(day) and not isBusinessDay('2024-03-16')",
+			urlParams:  "day=2024-03-15",
+			expected:   true,
+		},
+		{
+			name:       "should check arguments of registered functions",
+			definition: "isBusinessDay(1)",
+			err:        ErrInvalidArguments,
+		},
+		{
+			name:       "should fail when a function returns the wrong type",
+			definition: "broken() > 1",
+			err:        ErrEvaluatingExpression,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			response, err := es.ExecuteExpression(context.Background(), model.Expression{ID: 1, Definition: tc.definition}, tc.urlParams, EvaluationOptions{})
+
+			assert.ErrorIs(t, err, tc.err)
+			if tc.err == nil {
+				assert.Equal(t, tc.expected, response.Result)
+			}
+		})
+	}
+
+	assert.Contains(t, es.Functions(), model.Function{
+		Name:        "isBusinessDay",
+		Description: "reports whether the date falls on a weekday",
+		Parameters:  []string{"string"},
+		Returns:     "boolean",
+	})
+
+	other := ExpressionService{}
+	_, err = other.ExecuteExpression(context.Background(), model.Expression{ID: 1, Definition: "isBusinessDay(day)"}, "day=2024-03-15", EvaluationOptions{})
+	assert.ErrorIs(t, err, ErrUnknownFunction, "functions are registered per service")
+}
+
+func TestExpression_RegisterFunctionErrors(t *testing.T) {
+	call := func(args ...interface{}) (interface{}, error) { return true, nil }
+
+	testCases := []struct {
+		name     string
+		function Function
+	}{
+		{
+			name:     "should reject invalid names",
+			function: Function{Name: "is-valid", Returns: parser.TypeBoolean, Call: call},
+		},
+		{
+			name:     "should reject keywords",
+			function: Function{Name: "xor", Returns: parser.TypeBoolean, Call: call},
+		},
+		{
+			name:     "should reject contextual keywords",
+			function: Function{Name: "any", Returns: parser.TypeBoolean, Call: call},
+		},
+		{
+			name:     "should reject names already in use",
+			function: Function{Name: "lower", Returns: parser.TypeBoolean, Call: call},
+		},
+		{
+			name:     "should reject functions without implementation",
+			function: Function{Name: "noop", Returns: parser.TypeBoolean},
+		},
+		{
+			name:     "should reject variadic functions without parameters",
+			function: Function{Name: "every", Variadic: true, Returns: parser.TypeBoolean, Call: call},
+		},
+		{
+			name:     "should reject unknown types",
+			function: Function{Name: "when", Parameters: []parser.Type{"date"}, Returns: parser.TypeBoolean, Call: call},
+		},
+		{
+			name:     "should reject missing return types",
+			function: Function{Name: "nothing", Call: call},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			es := ExpressionService{}
+			assert.ErrorIs(t, es.RegisterFunction(tc.function), ErrInvalidFunction)
+			assert.Len(t, es.Functions(), len(builtins))
+		})
+	}
+}
+
+func TestExpression_RegisterFunctionCache(t *testing.T) {
+	constant := func(value bool) Function {
+		return Function{
+			Name:    "flag",
+			Returns: parser.TypeBoolean,
+			Call: func(args ...interface{}) (interface{}, error) {
+				return value, nil
+			},
+		}
+	}
+	cache := NewExpressionCache(10)
+	expression := model.Expression{ID: 1, Definition: "flag()"}
+
+	enabled := ExpressionService{Cache: cache}
+	disabled := ExpressionService{Cache: cache}
+	assert.NoError(t, enabled.RegisterFunction(constant(true)))
+	assert.NoError(t, disabled.RegisterFunction(constant(false)))
+
+	response, err := enabled.ExecuteExpression(context.Background(), expression, "", EvaluationOptions{})
+	assert.NoError(t, err)
+	assert.True(t, response.Result)
+	response, err = disabled.ExecuteExpression(context.Background(), expression, "", EvaluationOptions{})
+	assert.NoError(t, err)
+	assert.False(t, response.Result, "services sharing a cache keep their own functions")
+
+}
+
+func TestExpression_RegisterFunctionConcurrently(t *testing.T) {
+	es := ExpressionService{Cache: NewExpressionCache(10)}
+	expression := model.Expression{ID: 1, Definition: "contains(name, 'a')"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, es.RegisterFunction(Function{
+				Name:    "f" + strconv.Itoa(i),
+				Returns: parser.TypeBoolean,
+				Call:    func(args ...interface{}) (interface{}, error) { return true, nil },
+			}))
+		}(i)
+		go func() {
+			defer wg.Done()
+			response, err := es.ExecuteExpression(context.Background(), expression, "name=abc", EvaluationOptions{})
+			assert.NoError(t, err)
+			assert.True(t, response.Result)
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, es.Functions(), len(builtins)+20)
+}
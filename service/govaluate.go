@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/Knetic/govaluate"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/metrics"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"sort"
+	"strings"
+)
+
+// GovaluateEngine runs definitions written for github.com/Knetic/govaluate,
+// with its operators, literals and semantics. Function calls, variable paths
+// and regular expressions are rejected with a DialectError: govaluate cannot
+// call the functions of the rule language, would look paths up as flat names,
+// and matches patterns differently from MATCHES.
+type GovaluateEngine struct{}
+
+func (GovaluateEngine) Compile(ctx context.Context, source Source) (Program, error) {
+	evaluable, err := govaluate.NewEvaluableExpression(source.Definition)
+	if err != nil {
+		metrics.ParseFailuresTotal.Inc()
+		if strings.HasPrefix(err.Error(), "Undefined function") {
+			return nil, &DialectError{Dialect: model.DialectGovaluate, Feature: FeatureFunctions}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrCreatingEvaluableExpression, err)
+	}
+
+	for _, token := range evaluable.Tokens() {
+		switch {
+		case token.Kind == govaluate.VARIABLE && strings.Contains(fmt.Sprint(token.Value), "."):
+			return nil, &DialectError{Dialect: model.DialectGovaluate, Feature: FeaturePaths}
+		case token.Kind == govaluate.COMPARATOR && (token.Value == "=~" || token.Value == "!~"):
+			return nil, &DialectError{Dialect: model.DialectGovaluate, Feature: FeatureRegularExpressions}
+		}
+	}
+	return govaluateProgram{evaluable: evaluable}, nil
+}
+
+type govaluateProgram struct {
+	evaluable *govaluate.EvaluableExpression
+}
+
+// Evaluate cannot be interrupted, as govaluate takes no context, but its
+// definitions have no loops or functions and are bounded by the limits.
+func (p govaluateProgram) Evaluate(ctx context.Context, values map[string]interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return p.evaluable.Evaluate(values)
+}
+
+// Variables returns the variables of the definition sorted and without
+// duplicates, which govaluate lists in order of appearance.
+func (p govaluateProgram) Variables() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range p.evaluable.Vars() {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
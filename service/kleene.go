@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+)
+
+// kleene evaluates node with Kleene's strong three-valued logic: a
+// sub-expression referencing a missing variable is unknown, and a connective
+// is unknown only when its known operands do not already decide it, so
+// "false AND unknown" is false and "true OR unknown" is true. Like the
+// evaluator, the right operand is skipped once the left one decides the result.
+func (c *compiledExpression) kleene(ctx context.Context, node parser.Node, parameters map[string]interface{}) (model.Outcome, error) {
+	switch n := node.(type) {
+	case *parser.Unary:
+		if n.Operator == parser.OpNot {
+			operand, err := c.kleene(ctx, n.Operand, parameters)
+			if err != nil {
+				return "", err
+			}
+			return kleeneNot(operand), nil
+		}
+	case *parser.Binary:
+		if n.Operator.IsLogical() {
+			left, err := c.kleene(ctx, n.Left, parameters)
+			if err != nil {
+				return "", err
+			}
+			if outcome, decided := kleeneDecided(n.Operator, left); decided {
+				return outcome, nil
+			}
+			right, err := c.kleene(ctx, n.Right, parameters)
+			if err != nil {
+				return "", err
+			}
+			return kleeneBinary(n.Operator, left, right), nil
+		}
+	}
+
+	if len(missingVariables(parser.Variables(node), parameters)) > 0 {
+		return model.OutcomeUnknown, nil
+	}
+
+	value, err := c.evaluateNode(ctx, node, parameters)
+	if err != nil {
+		return "", err
+	}
+
+	outcome, isOutcome := toOutcome(value)
+	if !isOutcome {
+		return "", fmt.Errorf("operand %s is not a boolean", node.String())
+	}
+	return outcome, nil
+}
+
+// kleeneDecided returns the outcome of a connective whose left operand alone
+// decides it.
+func kleeneDecided(operator parser.Operator, left model.Outcome) (model.Outcome, bool) {
+	switch {
+	case operator == parser.OpAnd && left == model.OutcomeFalse:
+		return model.OutcomeFalse, true
+	case operator == parser.OpOr && left == model.OutcomeTrue:
+		return model.OutcomeTrue, true
+	case operator == parser.OpImplies && left == model.OutcomeFalse:
+		return model.OutcomeTrue, true
+	}
+	return "", false
+}
+
+func kleeneNot(operand model.Outcome) model.Outcome {
+	switch operand {
+	case model.OutcomeTrue:
+		return model.OutcomeFalse
+	case model.OutcomeFalse:
+		return model.OutcomeTrue
+	default:
+		return model.OutcomeUnknown
+	}
+}
+
+func kleeneBinary(operator parser.Operator, left, right model.Outcome) model.Outcome {
+	switch operator {
+	case parser.OpAnd:
+		if left == model.OutcomeFalse || right == model.OutcomeFalse {
+			return model.OutcomeFalse
+		}
+		if left == model.OutcomeUnknown || right == model.OutcomeUnknown {
+			return model.OutcomeUnknown
+		}
+		return model.OutcomeTrue
+	case parser.OpOr:
+		if left == model.OutcomeTrue || right == model.OutcomeTrue {
+			return model.OutcomeTrue
+		}
+		if left == model.OutcomeUnknown || right == model.OutcomeUnknown {
+			return model.OutcomeUnknown
+		}
+		return model.OutcomeFalse
+	case parser.OpImplies:
+		return kleeneBinary(parser.OpOr, kleeneNot(left), right)
+	case parser.OpXor, parser.OpIff:
+		if left == model.OutcomeUnknown || right == model.OutcomeUnknown {
+			return model.OutcomeUnknown
+		}
+		if (left != right) == (operator == parser.OpXor) {
+			return model.OutcomeTrue
+		}
+		return model.OutcomeFalse
+	default:
+		return model.OutcomeUnknown
+	}
+}
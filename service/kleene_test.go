@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"testing"
+)
+
+func TestExpression_ExecuteExpressionMissingVariables(t *testing.T) {
+	testCases := []struct {
+		name            string
+		definition      string
+		storedPolicy    model.MissingVariablePolicy
+		requestedPolicy model.MissingVariablePolicy
+		urlParams       string
+		expectedOutcome model.Outcome
+		expectedError   error
+	}{
+		{
+			name:          "should fail by default",
+			definition:    "x and y",
+			urlParams:     "x=1",
+			expectedError: ErrEvaluatingExpression,
+		},
+		{
+			name:            "should treat missing variables as false",
+			definition:      "x and not y",
+			storedPolicy:    model.MissingVariablesFalse,
+			urlParams:       "x=1",
+			expectedOutcome: model.OutcomeTrue,
+		},
+		{
+			name:            "should prefer the requested policy",
+			definition:      "x and y",
+			storedPolicy:    model.MissingVariablesError,
+			requestedPolicy: model.MissingVariablesUnknown,
+			urlParams:       "x=1",
+			expectedOutcome: model.OutcomeUnknown,
+		},
+		{
+			name:            "should decide AND without the missing variable",
+			definition:      "x and y",
+			storedPolicy:    model.MissingVariablesUnknown,
+			urlParams:       "x=0",
+			expectedOutcome: model.OutcomeFalse,
+		},
+		{
+			name:            "should decide OR without the missing variable",
+			definition:      "x or (y xor z)",
+			storedPolicy:    model.MissingVariablesUnknown,
+			urlParams:       "x=1",
+			expectedOutcome: model.OutcomeTrue,
+		},
+		{
+			name:            "should decide IMPLIES from a false premise",
+			definition:      "x -> y",
+			storedPolicy:    model.MissingVariablesUnknown,
+			urlParams:       "x=0",
+			expectedOutcome: model.OutcomeTrue,
+		},
+		{
+			name:            "should stay unknown when the missing variable matters",
+			definition:      "not (x iff y)",
+			storedPolicy:    model.MissingVariablesUnknown,
+			urlParams:       "x=1",
+			expectedOutcome: model.OutcomeUnknown,
+		},
+		{
+			name:            "should evaluate normally when nothing is missing",
+			definition:      "x and y",
+			storedPolicy:    model.MissingVariablesUnknown,
+			urlParams:       "x=1,y=1",
+			expectedOutcome: model.OutcomeTrue,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := ExpressionService{}
+			expression := model.Expression{
+				ID:               1,
+				Definition:       tc.definition,
+				MissingVariables: tc.storedPolicy,
+			}
+
+			result, err := service.ExecuteExpression(context.Background(), expression, tc.urlParams, EvaluationOptions{
+				MissingVariables: tc.requestedPolicy,
+			})
+
+			assert.Equal(t, tc.expectedError, err)
+			assert.Equal(t, tc.expectedOutcome, result.Outcome)
+			assert.Equal(t, tc.expectedOutcome == model.OutcomeTrue, result.Result)
+		})
+	}
+}
+
+func TestExpression_ExecuteExpressionUnknownShortCircuits(t *testing.T) {
+	testCases := []struct {
+		name            string
+		definition      string
+		urlParams       string
+		expectedOutcome model.Outcome
+	}{
+		{
+			name:            "should skip the right side of a false AND",
+			definition:      "x and probe()",
+			urlParams:       "x=0",
+			expectedOutcome: model.OutcomeFalse,
+		},
+		{
+			name:            "should skip the right side of a true OR",
+			definition:      "x or probe()",
+			urlParams:       "x=1",
+			expectedOutcome: model.OutcomeTrue,
+		},
+		{
+			name:            "should skip the conclusion of a false premise",
+			definition:      "x -> probe()",
+			urlParams:       "x=0",
+			expectedOutcome: model.OutcomeTrue,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			service := ExpressionService{}
+			assert.NoError(t, service.RegisterFunction(Function{
+				Name:    "probe",
+				Returns: parser.TypeBoolean,
+				Call: func(args ...interface{}) (interface{}, error) {
+					calls++
+					return nil, errors.New("probe should not be called")
+				},
+			}))
+			expression := model.Expression{ID: 1, Definition: tc.definition}
+
+			result, err := service.ExecuteExpression(context.Background(), expression, tc.urlParams, EvaluationOptions{
+				MissingVariables: model.MissingVariablesUnknown,
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedOutcome, result.Outcome)
+			assert.Zero(t, calls)
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrDefinitionTooLong  = errors.New(util.ErrDefinitionTooLong)
+	ErrExpressionTooDeep  = errors.New(util.ErrExpressionTooDeep)
+	ErrExpressionTooLarge = errors.New(util.ErrExpressionTooLarge)
+	ErrTooManyVariables   = errors.New(util.ErrTooManyVariables)
+	ErrEvaluationTimeout  = errors.New(util.ErrEvaluationTimeout)
+	ErrValuesTooLarge     = errors.New(util.ErrValuesTooLarge)
+)
+
+// The limits applied when the service is not configured otherwise.
+// DefaultMaxDefinitionLength is the width of the definition column in
+// init.sql, so definitions that compile can also be stored.
+const (
+	DefaultMaxDefinitionLength = 255
+	DefaultMaxDepth            = 64
+	DefaultMaxNodes            = 1024
+	DefaultMaxVariables        = 128
+	DefaultEvaluationTimeout   = time.Second
+	DefaultMaxValues           = 10000
+	DefaultMaxValueDepth       = 32
+)
+
+// Limits bound the definitions ExpressionService compiles and the time it
+// spends evaluating them. A zero field takes the matching default.
+type Limits struct {
+	// MaxDefinitionLength caps the characters of a definition. Raising it
+	// above the width of the definition column needs the column widened.
+	MaxDefinitionLength int
+	// MaxDepth caps the nesting of the syntax tree, counted after references
+	// are inlined.
+	MaxDepth int
+	// MaxNodes caps the size of the syntax tree, counted after references are
+	// inlined.
+	MaxNodes int
+	// MaxVariables caps the distinct variables of a definition.
+	MaxVariables int
+	// EvaluationTimeout caps a single evaluation, on top of the request
+	// deadline.
+	EvaluationTimeout time.Duration
+	// MaxValues caps the values given to an evaluation, as JSON or in the
+	// query, counting every element of their lists and objects.
+	MaxValues int
+	// MaxValueDepth caps the nesting of the lists and objects in those values.
+	MaxValueDepth int
+}
+
+func (l Limits) maxDefinitionLength() int {
+	if l.MaxDefinitionLength > 0 {
+		return l.MaxDefinitionLength
+	}
+	return DefaultMaxDefinitionLength
+}
+
+func (l Limits) maxDepth() int {
+	if l.MaxDepth > 0 {
+		return l.MaxDepth
+	}
+	return DefaultMaxDepth
+}
+
+func (l Limits) maxNodes() int {
+	if l.MaxNodes > 0 {
+		return l.MaxNodes
+	}
+	return DefaultMaxNodes
+}
+
+func (l Limits) maxVariables() int {
+	if l.MaxVariables > 0 {
+		return l.MaxVariables
+	}
+	return DefaultMaxVariables
+}
+
+func (l Limits) maxValues() int {
+	if l.MaxValues > 0 {
+		return l.MaxValues
+	}
+	return DefaultMaxValues
+}
+
+func (l Limits) maxValueDepth() int {
+	if l.MaxValueDepth > 0 {
+		return l.MaxValueDepth
+	}
+	return DefaultMaxValueDepth
+}
+
+func (l Limits) evaluationTimeout() time.Duration {
+	if l.EvaluationTimeout > 0 {
+		return l.EvaluationTimeout
+	}
+	return DefaultEvaluationTimeout
+}
+
+// saveAnalysisTimeout leaves half of the time the request has left to store
+// an expression once its analysis is given up, and is zero without a
+// deadline.
+func saveAnalysisTimeout(ctx context.Context) time.Duration {
+	deadline, hasDeadline := ctx.Deadline()
+	if !hasDeadline {
+		return 0
+	}
+	return time.Until(deadline) / 2
+}
+
+// checkDefinition runs before parsing, so oversized input is never parsed.
+func (l Limits) checkDefinition(definition string) error {
+	if length := utf8.RuneCountInString(definition); length > l.maxDefinitionLength() {
+		return fmt.Errorf("%w: %d characters, at most %d allowed", ErrDefinitionTooLong, length, l.maxDefinitionLength())
+	}
+	return nil
+}
+
+// checkTree runs once references are inlined, since they can make a short
+// definition arbitrarily large; resolve already stops past the node limit.
+func (l Limits) checkTree(node parser.Node) error {
+	if depth := parser.Depth(node); depth > l.maxDepth() {
+		return fmt.Errorf("%w: depth %d, at most %d allowed", ErrExpressionTooDeep, depth, l.maxDepth())
+	}
+	if size := parser.Size(node); size > l.maxNodes() {
+		return fmt.Errorf("%w: %d nodes, at most %d allowed", ErrExpressionTooLarge, size, l.maxNodes())
+	}
+	return l.checkVariables(len(parser.Variables(node)))
+}
+
+// checkVariables also applies to dialects that do not translate into a
+// syntax tree.
+func (l Limits) checkVariables(variables int) error {
+	if variables > l.maxVariables() {
+		return fmt.Errorf("%w: %d variables, at most %d allowed", ErrTooManyVariables, variables, l.maxVariables())
+	}
+	return nil
+}
+
+// checkValues bounds the values of an evaluation, which ANY IN and ALL IN loop
+// over. A value that is not a list or an object has depth 1.
+func (l Limits) checkValues(values map[string]interface{}) error {
+	count := 0
+	var check func(value interface{}, depth int) error
+	check = func(value interface{}, depth int) error {
+		if count++; count > l.maxValues() {
+			return fmt.Errorf("%w: more than %d values", ErrValuesTooLarge, l.maxValues())
+		}
+		if depth > l.maxValueDepth() {
+			return fmt.Errorf("%w: nested deeper than %d", ErrValuesTooLarge, l.maxValueDepth())
+		}
+		switch v := value.(type) {
+		case []interface{}:
+			for _, element := range v {
+				if err := check(element, depth+1); err != nil {
+					return err
+				}
+			}
+		case map[string]interface{}:
+			for _, element := range v {
+				if err := check(element, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, value := range values {
+		if err := check(value, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExpression_Limits(t *testing.T) {
+	limits := Limits{MaxDefinitionLength: 40, MaxDepth: 4, MaxNodes: 9, MaxVariables: 3}
+	source := &repository.Stub{Expressions: []model.Expression{
+		{ID: 2, Name: "wide", Definition: "b or c or d"},
+	}}
+
+	testCases := []struct {
+		name       string
+		definition string
+		err        error
+	}{
+		{
+			name:       "should accept definitions within the limits",
+			definition: "a and (b or c)",
+		},
+		{
+			name:       "should reject long definitions",
+			definition: "a" + strings.Repeat(" or a", 8),
+			err:        ErrDefinitionTooLong,
+		},
+		{
+			name:       "should reject deep definitions",
+			definition: "not not not not a",
+			err:        ErrExpressionTooDeep,
+		},
+		{
+			name:       "should reject large definitions",
+			definition: "(a or b) and (a or b) and (a or b)",
+			err:        ErrExpressionTooLarge,
+		},
+		{
+			name:       "should reject definitions with many variables",
+			definition: "a or b or c or d",
+			err:        ErrTooManyVariables,
+		},
+		{
+			name:       "should count inlined references",
+			definition: "@wide and a",
+			err:        ErrTooManyVariables,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			es := ExpressionService{
+				Source: source,
+				Limits: limits,
+			}
+			_, err := es.ExecuteExpression(context.Background(), model.Expression{ID: 1, Definition: tc.definition}, "a=1,b=0,c=0,d=0", EvaluationOptions{})
+
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestExpression_EvaluationTimeout(t *testing.T) {
+	es := ExpressionService{Limits: Limits{EvaluationTimeout: 10 * time.Millisecond}}
+	var calls int32
+	assert.NoError(t, es.RegisterFunction(Function{
+		Name:    "slow",
+		Returns: parser.TypeBoolean,
+		Call: func(args ...interface{}) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(200 * time.Millisecond)
+			return true, nil
+		},
+	}))
+
+	_, err := es.ExecuteExpression(context.Background(), model.Expression{ID: 1, Definition: "slow() and slow()"}, "", EvaluationOptions{})
+	assert.ErrorIs(t, err, ErrEvaluationTimeout)
+	assert.NotErrorIs(t, err, context.DeadlineExceeded, "the request deadline is reported separately")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "the evaluation should stop at the deadline")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	es.Limits.EvaluationTimeout = time.Second
+	_, err = es.ExecuteExpression(ctx, model.Expression{ID: 1, Definition: "slow()"}, "", EvaluationOptions{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestExpression_ValueLimits(t *testing.T) {
+	testCases := []struct {
+		name   string
+		values map[string]interface{}
+		err    error
+	}{
+		{
+			name:   "should accept values within the limits",
+			values: map[string]interface{}{"a": true, "tags": []interface{}{"x", "y"}, "user": map[string]interface{}{"roles": []interface{}{"admin"}}},
+		},
+		{
+			name:   "should count the elements of lists and objects",
+			values: map[string]interface{}{"a": true, "tags": []interface{}{"x", "y", "z", "w", "v", "u"}},
+			err:    ErrValuesTooLarge,
+		},
+		{
+			name:   "should reject values nested too deeply",
+			values: map[string]interface{}{"a": true, "user": map[string]interface{}{"roles": []interface{}{[]interface{}{"admin"}}}},
+			err:    ErrValuesTooLarge,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			es := ExpressionService{Limits: Limits{MaxValues: 7, MaxValueDepth: 3}}
+			_, err := es.ExecuteExpressionWithValues(context.Background(), model.Expression{ID: 1, Definition: "a"}, tc.values, EvaluationOptions{})
+
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestExpression_QueryValueLimits(t *testing.T) {
+	es := ExpressionService{Limits: Limits{MaxValues: 7}}
+	expression := model.Expression{ID: 1, Definition: `a and ANY tags IN ["x"]`}
+
+	_, err := es.ExecuteExpression(context.Background(), expression, "a=true,tags=[x,y]", EvaluationOptions{})
+	assert.NoError(t, err)
+
+	_, err = es.ExecuteExpression(context.Background(), expression, "a=true,tags=[x,y,z,w,v,u]", EvaluationOptions{})
+	assert.ErrorIs(t, err, ErrValuesTooLarge, "query lists should count against the same limit as JSON values")
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// splitParameters splits comma separated name=value pairs, keeping the commas
+// of list values such as tags=[a,b] inside their pair.
+func splitParameters(urlParams string) []string {
+	var params []string
+	var open []string
+
+	for _, piece := range strings.Split(urlParams, ",") {
+		if open != nil {
+			open = append(open, piece)
+			if isListEnd(piece) {
+				params = append(params, strings.Join(open, ","))
+				open = nil
+			}
+			continue
+		}
+
+		_, value, _ := strings.Cut(piece, "=")
+		if isListStart(value) && !isListEnd(value) {
+			open = []string{piece}
+			continue
+		}
+		params = append(params, piece)
+	}
+
+	if open != nil {
+		params = append(params, strings.Join(open, ","))
+	}
+	return params
+}
+
+func isListStart(value string) bool {
+	return strings.HasPrefix(value, "[") || strings.HasPrefix(strings.ToUpper(value), "%5B")
+}
+
+func isListEnd(value string) bool {
+	return strings.HasSuffix(value, "]") || strings.HasSuffix(strings.ToUpper(value), "%5D")
+}
+
+// parseList reads a list written as [a,b,c] with URL-unescaped elements.
+// Elements that read as numbers are numbers, true and false are booleans and
+// everything else is a string.
+func parseList(raw string) ([]interface{}, bool) {
+	value, err := url.QueryUnescape(raw)
+	if err != nil || !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+		return nil, false
+	}
+
+	inner := value[1 : len(value)-1]
+	list := []interface{}{}
+	if inner == "" {
+		return list, true
+	}
+
+	for _, element := range strings.Split(inner, ",") {
+		if number, err := strconv.ParseFloat(element, 64); err == nil {
+			list = append(list, number)
+		} else if element == "true" || element == "false" {
+			list = append(list, element == "true")
+		} else {
+			list = append(list, element)
+		}
+	}
+	return list, true
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"testing"
+)
+
+func TestExpression_Lists(t *testing.T) {
+	testCases := []struct {
+		name       string
+		definition string
+		urlParams  string
+		expected   bool
+		err        error
+	}{
+		{
+			name:       "should test membership with IN",
+			definition: `role in ["admin", "owner"] and not 3 in levels`,
+			urlParams:  "role=owner,levels=[1,2]",
+			expected:   true,
+		},
+		{
+			name:       "should test membership with CONTAINS",
+			definition: `tags contains "beta" and tags contains tag`,
+			urlParams:  "tags=[beta,new],tag=new",
+			expected:   true,
+		},
+		{
+			name:       "should test intersection with ANY",
+			definition: `any roles in ["admin", "owner"] and not any roles in []`,
+			urlParams:  "roles=[viewer,owner]",
+			expected:   true,
+		},
+		{
+			name:       "should test inclusion with ALL",
+			definition: `all required in granted and all [] in granted and not all granted in required`,
+			urlParams:  "required=[read],granted=[read,write]",
+			expected:   true,
+		},
+		{
+			name:       "should read url encoded lists",
+			definition: `"a b" in names`,
+			urlParams:  "names=%5Ba%20b,c%5D",
+			expected:   true,
+		},
+		{
+			name:       "should read empty lists",
+			definition: `not 1 in values`,
+			urlParams:  "values=[]",
+			expected:   true,
+		},
+		{
+			name:       "should pass lists to functions",
+			definition: `in(tags, [1], ["beta"]) and tags contains lower("BETA")`,
+			urlParams:  "tags=[beta]",
+			expected:   true,
+		},
+		{
+			name:       "should keep evaluating definitions stored with the keywords as variables",
+			definition: `in and not contains or any and all and matches`,
+			urlParams:  "in=1,contains=0,any=0,all=1,matches=1",
+			expected:   true,
+		},
+		{
+			name:       "should fail when the list side is not a list",
+			definition: `x in y`,
+			urlParams:  "x=1,y=2",
+			err:        ErrEvaluatingExpression,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			es := ExpressionService{}
+			response, err := es.ExecuteExpression(context.Background(), model.Expression{ID: 1, Definition: tc.definition}, tc.urlParams, EvaluationOptions{})
+
+			assert.ErrorIs(t, err, tc.err)
+			if tc.err == nil {
+				assert.Equal(t, tc.expected, response.Result)
+			}
+		})
+	}
+}
+
+func TestExpression_ExecuteExpressionWithValues(t *testing.T) {
+	es := ExpressionService{}
+	expression := model.Expression{ID: 1, Definition: `any tags in ["beta"] and "admin" in roles and age >= 18`}
+
+	response, err := es.ExecuteExpressionWithValues(context.Background(), expression, map[string]interface{}{
+		"tags":  []interface{}{"beta"},
+		"roles": []interface{}{"admin"},
+		"age":   float64(30),
+	}, EvaluationOptions{Explain: true})
+
+	assert.NoError(t, err)
+	assert.True(t, response.Result)
+	assert.Equal(t, `{"age":30,"roles":["admin"],"tags":["beta"]}`, response.Values)
+	assert.Equal(t, []interface{}{"beta"}, response.Explanation.Operands[0].Operands[0].Operands[0].Value)
+}
+
+func TestParseParameters(t *testing.T) {
+	types := map[string]parser.Type{"tags": parser.TypeList, "age": parser.TypeNumber, "name": parser.TypeString, "ok": parser.TypeBoolean}
+
+	values, err := parseParameters("tags=[a,2,true],age=42,name=1,ok=1,x=0,list=[b,c],other=text,bad", types, Limits{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"tags":  []interface{}{"a", float64(2), true},
+		"age":   float64(42),
+		"name":  "1",
+		"ok":    true,
+		"x":     false,
+		"list":  []interface{}{"b", "c"},
+		"other": "text",
+	}, values)
+
+	values, err = parseParameters("age=old,tags=a", types, Limits{})
+	assert.NoError(t, err)
+	assert.Empty(t, values)
+
+	_, err = parseParameters("tags=[a,b,c,d],ok=1", types, Limits{MaxValues: 4})
+	assert.ErrorIs(t, err, ErrValuesTooLarge, "query lists should be bounded like JSON values")
+}
+
+// TestParseParametersBooleans pins that boolean variables are read with
+// strconv.ParseBool, ignoring anything else.
+func TestParseParametersBooleans(t *testing.T) {
+	testCases := []struct {
+		name      string
+		urlParams string
+		expected  map[string]interface{}
+	}{
+		{
+			name:      "should read 1 and 0",
+			urlParams: "x=1,y=0",
+			expected:  map[string]interface{}{"x": true, "y": false},
+		},
+		{
+			name:      "should read true and false in any case",
+			urlParams: "x=TRUE,y=False",
+			expected:  map[string]interface{}{"x": true, "y": false},
+		},
+		{
+			name:      "should read t and f",
+			urlParams: "x=t,y=F",
+			expected:  map[string]interface{}{"x": true, "y": false},
+		},
+		{
+			name:      "should ignore values that are not booleans",
+			urlParams: "x=yes,y=2",
+			expected:  map[string]interface{}{},
+		},
+		{
+			name:      "should ignore pairs without a value",
+			urlParams: "x,y=",
+			expected:  map[string]interface{}{},
+		},
+		{
+			name:      "should keep the last value of a repeated variable",
+			urlParams: "x=1,x=0",
+			expected:  map[string]interface{}{"x": false},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, err := parser.Parse("x and y")
+			assert.NoError(t, err)
+
+			values, err := parseParameters(tc.urlParams, parser.InferTypes(node), Limits{})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, values)
+		})
+	}
+}
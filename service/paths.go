@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"strings"
+)
+
+var ErrMissingPath = errors.New(util.ErrMissingPath)
+
+// PathError reports a variable path that does not lead to a value: Path is
+// the variable and Reason names the step that failed.
+type PathError struct {
+	Path   string
+	Reason string
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", util.ErrMissingPath, e.Path, e.Reason)
+}
+
+func (e *PathError) Unwrap() error {
+	return ErrMissingPath
+}
+
+// resolvePaths adds to values the value of every variable path in node, found
+// by walking the nested maps and lists under its first segment. A path that is
+// already a key of values, as query string input is, is left alone, and so is
+// one whose first segment has no value, which is a plain missing variable. The
+// other paths that cannot be followed are returned as errors and left
+// missing.
+func resolvePaths(node parser.Node, values map[string]interface{}) []*PathError {
+	var errs []*PathError
+
+	parser.Walk(node, func(n parser.Node) {
+		variable, isVariable := n.(*parser.Variable)
+		if !isVariable {
+			return
+		}
+		if _, exists := values[variable.Name]; exists {
+			return
+		}
+
+		path := variable.Path()
+		root, exists := values[path[0].Field]
+		if len(path) == 1 || !exists {
+			return
+		}
+
+		value, err := follow(root, path)
+		if err != nil {
+			errs = append(errs, &PathError{Path: variable.Name, Reason: err.Error()})
+			return
+		}
+		values[variable.Name] = value
+	})
+
+	return errs
+}
+
+func follow(value interface{}, path []parser.PathSegment) (interface{}, error) {
+	for i := 1; i < len(path); i++ {
+		step, traversed := path[i], pathString(path[:i])
+
+		if step.IsIndex {
+			list, isList := value.([]interface{})
+			if !isList {
+				return nil, fmt.Errorf("%s is not a list", traversed)
+			}
+			if step.Index >= len(list) {
+				return nil, fmt.Errorf("%s has no index %d, its length is %d", traversed, step.Index, len(list))
+			}
+			value = list[step.Index]
+			continue
+		}
+
+		object, isObject := value.(map[string]interface{})
+		if !isObject {
+			return nil, fmt.Errorf("%s is not an object", traversed)
+		}
+		field, exists := object[step.Field]
+		if !exists {
+			return nil, fmt.Errorf("%s has no field %s", traversed, step.Field)
+		}
+		value = field
+	}
+	return value, nil
+}
+
+func pathString(path []parser.PathSegment) string {
+	var sb strings.Builder
+	for i, step := range path {
+		switch {
+		case step.IsIndex:
+			fmt.Fprintf(&sb, "[%d]", step.Index)
+		case i > 0:
+			sb.WriteString("." + step.Field)
+		default:
+			sb.WriteString(step.Field)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"testing"
+)
+
+func TestExpression_Paths(t *testing.T) {
+	values := map[string]interface{}{
+		"user":  map[string]interface{}{"country": "BR", "roles": []interface{}{"admin"}},
+		"items": []interface{}{map[string]interface{}{"price": float64(5)}, float64(3)},
+	}
+
+	testCases := []struct {
+		name       string
+		definition string
+		policy     model.MissingVariablePolicy
+		outcome    model.Outcome
+		err        string
+	}{
+		{
+			name:       "should resolve fields and indexes",
+			definition: `user.country == "BR" and user.roles[0] == "admin" and items[0].price < 10 and "admin" in user.roles`,
+			outcome:    model.OutcomeTrue,
+		},
+		{
+			name:       "should report missing fields",
+			definition: `user.address.city == "Recife"`,
+			err:        "variable path does not exist in the values: user.address.city: user has no field address",
+		},
+		{
+			name:       "should report indexes out of range",
+			definition: "items[2] > 1",
+			err:        "variable path does not exist in the values: items[2]: items has no index 2, its length is 2",
+		},
+		{
+			name:       "should report steps into values that are not objects",
+			definition: "items[1].price > 1",
+			err:        "variable path does not exist in the values: items[1].price: items[1] is not an object",
+		},
+		{
+			name:       "should report indexes into values that are not lists",
+			definition: "user[0] == 1",
+			err:        "variable path does not exist in the values: user[0]: user is not a list",
+		},
+		{
+			name:       "should apply the missing variable policy to missing paths",
+			definition: `user.address.city == "Recife" or user.country == "BR"`,
+			policy:     model.MissingVariablesUnknown,
+			outcome:    model.OutcomeTrue,
+		},
+		{
+			name:       "should treat paths under a missing variable as missing variables",
+			definition: "account.active",
+			policy:     model.MissingVariablesFalse,
+			outcome:    model.OutcomeFalse,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			es := ExpressionService{}
+			expression := model.Expression{ID: 1, Definition: tc.definition}
+			response, err := es.ExecuteExpressionWithValues(context.Background(), expression, values, EvaluationOptions{MissingVariables: tc.policy})
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.ErrorIs(t, err, ErrMissingPath)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.outcome, response.Outcome)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownReference = errors.New(util.ErrUnknownReference)
+	ErrReferenceCycle   = errors.New(util.ErrReferenceCycle)
+)
+
+// ExpressionSource looks up the expressions that definitions reference.
+type ExpressionSource interface {
+	GetExpressionById(ctx context.Context, expressionId int) (model.Expression, error)
+	GetExpressionByName(ctx context.Context, name string) (model.Expression, error)
+}
+
+// resolve replaces every reference in node with the syntax tree of the
+// expression it names, recursively, and adds every id inlined to
+// dependencies. Each referenced expression is looked up and resolved once
+// per call, its tree shared between its occurrences, and nodes are counted as
+// they are inlined, so a definition that repeats references expanding into
+// more nodes than allowed fails before the expansion is built.
+func (es *ExpressionService) resolve(ctx context.Context, node parser.Node, dependencies map[int]bool) (parser.Node, error) {
+	r := &resolver{
+		es:           es,
+		dependencies: dependencies,
+		expressions:  make(map[string]model.Expression),
+		resolved:     make(map[int]resolvedReference),
+	}
+	return r.resolve(ctx, node, nil)
+}
+
+// resolver holds the lookups and the resolved references of one resolve
+// call, and the number of nodes it has inlined.
+type resolver struct {
+	es           *ExpressionService
+	dependencies map[int]bool
+	expressions  map[string]model.Expression
+	resolved     map[int]resolvedReference
+	nodes        int
+}
+
+type resolvedReference struct {
+	node parser.Node
+	size int
+}
+
+// count adds nodes to the expansion, failing once it is larger than allowed.
+func (r *resolver) count(nodes int) error {
+	r.nodes += nodes
+	if r.nodes > r.es.Limits.maxNodes() {
+		return fmt.Errorf("%w: more than %d nodes once references are inlined", ErrExpressionTooLarge, r.es.Limits.maxNodes())
+	}
+	return nil
+}
+
+// resolve inlines the references under node. path holds the ids being
+// resolved so a reference back to one of them is reported as a cycle. A
+// reference resolved before cannot lead back to path, since the cycle would
+// have been reported then.
+func (r *resolver) resolve(ctx context.Context, node parser.Node, path []int) (parser.Node, error) {
+	switch n := node.(type) {
+	case *parser.Reference:
+		referenced, err := r.lookup(ctx, n)
+		if err != nil {
+			return nil, err
+		}
+		if resolved, exists := r.resolved[referenced.ID]; exists {
+			return resolved.node, r.count(resolved.size)
+		}
+		for i, id := range path {
+			if id == referenced.ID {
+				return nil, fmt.Errorf("%w: %s", ErrReferenceCycle, cycle(append(path[i:], id)))
+			}
+		}
+		r.dependencies[referenced.ID] = true
+
+		parse, translates := translator(referenced.Dialect)
+		if !translates {
+			return nil, fmt.Errorf("referenced expression %d: %w", referenced.ID, &DialectError{Dialect: referenced.Dialect, Feature: FeatureReferences})
+		}
+		child, err := parse(referenced.Definition)
+		if err != nil {
+			return nil, fmt.Errorf("%w: referenced expression %d: %s", ErrCreatingEvaluableExpression, referenced.ID, err)
+		}
+
+		before := r.nodes
+		resolved, err := r.resolve(ctx, child, append(path[:len(path):len(path)], referenced.ID))
+		if err != nil {
+			return nil, err
+		}
+		r.resolved[referenced.ID] = resolvedReference{node: resolved, size: r.nodes - before}
+		return resolved, nil
+	case *parser.Unary:
+		if err := r.count(1); err != nil {
+			return nil, err
+		}
+		operand, err := r.resolve(ctx, n.Operand, path)
+		if err != nil {
+			return nil, err
+		}
+		return &parser.Unary{Operator: n.Operator, Operand: operand}, nil
+	case *parser.Binary:
+		if err := r.count(1); err != nil {
+			return nil, err
+		}
+		left, err := r.resolve(ctx, n.Left, path)
+		if err != nil {
+			return nil, err
+		}
+		right, err := r.resolve(ctx, n.Right, path)
+		if err != nil {
+			return nil, err
+		}
+		return &parser.Binary{Operator: n.Operator, Left: left, Right: right}, nil
+	case *parser.Call:
+		if err := r.count(1); err != nil {
+			return nil, err
+		}
+		args := make([]parser.Node, len(n.Args))
+		for i, arg := range n.Args {
+			resolved, err := r.resolve(ctx, arg, path)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = resolved
+		}
+		return &parser.Call{Name: n.Name, Args: args, Function: n.Function}, nil
+	case *parser.List:
+		if err := r.count(1); err != nil {
+			return nil, err
+		}
+		elements := make([]parser.Node, len(n.Elements))
+		for i, element := range n.Elements {
+			resolved, err := r.resolve(ctx, element, path)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = resolved
+		}
+		return &parser.List{Elements: elements}, nil
+	}
+	return node, r.count(1)
+}
+
+// lookup finds the expression a reference names, once per target.
+func (r *resolver) lookup(ctx context.Context, reference *parser.Reference) (model.Expression, error) {
+	if expression, exists := r.expressions[reference.Target]; exists {
+		return expression, nil
+	}
+	expression, err := r.es.lookup(ctx, reference)
+	if err != nil {
+		return model.Expression{}, err
+	}
+	r.expressions[reference.Target] = expression
+	return expression, nil
+}
+
+func (es *ExpressionService) lookup(ctx context.Context, reference *parser.Reference) (model.Expression, error) {
+	if es.Source == nil {
+		return model.Expression{}, fmt.Errorf("%w: %s", ErrUnknownReference, reference)
+	}
+
+	var expression model.Expression
+	var err error
+	if id, isId := reference.ID(); isId {
+		expression, err = es.Source.GetExpressionById(ctx, id)
+	} else {
+		expression, err = es.Source.GetExpressionByName(ctx, reference.Target)
+	}
+	if errors.Is(err, repository.ErrExpressionNotFound) {
+		return model.Expression{}, fmt.Errorf("%w: %s", ErrUnknownReference, reference)
+	}
+	return expression, err
+}
+
+func cycle(ids []int) string {
+	steps := make([]string, len(ids))
+	for i, id := range ids {
+		steps[i] = "@" + strconv.Itoa(id)
+	}
+	return strings.Join(steps, " -> ")
+}
+
+// Invalidate drops the compiled expressions that inline the given expression,
+// so they are resolved again with its new definition, and keeps those being
+// compiled from its previous definition out of the cache. SaveExpression and
+// DeleteExpression call it once the write is stored; call it after updating
+// or deleting an expression through the store directly.
+func (es *ExpressionService) Invalidate(expressionId int) {
+	if es.Cache != nil {
+		es.Cache.RemoveDependents(expressionId)
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
+	"testing"
+)
+
+func TestExpression_ExecuteExpressionReferences(t *testing.T) {
+	source := &repository.Stub{Expressions: []model.Expression{
+		{ID: 1, Name: "isActive", Definition: "active and not banned"},
+		{ID: 2, Name: "isPremium", Definition: "@isActive and premium"},
+		{ID: 3, Name: "loopA", Definition: "@loopB or a"},
+		{ID: 4, Name: "loopB", Definition: "@3 and b"},
+		{ID: 5, Name: "broken", Definition: "a and"},
+	}}
+
+	testCases := []struct {
+		name       string
+		expression model.Expression
+		urlParams  string
+		expected   model.Outcome
+		err        error
+	}{
+		{
+			name:       "should resolve references by name",
+			expression: model.Expression{ID: 10, Definition: "@isActive and premium"},
+			urlParams:  "active=1,banned=0,premium=1",
+			expected:   model.OutcomeTrue,
+		},
+		{
+			name:       "should resolve references by id",
+			expression: model.Expression{ID: 10, Definition: "not @1"},
+			urlParams:  "active=1,banned=1",
+			expected:   model.OutcomeTrue,
+		},
+		{
+			name:       "should resolve references recursively",
+			expression: model.Expression{ID: 10, Definition: "@isPremium or trial"},
+			urlParams:  "active=1,banned=0,premium=0,trial=0",
+			expected:   model.OutcomeFalse,
+		},
+		{
+			name:       "should reject unknown references",
+			expression: model.Expression{ID: 10, Definition: "@missing or a"},
+			err:        ErrUnknownReference,
+		},
+		{
+			name:       "should reject cycles between referenced expressions",
+			expression: model.Expression{ID: 10, Definition: "@loopA"},
+			err:        ErrReferenceCycle,
+		},
+		{
+			name:       "should reject references back to the expression itself",
+			expression: model.Expression{ID: 1, Definition: "@isPremium"},
+			err:        ErrReferenceCycle,
+		},
+		{
+			name:       "should reject referenced expressions that do not parse",
+			expression: model.Expression{ID: 10, Definition: "@broken"},
+			err:        ErrCreatingEvaluableExpression,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			es := ExpressionService{Source: source}
+			response, err := es.ExecuteExpression(context.Background(), tc.expression, tc.urlParams, EvaluationOptions{})
+
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, tc.expected, response.Outcome)
+		})
+	}
+}
+
+func TestExpression_Invalidate(t *testing.T) {
+	source := &repository.Stub{Expressions: []model.Expression{
+		{ID: 1, Name: "isActive", Definition: "active"},
+		{ID: 2, Name: "isAdult", Definition: "adult"},
+	}}
+	es := ExpressionService{Cache: NewExpressionCache(10), Source: source}
+	ctx := context.Background()
+
+	expression := model.Expression{ID: 10, Definition: "@isActive"}
+	other := model.Expression{ID: 11, Definition: "@isAdult"}
+	_, _ = es.ExecuteExpression(ctx, other, "adult=1", EvaluationOptions{})
+
+	response, err := es.ExecuteExpression(ctx, expression, "active=1", EvaluationOptions{})
+	assert.NoError(t, err)
+	assert.True(t, response.Result)
+
+	source.Expressions[0].Definition = "not active"
+	response, _ = es.ExecuteExpression(ctx, expression, "active=1", EvaluationOptions{})
+	assert.True(t, response.Result, "cached definition should be used until invalidated")
+
+	es.Invalidate(1)
+	assert.Equal(t, 1, es.Cache.Stats().Entries, "only dependents of the changed expression should be dropped")
+
+	response, err = es.ExecuteExpression(ctx, expression, "active=1", EvaluationOptions{})
+	assert.NoError(t, err)
+	assert.False(t, response.Result)
+}
+
+// countingSource counts the lookups of the stub it wraps.
+type countingSource struct {
+	*repository.Stub
+	lookups int
+}
+
+func (s *countingSource) GetExpressionById(ctx context.Context, expressionId int) (model.Expression, error) {
+	s.lookups++
+	return s.Stub.GetExpressionById(ctx, expressionId)
+}
+
+func TestExpression_ResolveRepeatedReferences(t *testing.T) {
+	// Every level references the one below twice, so @40 inlines 2^40 copies
+	// of @1.
+	expressions := []model.Expression{{ID: 1, Definition: "a and b"}}
+	for id := 2; id <= 40; id++ {
+		expressions = append(expressions, model.Expression{ID: id, Definition: fmt.Sprintf("@%d and @%d", id-1, id-1)})
+	}
+	source := &countingSource{Stub: &repository.Stub{Expressions: expressions}}
+	es := ExpressionService{Source: source}
+
+	_, err := es.ExecuteExpression(context.Background(), model.Expression{Definition: "@40"}, "a=true,b=true", EvaluationOptions{})
+	assert.ErrorIs(t, err, ErrExpressionTooLarge)
+	assert.LessOrEqual(t, source.lookups, 40, "each expression should be looked up once")
+
+	source.lookups = 0
+	response, err := es.ExecuteExpression(context.Background(), model.Expression{Definition: "@5 or @5"}, "a=true,b=true", EvaluationOptions{})
+	assert.NoError(t, err, "repeated references within the node limit should still be inlined")
+	assert.True(t, response.Result)
+	assert.Equal(t, 5, source.lookups)
+}
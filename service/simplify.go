@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/logging"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/tracing"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"go.opentelemetry.io/otel/attribute"
+	"math/bits"
+	"sort"
+)
+
+// MaxSimplificationVariables bounds Simplify, which tabulates the expression
+// and minimises it with Quine-McCluskey.
+const MaxSimplificationVariables = 12
+
+var ErrSimplifyingReferences = errors.New(util.ErrSimplifyingReferences)
+
+// Simplify rewrites a boolean expression as a minimal sum of products (DNF)
+// and a minimal product of sums (CNF). Simplified is the shorter of the two,
+// so variables the result does not depend on disappear.
+func (es *ExpressionService) Simplify(ctx context.Context, expression model.Expression) (model.Simplification, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ExpressionService.Simplify")
+	defer span.End()
+	span.SetAttributes(attribute.Int("expression.id", expression.ID))
+
+	logger := logging.FromContext(ctx).WithField(logging.FieldExpressionId, expression.ID)
+
+	compiled, err := es.compileWithTree(ctx, expression, FeatureSimplification)
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.WithField("err", err.Error()).Error("error creating evaluable expression")
+		return model.Simplification{}, err
+	}
+
+	variables, err := booleanVariables(compiled.node)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return model.Simplification{}, err
+	}
+	if len(variables) > MaxSimplificationVariables {
+		err := fmt.Errorf("%w: %d variables, at most %d allowed", ErrAnalysisTooLarge, len(variables), MaxSimplificationVariables)
+		tracing.RecordError(span, err)
+		return model.Simplification{}, err
+	}
+
+	results, err := evaluateAll(ctx, compiled, variables)
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.WithField("err", err.Error()).Error("error simplifying expression")
+		return model.Simplification{}, err
+	}
+
+	dnf := sumOfProducts(variables, minimise(len(variables), rows(results, true)))
+	cnf := productOfSums(variables, minimise(len(variables), rows(results, false)))
+
+	simplified := dnf
+	if len(cnf.String()) < len(dnf.String()) {
+		simplified = cnf
+	}
+
+	return model.Simplification{
+		ExpressionId: expression.ID,
+		Definition:   expression.Definition,
+		Simplified:   simplified.String(),
+		DNF:          dnf.String(),
+		CNF:          cnf.String(),
+	}, nil
+}
+
+// SaveSimplification saves a rewrite from Simplify as the next version of the
+// expression, which must still be at the version it was read at. Expressions
+// referencing others are refused with ErrSimplifyingReferences: the rewrite
+// inlines them, so it would neither follow their updates nor keep them from
+// being deleted or renamed.
+func (es *ExpressionService) SaveSimplification(ctx context.Context, expression model.Expression, definition string) (model.SaveResponse, error) {
+	if parse, translates := translator(expression.Dialect); translates {
+		tree, err := parse(expression.Definition)
+		if err != nil {
+			return model.SaveResponse{}, fmt.Errorf("%w: %s", ErrCreatingEvaluableExpression, err)
+		}
+		if references := parser.References(tree); len(references) > 0 {
+			return model.SaveResponse{}, fmt.Errorf("%w: @%s", ErrSimplifyingReferences, references[0])
+		}
+	}
+
+	native := model.DialectNative
+	return es.SaveExpression(ctx, model.ExpressionUpdate{
+		ID:         expression.ID,
+		Definition: definition,
+		Dialect:    &native,
+		Version:    expression.Version,
+	})
+}
+
+// implicant is a product term over the variables: bits set in mask are the
+// variables it does not constrain, and value holds the others, with the first
+// variable as the most significant bit like in enumerate.
+type implicant struct {
+	value uint
+	mask  uint
+}
+
+func rows(results []bool, want bool) []uint {
+	var matching []uint
+	for row, result := range results {
+		if result == want {
+			matching = append(matching, uint(row))
+		}
+	}
+	return matching
+}
+
+// minimise returns a small set of prime implicants covering every row, picking
+// the essential ones first and then greedily the one covering most rows left.
+func minimise(size int, minterms []uint) []implicant {
+	primes := primeImplicants(size, minterms)
+
+	uncovered := make(map[uint]bool, len(minterms))
+	for _, minterm := range minterms {
+		uncovered[minterm] = true
+	}
+
+	var cover []implicant
+	for _, minterm := range minterms {
+		var only *implicant
+		count := 0
+		for i := range primes {
+			if primes[i].covers(minterm) {
+				only = &primes[i]
+				count++
+			}
+		}
+		if count == 1 && uncovered[minterm] {
+			cover = append(cover, *only)
+			only.coverRows(uncovered)
+		}
+	}
+
+	for len(uncovered) > 0 {
+		best, bestCount := implicant{}, 0
+		for _, prime := range primes {
+			count := 0
+			for minterm := range uncovered {
+				if prime.covers(minterm) {
+					count++
+				}
+			}
+			if count > bestCount {
+				best, bestCount = prime, count
+			}
+		}
+		cover = append(cover, best)
+		best.coverRows(uncovered)
+	}
+
+	sortImplicants(cover)
+	return cover
+}
+
+// primeImplicants merges implicants differing in a single variable until no
+// merge is possible; the ones never merged are prime.
+func primeImplicants(size int, minterms []uint) []implicant {
+	current := make(map[implicant]bool, len(minterms))
+	for _, minterm := range minterms {
+		current[implicant{value: minterm}] = false
+	}
+
+	var primes []implicant
+	for len(current) > 0 {
+		next := make(map[implicant]bool)
+		for term := range current {
+			for bit := uint(1); bit < 1<<size; bit <<= 1 {
+				if term.mask&bit != 0 || term.value&bit != 0 {
+					continue
+				}
+				partner := implicant{value: term.value | bit, mask: term.mask}
+				if _, exists := current[partner]; exists {
+					next[implicant{value: term.value, mask: term.mask | bit}] = false
+					current[term] = true
+					current[partner] = true
+				}
+			}
+		}
+		for term, merged := range current {
+			if !merged {
+				primes = append(primes, term)
+			}
+		}
+		current = next
+	}
+
+	sortImplicants(primes)
+	return primes
+}
+
+func (i implicant) covers(minterm uint) bool {
+	return minterm&^i.mask == i.value
+}
+
+func (i implicant) coverRows(uncovered map[uint]bool) {
+	for minterm := range uncovered {
+		if i.covers(minterm) {
+			delete(uncovered, minterm)
+		}
+	}
+}
+
+// sortImplicants orders terms with fewer variables first, then by value, so
+// the rendered definitions are deterministic.
+func sortImplicants(implicants []implicant) {
+	sort.Slice(implicants, func(a, b int) bool {
+		left, right := bits.OnesCount(implicants[a].mask), bits.OnesCount(implicants[b].mask)
+		if left != right {
+			return left > right
+		}
+		if implicants[a].value != implicants[b].value {
+			return implicants[a].value > implicants[b].value
+		}
+		return implicants[a].mask < implicants[b].mask
+	})
+}
+
+// sumOfProducts renders implicants of the true rows as an OR of ANDs.
+func sumOfProducts(variables []string, terms []implicant) parser.Node {
+	if len(terms) == 0 {
+		return &parser.Literal{Value: false}
+	}
+
+	var sum parser.Node
+	for _, term := range terms {
+		var product parser.Node
+		for i, name := range variables {
+			bit := uint(1) << (len(variables) - 1 - i)
+			if term.mask&bit != 0 {
+				continue
+			}
+			var literal parser.Node = &parser.Variable{Name: name}
+			if term.value&bit == 0 {
+				literal = &parser.Unary{Operator: parser.OpNot, Operand: literal}
+			}
+			product = join(parser.OpAnd, product, literal)
+		}
+		if product == nil {
+			return &parser.Literal{Value: true}
+		}
+		sum = join(parser.OpOr, sum, product)
+	}
+	return sum
+}
+
+// productOfSums renders implicants of the false rows as an AND of ORs, each
+// clause being false exactly on its implicant.
+func productOfSums(variables []string, terms []implicant) parser.Node {
+	if len(terms) == 0 {
+		return &parser.Literal{Value: true}
+	}
+
+	var product parser.Node
+	for _, term := range terms {
+		var sum parser.Node
+		for i, name := range variables {
+			bit := uint(1) << (len(variables) - 1 - i)
+			if term.mask&bit != 0 {
+				continue
+			}
+			var literal parser.Node = &parser.Variable{Name: name}
+			if term.value&bit != 0 {
+				literal = &parser.Unary{Operator: parser.OpNot, Operand: literal}
+			}
+			sum = join(parser.OpOr, sum, literal)
+		}
+		if sum == nil {
+			return &parser.Literal{Value: false}
+		}
+		product = join(parser.OpAnd, product, sum)
+	}
+	return product
+}
+
+func join(operator parser.Operator, left, right parser.Node) parser.Node {
+	if left == nil {
+		return right
+	}
+	return &parser.Binary{Operator: operator, Left: left, Right: right}
+}
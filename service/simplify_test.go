@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
+	"testing"
+)
+
+func TestExpression_Simplify(t *testing.T) {
+	testCases := []struct {
+		name       string
+		definition string
+		simplified string
+		dnf        string
+		cnf        string
+		err        error
+	}{
+		{
+			name:       "should drop variables the result does not depend on",
+			definition: "(a and b) or (a and not b)",
+			simplified: "a",
+			dnf:        "a",
+			cnf:        "a",
+		},
+		{
+			name:       "should convert to both normal forms",
+			definition: "a and (b or c)",
+			simplified: "a AND (b OR c)",
+			dnf:        "a AND b OR a AND c",
+			cnf:        "a AND (b OR c)",
+		},
+		{
+			name:       "should prefer the shorter form",
+			definition: "a or (b and c)",
+			simplified: "a OR b AND c",
+			dnf:        "a OR b AND c",
+			cnf:        "(a OR b) AND (a OR c)",
+		},
+		{
+			name:       "should rewrite connectives",
+			definition: "a xor b",
+			simplified: "a AND NOT b OR NOT a AND b",
+			dnf:        "a AND NOT b OR NOT a AND b",
+			cnf:        "(NOT a OR NOT b) AND (a OR b)",
+		},
+		{
+			name:       "should reduce tautologies to true",
+			definition: "a implies (b implies a)",
+			simplified: "TRUE",
+			dnf:        "TRUE",
+			cnf:        "TRUE",
+		},
+		{
+			name:       "should reduce contradictions to false",
+			definition: "a and not a",
+			simplified: "FALSE",
+			dnf:        "FALSE",
+			cnf:        "FALSE",
+		},
+		{
+			name:       "should reject variables used as numbers",
+			definition: "a > 1",
+			err:        ErrNotBooleanVariables,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			es := ExpressionService{}
+			simplification, err := es.Simplify(context.Background(), model.Expression{ID: 1, Definition: tc.definition})
+
+			assert.ErrorIs(t, err, tc.err)
+			if tc.err == nil {
+				assert.Equal(t, model.Simplification{
+					ExpressionId: 1,
+					Definition:   tc.definition,
+					Simplified:   tc.simplified,
+					DNF:          tc.dnf,
+					CNF:          tc.cnf,
+				}, simplification)
+			}
+		})
+	}
+}
+
+func TestExpression_SimplifyPreservesMeaning(t *testing.T) {
+	definitions := []string{
+		"(a or b) and (not a or c) and (b iff not c)",
+		"a xor b xor c xor d",
+		"(a implies b) and (b implies c) and (c implies d) or not (a or d)",
+	}
+
+	es := ExpressionService{}
+	for _, definition := range definitions {
+		t.Run(definition, func(t *testing.T) {
+			simplification, err := es.Simplify(context.Background(), model.Expression{Definition: definition})
+			assert.NoError(t, err)
+
+			for _, rewrite := range []string{simplification.Simplified, simplification.DNF, simplification.CNF} {
+				equivalence, err := es.Equivalent(context.Background(), model.Expression{Definition: definition}, model.Expression{Definition: rewrite})
+				assert.NoError(t, err)
+				assert.True(t, equivalence.Equivalent, rewrite)
+			}
+		})
+	}
+}
+
+func TestExpression_SaveSimplification(t *testing.T) {
+	ctx := context.Background()
+	store := &repository.Stub{Expressions: []model.Expression{
+		{ID: 1, Name: "isActive", Definition: "a and b", Version: 1},
+		{ID: 2, Definition: "(@isActive and c) or (@isActive and not c)", Version: 1},
+		{ID: 3, Definition: "(a and b) or (a and not b)", MissingVariables: model.MissingVariablesFalse, Version: 4},
+	}}
+	es := ExpressionService{Source: store, Store: store}
+
+	_, err := es.SaveSimplification(ctx, store.Expressions[1], "a and b")
+	assert.ErrorIs(t, err, ErrSimplifyingReferences, "the rewrite would inline @isActive")
+	assert.Nil(t, store.SaveExpressionCalledWith)
+
+	response, err := es.SaveSimplification(ctx, store.Expressions[2], "a")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, response.Version)
+	assert.Equal(t, model.Expression{ID: 3, Definition: "a", MissingVariables: model.MissingVariablesFalse, Dialect: model.DialectNative, Version: 5}, store.Expressions[2])
+
+	_, err = es.SaveSimplification(ctx, model.Expression{ID: 3, Definition: "(a and b) or (a and not b)", Version: 4}, "a")
+	assert.ErrorIs(t, err, repository.ErrVersionConflict, "the expression changed since it was simplified")
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/logging"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/tracing"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+)
+
+var errNoStore = errors.New("expressions cannot be written without a store")
+
+// ExpressionStore writes expressions along with the expressions their
+// definitions reference, so that deleting a referenced expression can be
+// refused in the same transaction that would delete it.
+type ExpressionStore interface {
+	GetAllExpressions(ctx context.Context) ([]model.Expression, error)
+	GetExpressionById(ctx context.Context, expressionId int) (model.Expression, error)
+	CreateExpression(ctx context.Context, expression model.Expression, references []model.Reference) (model.Expression, error)
+	// SaveExpression stores the next version of an expression, refusing with
+	// ErrVersionConflict when expression.Version is set and is not the
+	// stored one, and with ErrNameReferenced when renaming an expression
+	// other expressions reference by name.
+	SaveExpression(ctx context.Context, expression model.Expression, references []model.Reference) (model.Expression, error)
+	// DeleteExpression refuses with an error matching ErrHasDependents while
+	// other expressions reference the expression, unless force is set.
+	DeleteExpression(ctx context.Context, expressionId int, force bool) error
+	SaveReferences(ctx context.Context, expressionId int, references []model.Reference) error
+}
+
+// CreateExpression validates and analyses a new expression like
+// SaveExpression, then stores it.
+func (es *ExpressionService) CreateExpression(ctx context.Context, expression model.Expression) (model.SaveResponse, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ExpressionService.CreateExpression")
+	defer span.End()
+
+	response, references, err := es.prepareSave(ctx, expression)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return model.SaveResponse{}, err
+	}
+	if es.Store == nil {
+		return model.SaveResponse{}, errNoStore
+	}
+
+	created, err := es.Store.CreateExpression(ctx, expression, references)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return model.SaveResponse{}, err
+	}
+
+	response.ExpressionId = created.ID
+	response.Version = created.Version
+	return response, nil
+}
+
+// SaveExpression applies an update to the stored expression, rejects
+// definitions that do not compile, including unknown or cyclic references,
+// stores the rest as the next version of the expression with the
+// expressions they reference, and drops the compiled expressions inlining
+// the previous definition. The update is refused with ErrVersionConflict when
+// the expression changes after it is read, or since update.Version when set.
+// The response carries the new version and the analysis of boolean
+// definitions, with a warning when they can never be true or are always true.
+func (es *ExpressionService) SaveExpression(ctx context.Context, update model.ExpressionUpdate) (model.SaveResponse, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ExpressionService.SaveExpression")
+	defer span.End()
+
+	if es.Store == nil {
+		return model.SaveResponse{}, errNoStore
+	}
+	stored, err := es.Store.GetExpressionById(ctx, update.ID)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return model.SaveResponse{}, err
+	}
+	expression := update.Apply(stored)
+
+	response, references, err := es.prepareSave(ctx, expression)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return model.SaveResponse{}, err
+	}
+
+	saved, err := es.Store.SaveExpression(ctx, expression, references)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return model.SaveResponse{}, err
+	}
+	es.Invalidate(expression.ID)
+
+	response.ExpressionId = saved.ID
+	response.Version = saved.Version
+	return response, nil
+}
+
+// DeleteExpression deletes an expression and drops the compiled expressions
+// inlining it. It is refused while other expressions reference it, unless
+// force is set; those then fail with ErrUnknownReference until updated.
+func (es *ExpressionService) DeleteExpression(ctx context.Context, expressionId int, force bool) error {
+	if es.Store == nil {
+		return errNoStore
+	}
+
+	if err := es.Store.DeleteExpression(ctx, expressionId, force); err != nil {
+		return err
+	}
+	es.Invalidate(expressionId)
+	return nil
+}
+
+func (es *ExpressionService) prepareSave(ctx context.Context, expression model.Expression) (model.SaveResponse, []model.Reference, error) {
+	response, err := es.analyzeForSave(ctx, expression)
+	if err != nil {
+		return model.SaveResponse{}, nil, err
+	}
+
+	references, err := es.references(ctx, expression)
+	if err != nil {
+		return model.SaveResponse{}, nil, err
+	}
+	return response, references, nil
+}
+
+// analyzeForSave validates a definition about to be stored and analyses it.
+// Definitions the analysis does not apply to, such as comparisons of numbers
+// or dialects without a syntax tree, are stored without it, as are those
+// whose analysis takes more than half the time the request has left.
+func (es *ExpressionService) analyzeForSave(ctx context.Context, expression model.Expression) (model.SaveResponse, error) {
+	logger := logging.FromContext(ctx)
+
+	if _, err := es.compile(ctx, expression); err != nil {
+		return model.SaveResponse{}, err
+	}
+
+	analysisCtx := ctx
+	if timeout := saveAnalysisTimeout(ctx); timeout > 0 {
+		var cancel context.CancelFunc
+		analysisCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	analysis, err := es.Analyze(analysisCtx, expression)
+	var dialectError *DialectError
+	switch {
+	case errors.Is(err, ErrNotBooleanVariables), errors.Is(err, ErrAnalysisTooLarge), errors.Is(err, ErrEvaluatingExpression),
+		errors.As(err, &dialectError) && dialectError.Feature == FeatureAnalysis,
+		errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+		logger.WithField("err", err.Error()).Debug("expression not analysed")
+		return model.SaveResponse{}, nil
+	case err != nil:
+		return model.SaveResponse{}, err
+	}
+
+	response := model.SaveResponse{Analysis: &analysis}
+	switch {
+	case analysis.Contradiction:
+		response.Warnings = append(response.Warnings, model.Warning{Code: util.WarningContradiction, Message: util.WarnContradiction})
+	case analysis.Tautology:
+		response.Warnings = append(response.Warnings, model.Warning{Code: util.WarningTautology, Message: util.WarnTautology})
+	}
+	if len(response.Warnings) > 0 {
+		logger.WithField("warnings", response.Warnings).Warn("expression is constant")
+	}
+
+	return response, nil
+}
+
+// references lists the expressions a definition references directly.
+// Definitions in a dialect without a syntax tree have no references.
+func (es *ExpressionService) references(ctx context.Context, expression model.Expression) ([]model.Reference, error) {
+	parse, translates := translator(expression.Dialect)
+	if !translates {
+		return nil, nil
+	}
+	tree, err := parse(expression.Definition)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCreatingEvaluableExpression, err)
+	}
+
+	var references []model.Reference
+	for _, target := range parser.References(tree) {
+		reference := &parser.Reference{Target: target}
+		referenced, err := es.lookup(ctx, reference)
+		if err != nil {
+			return nil, err
+		}
+		references = append(references, newReference(reference, referenced.ID))
+	}
+	return references, nil
+}
+
+func newReference(reference *parser.Reference, id int) model.Reference {
+	if _, isId := reference.ID(); isId {
+		return model.Reference{ID: id}
+	}
+	return model.Reference{ID: id, Name: reference.Target}
+}
+
+// BackfillReferences records the references of every stored expression, for
+// expressions stored before references were recorded with them. References
+// that match no expression are left out, as a forced delete leaves them.
+func (es *ExpressionService) BackfillReferences(ctx context.Context) error {
+	ctx, span := tracing.Tracer().Start(ctx, "ExpressionService.BackfillReferences")
+	defer span.End()
+
+	if es.Store == nil {
+		return errNoStore
+	}
+
+	expressions, err := es.Store.GetAllExpressions(ctx)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+
+	ids := make(map[int]bool, len(expressions))
+	names := make(map[string]int, len(expressions))
+	for _, expression := range expressions {
+		ids[expression.ID] = true
+		if expression.Name != "" {
+			names[expression.Name] = expression.ID
+		}
+	}
+
+	for _, expression := range expressions {
+		parse, translates := translator(expression.Dialect)
+		if !translates {
+			continue
+		}
+		tree, err := parse(expression.Definition)
+		if err != nil {
+			continue
+		}
+
+		var references []model.Reference
+		for _, target := range parser.References(tree) {
+			reference := &parser.Reference{Target: target}
+			id, isId := reference.ID()
+			if !isId {
+				id, isId = names[target]
+			}
+			if isId && ids[id] {
+				references = append(references, newReference(reference, id))
+			}
+		}
+
+		if err = es.Store.SaveReferences(ctx, expression.ID, references); err != nil {
+			tracing.RecordError(span, err)
+			return err
+		}
+	}
+
+	logging.FromContext(ctx).WithField("expressions", len(expressions)).Info("expression references recorded")
+	return nil
+}
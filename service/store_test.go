@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/repository"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExpression_CreateExpressionReferences(t *testing.T) {
+	testCases := []struct {
+		name       string
+		definition string
+		dialect    model.Dialect
+		expected   []model.Reference
+		err        error
+	}{
+		{
+			name:       "should record references by id and by name",
+			definition: "@isActive and @2 or @1",
+			expected:   []model.Reference{{ID: 1}, {ID: 2}, {ID: 1, Name: "isActive"}},
+		},
+		{
+			name:       "should record no references for definitions without them",
+			definition: "a or b",
+		},
+		{
+			name:       "should record no references for dialects without a syntax tree",
+			definition: "a && b",
+			dialect:    model.DialectGovaluate,
+		},
+		{
+			name:       "should reject unknown references",
+			definition: "@isMissing",
+			err:        ErrUnknownReference,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &repository.Stub{CreateExpressionId: 3, Expressions: []model.Expression{
+				{ID: 1, Name: "isActive", Definition: "active"},
+				{ID: 2, Definition: "premium"},
+			}}
+			es := ExpressionService{Source: store, Store: store}
+
+			response, err := es.CreateExpression(context.Background(), model.Expression{Definition: tc.definition, Dialect: tc.dialect})
+
+			assert.ErrorIs(t, err, tc.err)
+			if tc.err != nil {
+				assert.Nil(t, store.CreateExpressionCalledWith, "invalid definitions are not stored")
+				return
+			}
+			assert.Equal(t, 3, response.ExpressionId)
+			assert.Equal(t, tc.expected, store.References[3])
+		})
+	}
+}
+
+func TestExpression_DeleteExpression(t *testing.T) {
+	ctx := context.Background()
+	store := &repository.Stub{CreateExpressionId: 2, Expressions: []model.Expression{
+		{ID: 1, Name: "isActive", Definition: "active"},
+	}}
+	es := ExpressionService{Cache: NewExpressionCache(10), Source: store, Store: store}
+
+	_, err := es.CreateExpression(ctx, model.Expression{Definition: "@isActive and premium"})
+	assert.NoError(t, err)
+
+	var dependentsError *repository.DependentsError
+	err = es.DeleteExpression(ctx, 1, false)
+	assert.ErrorAs(t, err, &dependentsError)
+	assert.Equal(t, []int{2}, dependentsError.Dependents)
+
+	_, err = es.SaveExpression(ctx, model.ExpressionUpdate{ID: 2, Definition: "premium"})
+	assert.NoError(t, err)
+	assert.NoError(t, es.DeleteExpression(ctx, 1, false), "dropped references no longer hold the expression")
+
+	_, err = es.SaveExpression(ctx, model.ExpressionUpdate{ID: 2, Definition: "@1"})
+	assert.ErrorIs(t, err, ErrUnknownReference)
+}
+
+func TestExpression_SaveExpressionInvalidates(t *testing.T) {
+	ctx := context.Background()
+	store := &repository.Stub{Expressions: []model.Expression{
+		{ID: 1, Name: "isActive", Definition: "active"},
+	}}
+	es := ExpressionService{Cache: NewExpressionCache(10), Source: store, Store: store}
+	expression := model.Expression{ID: 10, Definition: "@isActive"}
+
+	response, err := es.ExecuteExpression(ctx, expression, "active=1", EvaluationOptions{})
+	assert.NoError(t, err)
+	assert.True(t, response.Result)
+
+	_, err = es.SaveExpression(ctx, model.ExpressionUpdate{ID: 1, Definition: "not active"})
+	assert.NoError(t, err)
+
+	response, err = es.ExecuteExpression(ctx, expression, "active=1", EvaluationOptions{})
+	assert.NoError(t, err)
+	assert.False(t, response.Result, "saving should drop the programs inlining the old definition")
+}
+
+// pausedSource pauses the first lookup by name after reading the expression,
+// until release is closed.
+type pausedSource struct {
+	*repository.Stub
+	read    chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (s *pausedSource) GetExpressionByName(ctx context.Context, name string) (model.Expression, error) {
+	expression, err := s.Stub.GetExpressionByName(ctx, name)
+	s.once.Do(func() {
+		close(s.read)
+		<-s.release
+	})
+	return expression, err
+}
+
+func TestExpression_SaveExpressionDuringCompilation(t *testing.T) {
+	ctx := context.Background()
+	store := &repository.Stub{Expressions: []model.Expression{
+		{ID: 1, Name: "isActive", Definition: "active"},
+	}}
+	source := &pausedSource{Stub: store, read: make(chan struct{}), release: make(chan struct{})}
+	es := ExpressionService{Cache: NewExpressionCache(10), Source: source, Store: store}
+	expression := model.Expression{ID: 10, Definition: "@isActive"}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		response, err := es.ExecuteExpression(ctx, expression, "active=1", EvaluationOptions{})
+		assert.NoError(t, err)
+		assert.True(t, response.Result, "the evaluation in flight uses the definition it read")
+	}()
+
+	<-source.read
+	_, err := es.SaveExpression(ctx, model.ExpressionUpdate{ID: 1, Definition: "not active"})
+	assert.NoError(t, err)
+	close(source.release)
+	<-done
+
+	response, err := es.ExecuteExpression(ctx, expression, "active=1", EvaluationOptions{})
+	assert.NoError(t, err)
+	assert.False(t, response.Result, "a program compiled from the old definition should not be cached")
+}
+
+func TestExpression_SaveExpressionRename(t *testing.T) {
+	ctx := context.Background()
+	store := &repository.Stub{CreateExpressionId: 2, Expressions: []model.Expression{
+		{ID: 1, Name: "isActive", Definition: "active"},
+	}}
+	es := ExpressionService{Cache: NewExpressionCache(10), Source: store, Store: store}
+
+	_, err := es.CreateExpression(ctx, model.Expression{Definition: "@isActive and premium"})
+	assert.NoError(t, err)
+
+	renamed, unchanged, cleared := "isEnabled", "isActive", ""
+	var dependentsError *repository.DependentsError
+	_, err = es.SaveExpression(ctx, model.ExpressionUpdate{ID: 1, Name: &renamed, Definition: "active"})
+	assert.ErrorIs(t, err, repository.ErrNameReferenced)
+	assert.ErrorAs(t, err, &dependentsError)
+	assert.Equal(t, []int{2}, dependentsError.Dependents)
+
+	_, err = es.SaveExpression(ctx, model.ExpressionUpdate{ID: 1, Name: &cleared, Definition: "active"})
+	assert.ErrorIs(t, err, repository.ErrNameReferenced, "clearing the name is a rename")
+
+	_, err = es.SaveExpression(ctx, model.ExpressionUpdate{ID: 1, Definition: "active and verified"})
+	assert.NoError(t, err, "an update without a name should keep it")
+	assert.Equal(t, "isActive", store.Expressions[0].Name)
+
+	_, err = es.SaveExpression(ctx, model.ExpressionUpdate{ID: 1, Name: &unchanged, Definition: "active"})
+	assert.NoError(t, err, "resending the same name should be allowed")
+
+	_, err = es.SaveExpression(ctx, model.ExpressionUpdate{ID: 2, Definition: "@1 and premium"})
+	assert.NoError(t, err)
+	_, err = es.SaveExpression(ctx, model.ExpressionUpdate{ID: 1, Name: &renamed, Definition: "active"})
+	assert.NoError(t, err, "references by id should not hold the name")
+}
+
+func TestExpression_SaveExpressionVersions(t *testing.T) {
+	ctx := context.Background()
+	store := &repository.Stub{CreateExpressionId: 1, Expressions: []model.Expression{}}
+	es := ExpressionService{Cache: NewExpressionCache(10), Source: store, Store: store}
+
+	created, err := es.CreateExpression(ctx, model.Expression{Definition: "(a and b) or (a and not b)"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created.Version)
+
+	saved, err := es.SaveExpression(ctx, model.ExpressionUpdate{ID: 1, Definition: "a", Version: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, saved.Version)
+
+	_, err = es.SaveExpression(ctx, model.ExpressionUpdate{ID: 1, Definition: "a or b", Version: 1})
+	assert.ErrorIs(t, err, repository.ErrVersionConflict, "a save from a stale read should be refused")
+
+	saved, err = es.SaveExpression(ctx, model.ExpressionUpdate{ID: 1, Definition: "a or b"})
+	assert.NoError(t, err, "a save without a version is not checked")
+	assert.Equal(t, 3, saved.Version)
+
+	versions, err := store.GetExpressionVersions(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.ExpressionVersion{
+		{Version: 1, Definition: "(a and b) or (a and not b)"},
+		{Version: 2, Definition: "a"},
+	}, versions)
+}
+
+func TestExpression_SaveExpressionKeepsDialect(t *testing.T) {
+	ctx := context.Background()
+	store := &repository.Stub{Expressions: []model.Expression{
+		{ID: 1, Definition: "a && b", Dialect: model.DialectCEL},
+	}}
+	es := ExpressionService{Source: store, Store: store}
+
+	_, err := es.SaveExpression(ctx, model.ExpressionUpdate{ID: 1, Definition: "a or b"})
+	assert.ErrorIs(t, err, ErrCreatingEvaluableExpression, "an update without a dialect should be validated in the stored one")
+
+	_, err = es.SaveExpression(ctx, model.ExpressionUpdate{ID: 1, Definition: "a || b"})
+	assert.NoError(t, err)
+	assert.Equal(t, model.DialectCEL, store.Expressions[0].Dialect)
+
+	native := model.DialectNative
+	_, err = es.SaveExpression(ctx, model.ExpressionUpdate{ID: 1, Definition: "a or b", Dialect: &native})
+	assert.NoError(t, err)
+	assert.Equal(t, model.DialectNative, store.Expressions[0].Dialect)
+}
+
+func TestExpression_SaveExpressionKeepsMissingVariables(t *testing.T) {
+	ctx := context.Background()
+	store := &repository.Stub{Expressions: []model.Expression{
+		{ID: 1, Definition: "a and b", MissingVariables: model.MissingVariablesFalse},
+	}}
+	es := ExpressionService{Source: store, Store: store}
+
+	_, err := es.SaveExpression(ctx, model.ExpressionUpdate{ID: 1, Definition: "a or b"})
+	assert.NoError(t, err)
+	assert.Equal(t, model.MissingVariablesFalse, store.Expressions[0].MissingVariables, "an update without a policy should keep it")
+
+	policy := model.MissingVariablesUnknown
+	_, err = es.SaveExpression(ctx, model.ExpressionUpdate{ID: 1, Definition: "a or b", MissingVariables: &policy})
+	assert.NoError(t, err)
+	assert.Equal(t, model.MissingVariablesUnknown, store.Expressions[0].MissingVariables)
+}
+
+// deadlineStore fails writes once the request is done, like the database.
+type deadlineStore struct {
+	*repository.Stub
+}
+
+func (s deadlineStore) CreateExpression(ctx context.Context, expression model.Expression, references []model.Reference) (model.Expression, error) {
+	if err := ctx.Err(); err != nil {
+		return model.Expression{}, err
+	}
+	return s.Stub.CreateExpression(ctx, expression, references)
+}
+
+func TestExpression_CreateExpressionSlowAnalysis(t *testing.T) {
+	store := deadlineStore{Stub: &repository.Stub{CreateExpressionId: 1}}
+	es := ExpressionService{Store: store}
+	assert.NoError(t, es.RegisterFunction(Function{
+		Name:       "slow",
+		Parameters: []parser.Type{parser.TypeBoolean},
+		Variadic:   true,
+		Returns:    parser.TypeBoolean,
+		Call: func(args ...interface{}) (interface{}, error) {
+			time.Sleep(20 * time.Millisecond)
+			return false, nil
+		},
+	}))
+
+	// Looking for a witness calls slow with each of the 32 assignments.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	response, err := es.CreateExpression(ctx, model.Expression{Definition: "slow(a, b, c, d, e)"})
+
+	assert.NoError(t, err, "a slow analysis should not fail the save")
+	assert.Nil(t, response.Analysis)
+	assert.Equal(t, 1, response.ExpressionId)
+
+	_, err = es.CreateExpression(ctx, model.Expression{Definition: "slow(a) and"})
+	assert.ErrorIs(t, err, ErrCreatingEvaluableExpression, "the definition is still validated")
+}
+
+func TestExpression_BackfillReferences(t *testing.T) {
+	store := &repository.Stub{GetAllExpressionsResponse: []model.Expression{
+		{ID: 1, Name: "isActive", Definition: "active"},
+		{ID: 2, Definition: "@isActive and @1"},
+		{ID: 3, Definition: "@isDeleted or @2"},
+		{ID: 4, Definition: "&"},
+		{ID: 5, Definition: "a && b", Dialect: model.DialectGovaluate},
+	}}
+	es := ExpressionService{Store: store}
+
+	assert.NoError(t, es.BackfillReferences(context.Background()))
+
+	assert.Equal(t, map[int][]model.Reference{
+		1: nil,
+		2: {{ID: 1}, {ID: 1, Name: "isActive"}},
+		3: {{ID: 2}},
+	}, store.References)
+}
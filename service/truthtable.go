@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/logging"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/parser"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/tracing"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/util"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrNotBooleanVariables = errors.New(util.ErrNotBooleanVariables)
+	ErrTruthTableTooLarge  = errors.New(util.ErrTruthTableTooLarge)
+)
+
+// DefaultMaxTruthTableVariables caps truth tables at 1024 rows when the
+// service is not configured otherwise.
+const DefaultMaxTruthTableVariables = 10
+
+// TruthTable evaluates the expression for every assignment of its variables.
+// Only definitions whose variables are all used as booleans can be tabulated.
+func (es *ExpressionService) TruthTable(ctx context.Context, expression model.Expression) (model.TruthTable, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ExpressionService.TruthTable")
+	defer span.End()
+	span.SetAttributes(attribute.Int("expression.id", expression.ID))
+
+	logger := logging.FromContext(ctx).WithField(logging.FieldExpressionId, expression.ID)
+
+	compiled, err := es.compileWithTree(ctx, expression, FeatureTruthTables)
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.WithField("err", err.Error()).Error("error creating evaluable expression")
+		return model.TruthTable{}, err
+	}
+
+	variables, err := booleanVariables(compiled.node)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return model.TruthTable{}, err
+	}
+	if len(variables) > es.maxTruthTableVariables() {
+		err := fmt.Errorf("%w: %d variables, at most %d allowed", ErrTruthTableTooLarge, len(variables), es.maxTruthTableVariables())
+		tracing.RecordError(span, err)
+		return model.TruthTable{}, err
+	}
+
+	results, err := evaluateAll(ctx, compiled, variables)
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.WithField("err", err.Error()).Error("error building truth table")
+		return model.TruthTable{}, err
+	}
+
+	table := model.TruthTable{
+		ExpressionId: expression.ID,
+		Definition:   expression.Definition,
+		Variables:    variables,
+		Rows:         make([]model.TruthTableRow, len(results)),
+	}
+	for row, result := range results {
+		values := make(map[string]bool, len(variables))
+		for i, name := range variables {
+			values[name] = row&(1<<(len(variables)-1-i)) != 0
+		}
+		table.Rows[row] = model.TruthTableRow{Values: values, Result: result}
+	}
+
+	return table, nil
+}
+
+func (es *ExpressionService) maxTruthTableVariables() int {
+	if es.MaxTruthTableVariables > 0 {
+		return es.MaxTruthTableVariables
+	}
+	return DefaultMaxTruthTableVariables
+}
+
+// booleanVariables returns the variables of node, failing when the definition
+// uses any of them as a number or a string.
+func booleanVariables(node parser.Node) ([]string, error) {
+	types := parser.InferTypes(node)
+	variables := parser.Variables(node)
+	if variables == nil {
+		variables = []string{}
+	}
+	for _, name := range variables {
+		if types[name] == parser.TypeNumber || types[name] == parser.TypeString {
+			return nil, fmt.Errorf("%w: %s is used as a %s", ErrNotBooleanVariables, name, types[name])
+		}
+	}
+	return variables, nil
+}
+
+// evaluateAll returns the result of the expression for every assignment of
+// variables, indexed by row in the order of enumerate.
+func evaluateAll(ctx context.Context, compiled *compiledExpression, variables []string) ([]bool, error) {
+	results := make([]bool, 0, 1<<len(variables))
+	err := enumerate(ctx, variables, func(parameters map[string]interface{}) error {
+		result, err := compiled.program.Evaluate(ctx, parameters)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrEvaluatingExpression, err)
+		}
+		outcome, isOutcome := toOutcome(result)
+		if !isOutcome {
+			return fmt.Errorf("%w: result %v is not a boolean", ErrEvaluatingExpression, result)
+		}
+		results = append(results, outcome == model.OutcomeTrue)
+		return nil
+	})
+	return results, err
+}
+
+// enumerate calls visit with every assignment of variables, counting in binary
+// from all false to all true with the first variable as the most significant
+// bit. It stops at the first error, or when ctx is done.
+func enumerate(ctx context.Context, variables []string, visit func(parameters map[string]interface{}) error) error {
+	for row := 0; row < 1<<len(variables); row++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		parameters := make(map[string]interface{}, len(variables))
+		for i, name := range variables {
+			parameters[name] = row&(1<<(len(variables)-1-i)) != 0
+		}
+		if err := visit(parameters); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"testing"
+)
+
+func TestExpression_TruthTable(t *testing.T) {
+	testCases := []struct {
+		name       string
+		service    ExpressionService
+		definition string
+		expected   model.TruthTable
+		err        error
+	}{
+		{
+			name:       "should enumerate every assignment in binary order",
+			definition: "x and not y",
+			expected: model.TruthTable{
+				ExpressionId: 1,
+				Definition:   "x and not y",
+				Variables:    []string{"x", "y"},
+				Rows: []model.TruthTableRow{
+					{Values: map[string]bool{"x": false, "y": false}, Result: false},
+					{Values: map[string]bool{"x": false, "y": true}, Result: false},
+					{Values: map[string]bool{"x": true, "y": false}, Result: true},
+					{Values: map[string]bool{"x": true, "y": true}, Result: false},
+				},
+			},
+		},
+		{
+			name:       "should return a single row for constant definitions",
+			definition: "true",
+			expected: model.TruthTable{
+				ExpressionId: 1,
+				Definition:   "true",
+				Variables:    []string{},
+				Rows:         []model.TruthTableRow{{Values: map[string]bool{}, Result: true}},
+			},
+		},
+		{
+			name:       "should reject variables used as numbers",
+			definition: "x and y > 2",
+			err:        ErrNotBooleanVariables,
+		},
+		{
+			name:       "should reject tables over the configured cap",
+			service:    ExpressionService{MaxTruthTableVariables: 2},
+			definition: "x and y and z",
+			err:        ErrTruthTableTooLarge,
+		},
+		{
+			name:       "should reject invalid definitions",
+			definition: "x and",
+			err:        ErrCreatingEvaluableExpression,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			table, err := tc.service.TruthTable(context.Background(), model.Expression{ID: 1, Definition: tc.definition})
+
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, tc.expected, table)
+		})
+	}
+}
+
+func TestExpression_TruthTableCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	es := ExpressionService{}
+	_, err := es.TruthTable(ctx, model.Expression{ID: 1, Definition: "x or y"})
+
+	assert.ErrorIs(t, err, context.Canceled)
+}
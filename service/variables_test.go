@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/viclisboa/regularExpressionEvaluatorAPI/model"
+	"testing"
+)
+
+func TestExpression_Variables(t *testing.T) {
+	testCases := []struct {
+		name       string
+		definition string
+		expected   []model.Variable
+		err        error
+	}{
+		{
+			name:       "should report boolean variables of connectives",
+			definition: "y or (x and not z)",
+			expected: []model.Variable{
+				{Name: "x", Type: "boolean"},
+				{Name: "y", Type: "boolean"},
+				{Name: "z", Type: "boolean"},
+			},
+		},
+		{
+			name:       "should infer types from comparisons",
+			definition: `age >= 18 and country == "BR" and verified`,
+			expected: []model.Variable{
+				{Name: "age", Type: "number"},
+				{Name: "country", Type: "string"},
+				{Name: "verified", Type: "boolean"},
+			},
+		},
+		{
+			name:       "should report no variables for constant definitions",
+			definition: "true or false",
+			expected:   []model.Variable{},
+		},
+		{
+			name:       "should fail on invalid definitions",
+			definition: "x and",
+			err:        ErrCreatingEvaluableExpression,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			es := ExpressionService{}
+			variables, err := es.Variables(context.Background(), model.Expression{ID: 1, Definition: tc.definition})
+
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, tc.expected, variables)
+		})
+	}
+}
@@ -2,7 +2,97 @@ package util
 
 const (
 	ErrParsingExpressionId              = "error parsing expressionId to int"
-	ErrRecoveringExpressionFromDatabase = "error recovering expressiong from database"
+	ErrRecoveringExpressionFromDatabase = "error recovering expression from database"
 	ErrCreatingEvaluableExpression      = "error creating evaluable expression"
 	ErrEvaluatingExpression             = "error evaluating expression"
+	ErrExpressionNotFound               = "expression not found"
+	ErrExecutingQuery                   = "failed to execute query"
+	ErrReadingBody                      = "error reading request body"
+	ErrInvalidBody                      = "request body is not valid json"
+	ErrInvalidFields                    = "request body has invalid fields"
+	ErrInvalidQuery                     = "query string has invalid parameters"
+	ErrEncodingResponse                 = "error encoding response"
+	ErrUnauthorized                     = "invalid or missing credentials"
+	ErrRouteNotFound                    = "route not found"
+	ErrMethodNotAllowed                 = "method not allowed"
+	ErrRequestCancelled                 = "request cancelled by the client"
+	ErrRequestTimeout                   = "request deadline exceeded"
+	ErrInternal                         = "internal error"
+	ErrNotBooleanVariables              = "expression has variables that are not booleans"
+	ErrTruthTableTooLarge               = "expression has too many variables for a truth table"
+	ErrAnalysisTooLarge                 = "expression has too many variables to analyse"
+	ErrUnknownReference                 = "expression references an expression that does not exist"
+	ErrReferenceCycle                   = "expression references form a cycle"
+	ErrExpressionNameTaken              = "expression name is already in use"
+	ErrHasDependents                    = "expression is referenced by other expressions, use force=true to delete it anyway"
+	ErrUnknownFunction                  = "expression calls a function that does not exist"
+	ErrInvalidArguments                 = "expression calls a function with invalid arguments"
+	ErrInvalidFunction                  = "function cannot be registered"
+	ErrMissingPath                      = "variable path does not exist in the values"
+	ErrDefinitionTooLong                = "expression definition is too long"
+	ErrExpressionTooDeep                = "expression is nested too deeply"
+	ErrExpressionTooLarge               = "expression has too many nodes"
+	ErrTooManyVariables                 = "expression has too many variables"
+	ErrEvaluationTimeout                = "expression evaluation took too long"
+	ErrUnsupportedDialect               = "expression dialect does not support this operation"
+	ErrBodyTooLarge                     = "request body is too large"
+	ErrValuesTooLarge                   = "evaluation values are too large"
+	ErrNameReferenced                   = "expression name is referenced by other expressions, update them before renaming it"
+	ErrVersionConflict                  = "expression was updated since the version it was read at"
+	ErrSimplifyingReferences            = "expression references other expressions, which its simplification would inline"
+)
+
+// Error codes are part of the API contract: clients match on them, so they
+// must never be renamed. The message each one is sent with is set where it is
+// written, mostly in the errorMappings of handler/errors.go, and need not share
+// its name (CodeDatabaseError is sent with ErrExecutingQuery).
+const (
+	CodeInvalidExpressionId = "INVALID_EXPRESSION_ID"
+	CodeInvalidExpression   = "INVALID_EXPRESSION"
+	CodeEvaluationFailed    = "EVALUATION_FAILED"
+	CodeExpressionNotFound  = "EXPRESSION_NOT_FOUND"
+	CodeDatabaseError       = "DATABASE_ERROR"
+	CodeInvalidBody         = "INVALID_BODY"
+	CodeValidationFailed    = "VALIDATION_FAILED"
+	CodeUnauthorized        = "UNAUTHORIZED"
+	CodeRouteNotFound       = "ROUTE_NOT_FOUND"
+	CodeMethodNotAllowed    = "METHOD_NOT_ALLOWED"
+	CodeRequestCancelled    = "REQUEST_CANCELLED"
+	CodeRequestTimeout      = "REQUEST_TIMEOUT"
+	CodeInternal            = "INTERNAL_ERROR"
+	CodeNotBooleanVariables = "NOT_BOOLEAN_VARIABLES"
+	CodeTruthTableTooLarge  = "TRUTH_TABLE_TOO_LARGE"
+	CodeAnalysisTooLarge    = "ANALYSIS_TOO_LARGE"
+	CodeUnknownReference    = "UNKNOWN_REFERENCE"
+	CodeReferenceCycle      = "REFERENCE_CYCLE"
+	CodeNameConflict        = "NAME_CONFLICT"
+	CodeHasDependents       = "HAS_DEPENDENTS"
+	CodeUnknownFunction     = "UNKNOWN_FUNCTION"
+	CodeInvalidArguments    = "INVALID_ARGUMENTS"
+	CodeMissingPath         = "MISSING_PATH"
+	CodeDefinitionTooLong   = "DEFINITION_TOO_LONG"
+	CodeExpressionTooDeep   = "EXPRESSION_TOO_DEEP"
+	CodeExpressionTooLarge  = "EXPRESSION_TOO_LARGE"
+	CodeTooManyVariables    = "TOO_MANY_VARIABLES"
+	CodeEvaluationTimeout   = "EVALUATION_TIMEOUT"
+	CodeUnsupportedDialect  = "UNSUPPORTED_DIALECT"
+	CodeBodyTooLarge        = "BODY_TOO_LARGE"
+	CodeValuesTooLarge      = "VALUES_TOO_LARGE"
+	CodeNameReferenced      = "NAME_REFERENCED"
+	CodeVersionConflict     = "VERSION_CONFLICT"
+	CodeHasReferences       = "HAS_REFERENCES"
+)
+
+// Warning codes flag definitions that are accepted but probably wrong.
+const (
+	WarningContradiction = "CONTRADICTION"
+	WarningTautology     = "TAUTOLOGY"
+
+	WarnContradiction = "expression can never be true"
+	WarnTautology     = "expression is always true"
+)
+
+const (
+	HealthStatusOk          = "ok"
+	HealthStatusUnavailable = "unavailable"
 )